@@ -0,0 +1,103 @@
+package geocoder
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var gazetteerColumns = []string{"name", "region", "country", "country_code", "lat", "lon", "timezone", "postal_codes"}
+
+type gazetteerEntry struct {
+	Location
+	postalCodes []string
+}
+
+// Gazetteer is an offline geocoder backed by a CSV file with the header
+// name,region,country,country_code,lat,lon,timezone,postal_codes
+// where postal_codes is a space separated list and may be empty.
+type Gazetteer struct {
+	entries []gazetteerEntry
+}
+
+func LoadGazetteer(path string) (*Gazetteer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gazetteer: %w", err)
+	}
+	defer file.Close()
+
+	return ReadGazetteer(file)
+}
+
+func ReadGazetteer(r io.Reader) (*Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(gazetteerColumns)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gazetteer header: %w", err)
+	}
+	if !slices.Equal(header, gazetteerColumns) {
+		return nil, fmt.Errorf("unexpected gazetteer header %v, expected %v", header, gazetteerColumns)
+	}
+
+	g := &Gazetteer{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gazetteer: %w", err)
+		}
+
+		lat, err := strconv.ParseFloat(record[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude for %s: %w", record[0], err)
+		}
+		lon, err := strconv.ParseFloat(record[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude for %s: %w", record[0], err)
+		}
+
+		g.entries = append(g.entries, gazetteerEntry{
+			Location: Location{
+				Name:        record[0],
+				Region:      record[1],
+				Country:     record[2],
+				CountryCode: record[3],
+				Lat:         lat,
+				Lon:         lon,
+				Timezone:    record[6],
+			},
+			postalCodes: strings.Fields(record[7]),
+		})
+	}
+	return g, nil
+}
+
+func (g *Gazetteer) Search(ctx context.Context, query string) ([]Location, error) {
+	q := ParseQuery(query)
+
+	var locations []Location
+	for _, entry := range g.entries {
+		if !strings.EqualFold(entry.Name, q.Name) && !slices.Contains(entry.postalCodes, q.Name) {
+			continue
+		}
+		if !q.matchesCountry(entry.CountryCode, entry.Country) {
+			continue
+		}
+		locations = append(locations, entry.Location)
+	}
+
+	if len(locations) == 0 {
+		return nil, ErrNotFound
+	}
+	return locations, nil
+}
@@ -0,0 +1,60 @@
+package geocoder
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGazetteerSearch(t *testing.T) {
+	g, err := LoadGazetteer("testdata/places.csv")
+	if err != nil {
+		t.Fatalf("failed to load gazetteer: %v", err)
+	}
+
+	tests := []struct {
+		query     string
+		countries []string
+	}{
+		{"berlin", []string{"DE", "US"}},
+		{"Berlin,US", []string{"US"}},
+		{"Berlin, Germany", []string{"DE"}},
+		{"10117", []string{"DE"}},
+		{"Oslo", []string{"NO"}},
+	}
+	for _, tt := range tests {
+		locations, err := g.Search(context.Background(), tt.query)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.query, err)
+			continue
+		}
+		if len(locations) != len(tt.countries) {
+			t.Errorf("%q: expected %d locations, got %+v", tt.query, len(tt.countries), locations)
+			continue
+		}
+		for i, location := range locations {
+			if location.CountryCode != tt.countries[i] {
+				t.Errorf("%q: expected %s, got %s", tt.query, tt.countries[i], location.CountryCode)
+			}
+		}
+	}
+
+	if _, err := g.Search(context.Background(), "Atlantis"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestReadGazetteer_InvalidHeader(t *testing.T) {
+	_, err := ReadGazetteer(strings.NewReader("name,lat,lon\nBerlin,52.5,13.4\n"))
+	if err == nil {
+		t.Fatal("expected an error for invalid header")
+	}
+}
+
+func TestReadGazetteer_InvalidCoordinates(t *testing.T) {
+	_, err := ReadGazetteer(strings.NewReader(strings.Join(gazetteerColumns, ",") + "\nBerlin,,Germany,DE,north,13.4,Europe/Berlin,\n"))
+	if err == nil {
+		t.Fatal("expected an error for invalid latitude")
+	}
+}
@@ -0,0 +1,44 @@
+package geocoder
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrNotFound = errors.New("location not found")
+
+type Location struct {
+	Name        string  `json:"name"`
+	Region      string  `json:"region,omitempty"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"country_code"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Timezone    string  `json:"timezone"`
+}
+
+// Geocoder resolves a place query into candidate locations. Several results
+// mean the query is ambiguous; no results are reported with ErrNotFound.
+type Geocoder interface {
+	Search(ctx context.Context, query string) ([]Location, error)
+}
+
+type Query struct {
+	Name    string
+	Country string
+}
+
+// ParseQuery splits "city", "postal code" and "city,country" forms.
+// The country may be an ISO 3166-1 alpha-2 code or a name.
+func ParseQuery(query string) Query {
+	name, country, _ := strings.Cut(query, ",")
+	return Query{
+		Name:    strings.TrimSpace(name),
+		Country: strings.TrimSpace(country),
+	}
+}
+
+func (q Query) matchesCountry(code, name string) bool {
+	return q.Country == "" || strings.EqualFold(q.Country, code) || strings.EqualFold(q.Country, name)
+}
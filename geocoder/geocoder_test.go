@@ -0,0 +1,22 @@
+package geocoder
+
+import (
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected Query
+	}{
+		{"Berlin", Query{Name: "Berlin"}},
+		{"10115", Query{Name: "10115"}},
+		{"Berlin, DE", Query{Name: "Berlin", Country: "DE"}},
+		{" Berlin ,Germany", Query{Name: "Berlin", Country: "Germany"}},
+	}
+	for _, tt := range tests {
+		if got := ParseQuery(tt.query); got != tt.expected {
+			t.Errorf("ParseQuery(%q): expected %+v, got %+v", tt.query, tt.expected, got)
+		}
+	}
+}
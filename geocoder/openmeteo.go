@@ -0,0 +1,88 @@
+package geocoder
+
+import (
+	"context"
+	"cycloid/test/provider"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const openMeteoGeocodingURI = "https://geocoding-api.open-meteo.com/v1/search?name=%s&count=10&language=en&format=json"
+
+type OpenMeteo struct{}
+
+type openMeteoGeocodingResponceType struct {
+	Results []struct {
+		Name        string   `json:"name"`
+		Latitude    float64  `json:"latitude"`
+		Longitude   float64  `json:"longitude"`
+		CountryCode string   `json:"country_code"`
+		Country     string   `json:"country"`
+		Admin1      string   `json:"admin1"`
+		Timezone    string   `json:"timezone"`
+		Postcodes   []string `json:"postcodes"`
+	} `json:"results"`
+}
+
+func NewOpenMeteo() *OpenMeteo {
+	return &OpenMeteo{}
+}
+
+// Search keeps only results whose name or postal code matches the query exactly,
+// as the upstream search is fuzzy.
+func (o *OpenMeteo) Search(ctx context.Context, query string) ([]Location, error) {
+	q := ParseQuery(query)
+	if q.Name == "" {
+		return nil, ErrNotFound
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(openMeteoGeocodingURI, url.QueryEscape(q.Name)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocoding: %w: %d", provider.ErrUpstreamStatus, resp.StatusCode)
+	}
+
+	var data openMeteoGeocodingResponceType
+
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	if err != nil {
+		return nil, fmt.Errorf("geocoding: %w", err)
+	}
+
+	var locations []Location
+	for _, result := range data.Results {
+		if !strings.EqualFold(result.Name, q.Name) && !slices.Contains(result.Postcodes, q.Name) {
+			continue
+		}
+		if !q.matchesCountry(result.CountryCode, result.Country) {
+			continue
+		}
+		locations = append(locations, Location{
+			Name:        result.Name,
+			Region:      result.Admin1,
+			Country:     result.Country,
+			CountryCode: result.CountryCode,
+			Lat:         result.Latitude,
+			Lon:         result.Longitude,
+			Timezone:    result.Timezone,
+		})
+	}
+
+	if len(locations) == 0 {
+		return nil, ErrNotFound
+	}
+	return locations, nil
+}
@@ -0,0 +1,91 @@
+package geocoder
+
+import (
+	"context"
+	"cycloid/test/provider"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+const openMeteoBerlinResponse = `{
+	"results": [
+		{"name": "Berlin", "latitude": 52.52437, "longitude": 13.41053, "country_code": "DE", "country": "Germany",
+			"admin1": "Land Berlin", "timezone": "Europe/Berlin", "postcodes": ["10115", "10117"]},
+		{"name": "Berlin", "latitude": 44.46867, "longitude": -71.18508, "country_code": "US", "country": "United States",
+			"admin1": "New Hampshire", "timezone": "America/New_York", "postcodes": ["03570"]},
+		{"name": "Berlingen", "latitude": 47.67, "longitude": 9.01, "country_code": "CH", "country": "Switzerland",
+			"admin1": "Thurgau", "timezone": "Europe/Zurich"}
+	]
+}`
+
+func mockOpenMeteoGeocoding(t *testing.T, body string) {
+	originalTransport := http.DefaultTransport
+	t.Cleanup(func() { http.DefaultTransport = originalTransport })
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return mockHTTPResponse(200, body), nil
+		},
+	}
+}
+
+func TestOpenMeteoSearch_UpstreamStatus(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	t.Cleanup(func() { http.DefaultTransport = originalTransport })
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return mockHTTPResponse(http.StatusTooManyRequests, ""), nil
+		},
+	}
+
+	_, err := NewOpenMeteo().Search(context.Background(), "Berlin")
+	if !errors.Is(err, provider.ErrUpstreamStatus) {
+		t.Fatalf("expected ErrUpstreamStatus, got %v", err)
+	}
+}
+
+func TestOpenMeteoSearch_Ambiguous(t *testing.T) {
+	mockOpenMeteoGeocoding(t, openMeteoBerlinResponse)
+
+	locations, err := NewOpenMeteo().Search(context.Background(), "Berlin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(locations) != 2 {
+		t.Fatalf("expected 2 exact matches, got %+v", locations)
+	}
+}
+
+func TestOpenMeteoSearch_Country(t *testing.T) {
+	mockOpenMeteoGeocoding(t, openMeteoBerlinResponse)
+
+	locations, err := NewOpenMeteo().Search(context.Background(), "Berlin,germany")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(locations) != 1 || locations[0].CountryCode != "DE" || locations[0].Timezone != "Europe/Berlin" {
+		t.Errorf("unexpected locations: %+v", locations)
+	}
+}
+
+func TestOpenMeteoSearch_PostalCode(t *testing.T) {
+	mockOpenMeteoGeocoding(t, openMeteoBerlinResponse)
+
+	locations, err := NewOpenMeteo().Search(context.Background(), "03570")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(locations) != 1 || locations[0].CountryCode != "US" {
+		t.Errorf("unexpected locations: %+v", locations)
+	}
+}
+
+func TestOpenMeteoSearch_NotFound(t *testing.T) {
+	mockOpenMeteoGeocoding(t, `{"generationtime_ms": 0.5}`)
+
+	_, err := NewOpenMeteo().Search(context.Background(), "Atlantis")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
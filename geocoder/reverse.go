@@ -0,0 +1,262 @@
+package geocoder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The datasets are built by tools/geodata: populated places from the public
+// domain tidwall/cities list, and IANA timezone boundaries from
+// timezone-boundary-builder (ODbL) sampled on a grid of timezoneResolution degrees.
+var (
+	//go:embed data/places.csv.gz
+	placesData []byte
+	//go:embed data/timezones.txt.gz
+	timezonesData []byte
+)
+
+const (
+	timezoneResolution = 0.1
+	placeResolution    = 1.0
+	earthRadiusKm      = 6371.0
+)
+
+// Place is the populated place nearest to a point, with the timezone of the point itself.
+type Place struct {
+	Location
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// ReverseGeocoder finds the place and timezone of a coordinate.
+type ReverseGeocoder interface {
+	Reverse(lat, lon float64) (Place, error)
+}
+
+type timezoneRun struct {
+	end  int
+	zone int
+}
+
+// placeGrid indexes places by cells of placeResolution degrees, row by row
+// from the south pole and column by column from the antimeridian.
+type placeGrid struct {
+	rows, cols int
+	cells      [][]int
+}
+
+func newPlaceGrid(places []Location) placeGrid {
+	g := placeGrid{
+		rows: int(math.Round(180 / placeResolution)),
+		cols: int(math.Round(360 / placeResolution)),
+	}
+	g.cells = make([][]int, g.rows*g.cols)
+	for i, place := range places {
+		row, col := g.cell(place.Lat, place.Lon)
+		g.cells[row*g.cols+col] = append(g.cells[row*g.cols+col], i)
+	}
+	return g
+}
+
+func (g placeGrid) cell(lat, lon float64) (int, int) {
+	row := min(max(int((lat+90)/placeResolution), 0), g.rows-1)
+	col := min(max(int((lon+180)/placeResolution), 0), g.cols-1)
+	return row, col
+}
+
+// ring calls visit with the places of the cells r cells away from (row, col),
+// wrapping around the antimeridian.
+func (g placeGrid) ring(row, col, r int, visit func(int)) {
+	for dr := -r; dr <= r; dr++ {
+		if row+dr < 0 || row+dr >= g.rows {
+			continue
+		}
+		step := 2 * r
+		if dr == -r || dr == r || r == 0 {
+			step = 1
+		}
+		for dc := -r; dc <= r; dc += step {
+			c := ((col+dc)%g.cols + g.cols) % g.cols
+			for _, i := range g.cells[(row+dr)*g.cols+c] {
+				visit(i)
+			}
+		}
+	}
+}
+
+// Offline is a ReverseGeocoder backed by the embedded datasets.
+type Offline struct {
+	places []Location
+	grid   placeGrid
+	zones  []string
+	rows   [][]timezoneRun
+}
+
+func NewOffline() (*Offline, error) {
+	places, err := readPlaces(placesData)
+	if err != nil {
+		return nil, err
+	}
+	zones, rows, err := readTimezones(timezonesData)
+	if err != nil {
+		return nil, err
+	}
+	return &Offline{
+		places: places,
+		grid:   newPlaceGrid(places),
+		zones:  zones,
+		rows:   rows,
+	}, nil
+}
+
+func gunzip(data []byte) (io.Reader, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func readPlaces(data []byte) ([]Location, error) {
+	reader, err := gunzip(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read places: %w", err)
+	}
+
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read places: %w", err)
+	}
+
+	places := make([]Location, 0, len(records))
+	for _, record := range records[1:] {
+		lat, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude for %s: %w", record[0], err)
+		}
+		lon, err := strconv.ParseFloat(record[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude for %s: %w", record[0], err)
+		}
+		places = append(places, Location{
+			Name:        record[0],
+			Country:     record[1],
+			CountryCode: record[2],
+			Lat:         lat,
+			Lon:         lon,
+			Timezone:    record[5],
+		})
+	}
+	return places, nil
+}
+
+// readTimezones parses the run-length encoded raster: a first line with the
+// zone names, then one line per row from north to south of "zone*count" runs.
+func readTimezones(data []byte) ([]string, [][]timezoneRun, error) {
+	reader, err := gunzip(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read timezones: %w", err)
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return nil, nil, fmt.Errorf("failed to read timezones: missing zone names")
+	}
+	zones := strings.Split(scanner.Text(), ",")
+
+	cols := int(math.Round(360 / timezoneResolution))
+	var rows [][]timezoneRun
+	for scanner.Scan() {
+		var row []timezoneRun
+		end := 0
+		for _, field := range strings.Fields(scanner.Text()) {
+			zone, count, ok := strings.Cut(field, "*")
+			z, err := strconv.Atoi(zone)
+			if err != nil || !ok || z < 0 || z >= len(zones) {
+				return nil, nil, fmt.Errorf("invalid timezone run %q", field)
+			}
+			n, err := strconv.Atoi(count)
+			if err != nil || n <= 0 {
+				return nil, nil, fmt.Errorf("invalid timezone run %q", field)
+			}
+			end += n
+			row = append(row, timezoneRun{end: end, zone: z})
+		}
+		if end != cols {
+			return nil, nil, fmt.Errorf("timezone row %d has %d cells, expected %d", len(rows), end, cols)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read timezones: %w", err)
+	}
+	if len(rows) != int(math.Round(180/timezoneResolution)) {
+		return nil, nil, fmt.Errorf("timezone raster has %d rows", len(rows))
+	}
+	return zones, rows, nil
+}
+
+// Timezone returns the IANA timezone at the point. Points at sea get the
+// nautical Etc/GMT zone of their longitude.
+func (o *Offline) Timezone(lat, lon float64) string {
+	row := min(max(int((90-lat)/timezoneResolution), 0), len(o.rows)-1)
+	runs := o.rows[row]
+	col := min(max(int((lon+180)/timezoneResolution), 0), runs[len(runs)-1].end-1)
+
+	i := sort.Search(len(runs), func(i int) bool { return runs[i].end > col })
+	return o.zones[runs[i].zone]
+}
+
+func (o *Offline) Reverse(lat, lon float64) (Place, error) {
+	if len(o.places) == 0 {
+		return Place{}, ErrNotFound
+	}
+
+	// Search the cells ring by ring around the point. Places beyond ring r are
+	// at least r cells away in latitude or longitude, so no closer than the
+	// meridian r cells away, which bounds the search.
+	row, col := o.grid.cell(lat, lon)
+	nearest, distance := 0, math.Inf(1)
+	for r := 0; r <= max(o.grid.rows, o.grid.cols/2); r++ {
+		o.grid.ring(row, col, r, func(i int) {
+			if d := haversineKm(lat, lon, o.places[i].Lat, o.places[i].Lon); d < distance {
+				nearest, distance = i, d
+			}
+		})
+		if distance <= meridianDistanceKm(lat, float64(r)*placeResolution) {
+			break
+		}
+	}
+
+	place := Place{
+		Location:   o.places[nearest],
+		DistanceKm: math.Round(distance*10) / 10,
+	}
+	place.Timezone = o.Timezone(lat, lon)
+	return place, nil
+}
+
+// meridianDistanceKm is the distance from a point to the meridian dLon
+// degrees away, a lower bound for places at least that far in longitude.
+func meridianDistanceKm(lat, dLon float64) float64 {
+	toRad := math.Pi / 180
+	return earthRadiusKm * math.Asin(math.Sin(min(dLon, 90)*toRad)*math.Cos(lat*toRad))
+}
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
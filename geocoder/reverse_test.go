@@ -0,0 +1,90 @@
+package geocoder
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestOfflineReverse(t *testing.T) {
+	offline, err := NewOffline()
+	if err != nil {
+		t.Fatalf("failed to load embedded datasets: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		lat, lon    float64
+		place       string
+		countryCode string
+		timezone    string
+	}{
+		{"Berlin", 52.52, 13.41, "Berlin", "DE", "Europe/Berlin"},
+		{"Oslo", 59.91, 10.75, "Oslo", "NO", "Europe/Oslo"},
+		{"Denver", 39.74, -104.99, "Denver", "US", "America/Denver"},
+		{"Sydney", -33.87, 151.21, "Sydney", "AU", "Australia/Sydney"},
+	}
+	for _, tt := range tests {
+		place, err := offline.Reverse(tt.lat, tt.lon)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if place.Name != tt.place || place.CountryCode != tt.countryCode || place.Timezone != tt.timezone {
+			t.Errorf("%s: unexpected place %+v", tt.name, place)
+		}
+		if place.DistanceKm > 10 {
+			t.Errorf("%s: expected a nearby place, got %.1f km", tt.name, place.DistanceKm)
+		}
+	}
+}
+
+func TestOfflineReverse_MatchesFullScan(t *testing.T) {
+	offline, err := NewOffline()
+	if err != nil {
+		t.Fatalf("failed to load embedded datasets: %v", err)
+	}
+
+	points := [][2]float64{
+		{0, 0}, {89.9, 10}, {-89.9, -170}, {64.1, -179.9}, {-17.7, 179.9},
+		{35.7, 139.7}, {-54.8, -68.3}, {21.3, -157.9}, {78.2, 15.6}, {-40, -120},
+	}
+	for _, point := range points {
+		place, err := offline.Reverse(point[0], point[1])
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", point, err)
+		}
+		nearest := math.Inf(1)
+		for _, p := range offline.places {
+			nearest = min(nearest, haversineKm(point[0], point[1], p.Lat, p.Lon))
+		}
+		if place.DistanceKm != math.Round(nearest*10)/10 {
+			t.Errorf("%v: expected the nearest place at %.1f km, got %+v", point, nearest, place)
+		}
+	}
+}
+
+func TestOfflineTimezone_Ocean(t *testing.T) {
+	offline, err := NewOffline()
+	if err != nil {
+		t.Fatalf("failed to load embedded datasets: %v", err)
+	}
+
+	zone := offline.Timezone(0, -140)
+	if zone != "Etc/GMT+9" {
+		t.Errorf("expected Etc/GMT+9 in the middle of the Pacific, got %s", zone)
+	}
+}
+
+func TestOfflineTimezone_Loadable(t *testing.T) {
+	offline, err := NewOffline()
+	if err != nil {
+		t.Fatalf("failed to load embedded datasets: %v", err)
+	}
+
+	for _, zone := range offline.zones {
+		if _, err := time.LoadLocation(zone); err != nil {
+			t.Errorf("timezone %q cannot be loaded: %v", zone, err)
+		}
+	}
+}
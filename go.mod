@@ -1,10 +1,19 @@
 module cycloid/test
 
-go 1.22.5
+go 1.22.7
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	go.etcd.io/bbolt v1.3.11
+	google.golang.org/grpc v1.68.0
+	google.golang.org/protobuf v1.35.1
+	gopkg.in/yaml.v2 v2.4.0
+)
 
 require (
 	github.com/kr/pretty v0.3.1 // indirect
+	golang.org/x/net v0.29.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240903143218-8af14fe29dc1 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 )
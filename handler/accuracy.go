@@ -0,0 +1,431 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"cycloid/test/history"
+	"cycloid/test/provider"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultVerificationInterval = 6 * time.Hour
+
+	// minWeightSamples verified forecasts of a variable give a provider its
+	// consensus weight.
+	minWeightSamples = 10
+	// minWeightError bounds the weight of a provider that was always right.
+	minWeightError = 0.01
+
+	// maxObservationDays are observed in a single request, the later days
+	// wait for the next verification.
+	maxObservationDays = 31
+	// observationDelay days is how late the archive may publish a day; a day
+	// it has not reported by then counts a failed attempt at every
+	// verification, and is no longer observed after maxObservationAttempts.
+	observationDelay       = 7
+	maxObservationAttempts = 4
+
+	unknownRegion = "unknown"
+)
+
+// AccuracyScore compares the forecasts of a provider with the observed
+// weather, for a region, a variable and a lead time in days. Errors are the
+// forecast minus the observation, in canonical units.
+type AccuracyScore struct {
+	Provider string  `json:"provider"`
+	Region   string  `json:"region"`
+	Variable string  `json:"variable"`
+	LeadDays int     `json:"lead_days"`
+	Count    int     `json:"count"`
+	MAE      float64 `json:"mae"`
+	Bias     float64 `json:"bias"`
+	RMSE     float64 `json:"rmse"`
+}
+
+// AccuracyReport is the /accuracy response. Weights are those of the
+// consensus, by provider and variable, when it is weighted.
+type AccuracyReport struct {
+	UpdatedAt         *time.Time                    `json:"updated_at,omitempty"`
+	WeightedConsensus bool                          `json:"weighted_consensus"`
+	Scores            []AccuracyScore               `json:"scores"`
+	Weights           map[string]map[string]float64 `json:"weights,omitempty"`
+}
+
+type scoreKey struct {
+	provider, region, variable string
+	leadDays                   int
+}
+
+// errorSum accumulates forecast errors.
+type errorSum struct {
+	count                   int
+	sum, sumAbs, sumSquares float64
+}
+
+func (e *errorSum) add(err float64) {
+	e.count++
+	e.sum += err
+	e.sumAbs += math.Abs(err)
+	e.sumSquares += err * err
+}
+
+// accuracyState holds the scores of the last verification and the consensus
+// weights derived from them.
+type accuracyState struct {
+	mu        sync.Mutex
+	scores    []AccuracyScore
+	weights   map[string]map[string]float64
+	updatedAt time.Time
+}
+
+func (a *accuracyState) set(scores []AccuracyScore, weights map[string]map[string]float64, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.scores, a.weights, a.updatedAt = scores, weights, now
+}
+
+func (a *accuracyState) get() ([]AccuracyScore, map[string]map[string]float64, time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.scores, a.weights, a.updatedAt
+}
+
+// consensusWeights returns the weights of the consensus, nil when it is not
+// weighted.
+func consensusWeights() map[string]map[string]float64 {
+	if !settings.weightedConsensus {
+		return nil
+	}
+	_, weights, _ := settings.accuracy.get()
+	return weights
+}
+
+// regionOf names the region of a location after its country code.
+func regionOf(lat, lon float64) string {
+	if settings.ReverseGeocoder != nil {
+		if place, err := settings.ReverseGeocoder.Reverse(lat, lon); err == nil && place.CountryCode != "" {
+			return place.CountryCode
+		}
+	}
+	return unknownRegion
+}
+
+// observeLocation fetches the observations of the past days of unobserved
+// forecasts of a location in tz, at most maxObservationDays from the
+// earliest, and stores them with the verifications of those forecasts. Days
+// the archive does not report once observationDelay old are tried
+// maxObservationAttempts times, then stored as missing.
+func observeLocation(ctx context.Context, records []history.Record, tz string) error {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return err
+	}
+	now := settings.Clock.Now().In(loc)
+	today := now.Format(time.DateOnly)
+	published := now.AddDate(0, 0, -observationDelay).Format(time.DateOnly)
+
+	var dates []string
+	for _, r := range records {
+		if r.Timezone == tz && r.Date < today && !slices.Contains(dates, r.Date) {
+			dates = append(dates, r.Date)
+		}
+	}
+	if len(dates) == 0 {
+		return nil
+	}
+	// records are in date order
+	start, _ := time.Parse(time.DateOnly, dates[0])
+	last := start.AddDate(0, 0, maxObservationDays-1).Format(time.DateOnly)
+	dates = slices.DeleteFunc(dates, func(date string) bool { return date > last })
+	end := dates[len(dates)-1]
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+	lat := strconv.FormatFloat(records[0].Lat, 'f', -1, 64)
+	lon := strconv.FormatFloat(records[0].Lon, 'f', -1, 64)
+	// a refused range counts an attempt for its days, like a missing day
+	days, observeErr := settings.observations.Observations(ctx, lat, lon, loc, dates[0], end)
+	if observeErr != nil && !errors.Is(observeErr, provider.ErrUpstreamStatus) {
+		return fmt.Errorf("failed to observe %s to %s: %w", dates[0], end, observeErr)
+	}
+
+	observation := func(date string) history.Observation {
+		return history.Observation{
+			Source:   settings.observations.Name(),
+			Lat:      records[0].Lat,
+			Lon:      records[0].Lon,
+			Timezone: tz,
+			Date:     date,
+		}
+	}
+	observations := make(map[string]history.Observation, len(days))
+	observed := make([]history.Observation, 0, len(dates))
+	var missed []string
+	for _, date := range dates {
+		values, ok := days[date]
+		if !ok {
+			if date < published {
+				missed = append(missed, date)
+			}
+			continue
+		}
+		o := observation(date)
+		o.Values = values
+		observations[date] = o
+		observed = append(observed, o)
+	}
+
+	if len(missed) > 0 {
+		attempts, err := settings.history.AddAttempts(records[0].Lat, records[0].Lon, tz, missed)
+		if err != nil {
+			return err
+		}
+		for _, date := range missed {
+			if attempts[date] >= maxObservationAttempts {
+				log.Printf("verification: %s at %s not observed after %d attempts, giving up", date, history.LocationKey(records[0].Lat, records[0].Lon), attempts[date])
+				o := observation(date)
+				o.Missing = true
+				observed = append(observed, o)
+			}
+		}
+	}
+	if err := settings.history.AddObservations(observed, verifyRecords(records, observations)); err != nil {
+		return err
+	}
+	if observeErr != nil {
+		return fmt.Errorf("failed to observe %s to %s: %w", dates[0], end, observeErr)
+	}
+	return nil
+}
+
+// byTimezone groups records by timezone, the timezones in the order of their
+// first record, keeping the order of the records of each.
+func byTimezone(records []history.Record) ([]string, map[string][]history.Record) {
+	var timezones []string
+	groups := make(map[string][]history.Record)
+	for _, r := range records {
+		if _, ok := groups[r.Timezone]; !ok {
+			timezones = append(timezones, r.Timezone)
+		}
+		groups[r.Timezone] = append(groups[r.Timezone], r)
+	}
+	return timezones, groups
+}
+
+// verifyRecords returns the errors of the forecasts that have an observation,
+// taking the latest forecast of every provider, day and lead time.
+func verifyRecords(records []history.Record, observations map[string]history.Observation) []history.Verification {
+	type forecastKey struct {
+		provider, date string
+		leadDays       int
+	}
+	latest := make(map[forecastKey]history.Record)
+	for _, r := range records {
+		if o, ok := observations[r.Date]; ok && o.Timezone == r.Timezone {
+			// records are in issue order
+			latest[forecastKey{r.Provider, r.Date, r.LeadDays()}] = r
+		}
+	}
+
+	verifications := make([]history.Verification, 0, len(latest))
+	for key, r := range latest {
+		observed := observations[key.date].Values
+		errors := make(map[string]float64)
+		for variable, value := range forecastVariables {
+			if forecast, actual := value(r.Values), value(observed); forecast != nil && actual != nil {
+				errors[variable] = *forecast - *actual
+			}
+		}
+		verifications = append(verifications, history.Verification{
+			Provider: key.provider,
+			Lat:      r.Lat,
+			Lon:      r.Lon,
+			Timezone: r.Timezone,
+			Date:     key.date,
+			LeadDays: key.leadDays,
+			Errors:   errors,
+		})
+	}
+	return verifications
+}
+
+// sumErrors adds up the verified errors by provider, region, variable and
+// lead time.
+func sumErrors(verifications []history.Verification) map[scoreKey]*errorSum {
+	sums := make(map[scoreKey]*errorSum)
+	regions := make(map[string]string)
+	for _, v := range verifications {
+		location := history.LocationKey(v.Lat, v.Lon)
+		region, ok := regions[location]
+		if !ok {
+			region = regionOf(v.Lat, v.Lon)
+			regions[location] = region
+		}
+		for variable, err := range v.Errors {
+			k := scoreKey{v.Provider, region, variable, v.LeadDays}
+			if sums[k] == nil {
+				sums[k] = &errorSum{}
+			}
+			sums[k].add(err)
+		}
+	}
+	return sums
+}
+
+// scores turns the error sums into scores, with the consensus weights of the
+// providers: for every variable, the inverse of their mean absolute error
+// over all regions and lead times.
+func scores(sums map[scoreKey]*errorSum) ([]AccuracyScore, map[string]map[string]float64) {
+	result := make([]AccuracyScore, 0, len(sums))
+	totals := make(map[[2]string]*errorSum)
+	for k, sum := range sums {
+		n := float64(sum.count)
+		result = append(result, AccuracyScore{
+			Provider: k.provider,
+			Region:   k.region,
+			Variable: k.variable,
+			LeadDays: k.leadDays,
+			Count:    sum.count,
+			MAE:      sum.sumAbs / n,
+			Bias:     sum.sum / n,
+			RMSE:     math.Sqrt(sum.sumSquares / n),
+		})
+
+		total := [2]string{k.provider, k.variable}
+		if totals[total] == nil {
+			totals[total] = &errorSum{}
+		}
+		totals[total].count += sum.count
+		totals[total].sumAbs += sum.sumAbs
+	}
+	slices.SortFunc(result, func(a, b AccuracyScore) int {
+		return cmp.Or(
+			cmp.Compare(a.Provider, b.Provider),
+			cmp.Compare(a.Region, b.Region),
+			cmp.Compare(a.Variable, b.Variable),
+			cmp.Compare(a.LeadDays, b.LeadDays),
+		)
+	})
+
+	weights := make(map[string]map[string]float64)
+	for total, sum := range totals {
+		if sum.count < minWeightSamples {
+			continue
+		}
+		if weights[total[0]] == nil {
+			weights[total[0]] = make(map[string]float64)
+		}
+		weights[total[0]][total[1]] = 1 / max(sum.sumAbs/float64(sum.count), minWeightError)
+	}
+	return result, weights
+}
+
+// verify observes the past days of the forecast history that are not
+// observed yet and scores every provider against all the verifications.
+func verify(ctx context.Context) error {
+	keys, err := settings.history.Locations()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		records, err := settings.history.Unobserved(key)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			continue
+		}
+		// the days of a location are observed in every timezone it was
+		// forecast in
+		timezones, groups := byTimezone(records)
+		for _, tz := range timezones {
+			if err := observeLocation(ctx, groups[tz], tz); err != nil {
+				log.Printf("verification of %s in %s: %v", key, tz, err)
+			}
+		}
+	}
+
+	verifications, err := settings.history.Verifications()
+	if err != nil {
+		return err
+	}
+	result, weights := scores(sumErrors(verifications))
+	settings.accuracy.set(result, weights, settings.Clock.Now().UTC())
+	return nil
+}
+
+// RunVerification verifies the forecast history every interval until ctx is
+// done. It does nothing when the history is disabled.
+func RunVerification(ctx context.Context, interval time.Duration) {
+	if settings.history == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := pruneHistory(); err != nil {
+			log.Printf("history: %v", err)
+		}
+		if err := verify(ctx); err != nil {
+			log.Printf("verification: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetupVerification selects whether the consensus weighs the providers by
+// their accuracy.
+func SetupVerification(weightedConsensus bool) {
+	settings.weightedConsensus = weightedConsensus
+}
+
+// AccuracyHandler serves /accuracy, the scores of the last verification,
+// optionally filtered by the provider, region, variable and lead_days
+// parameters.
+func AccuracyHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	leadDays := -1
+	if value := query.Get("lead_days"); value != "" {
+		var err error
+		if leadDays, err = strconv.Atoi(value); err != nil || leadDays < 0 {
+			http.Error(w, "Invalid lead_days", http.StatusBadRequest)
+			return
+		}
+	}
+
+	all, weights, updatedAt := settings.accuracy.get()
+	report := AccuracyReport{WeightedConsensus: settings.weightedConsensus, Scores: []AccuracyScore{}}
+	if !updatedAt.IsZero() {
+		report.UpdatedAt = &updatedAt
+	}
+	if settings.weightedConsensus {
+		report.Weights = weights
+	}
+	for _, score := range all {
+		if (query.Has("provider") && score.Provider != query.Get("provider")) ||
+			(query.Has("region") && score.Region != query.Get("region")) ||
+			(query.Has("variable") && score.Variable != query.Get("variable")) ||
+			(leadDays >= 0 && score.LeadDays != leadDays) {
+			continue
+		}
+		report.Scores = append(report.Scores, score)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"cycloid/test/history"
+	"cycloid/test/provider"
+)
+
+// mockObservations observes the same temperature every day but the missing
+// ones, and records the requested ranges.
+type mockObservations struct {
+	temperature float64
+	missing     map[string]bool
+	calls       int
+	ranges      []string
+}
+
+func (m *mockObservations) Name() string {
+	return "mock"
+}
+
+func (m *mockObservations) Observations(ctx context.Context, lat, lon string, loc *time.Location, start, end string) (provider.ForecastDay, error) {
+	m.calls++
+	m.ranges = append(m.ranges, start+"/"+end)
+	result := make(provider.ForecastDay)
+	for date := start; date <= end; {
+		if !m.missing[date] {
+			result[date] = provider.ForecastData{Temperature: m.temperature}
+		}
+		t, _ := time.Parse(time.DateOnly, date)
+		date = t.AddDate(0, 0, 1).Format(time.DateOnly)
+	}
+	return result, nil
+}
+
+func TestVerify_Scores(t *testing.T) {
+	defer resetSettings()
+	useHistory(t)
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 5, 12, 0, 0, 0, time.UTC)))
+	observations := &mockObservations{temperature: 20}
+	settings.observations = observations
+	settings.APILimit = 1
+
+	issued := time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)
+	record := func(name string, issuedAt time.Time, date string, temperature float64) history.Record {
+		return history.Record{Provider: name, Lat: 50, Lon: 10, Timezone: "UTC", IssuedAt: issuedAt, Date: date, Values: provider.ForecastData{Temperature: temperature}}
+	}
+	err := settings.history.Add([]history.Record{
+		record("good", issued, "2024-08-02", 21),
+		record("good", issued, "2024-08-03", 19),
+		// a later forecast with the same lead replaces the earlier one
+		record("bad", issued, "2024-08-02", 30),
+		record("bad", issued.Add(time.Hour), "2024-08-02", 24),
+		record("bad", issued.Add(24*time.Hour), "2024-08-03", 26),
+		// not observed yet
+		record("good", issued, "2024-08-05", 40),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := verify(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	scores, _, updatedAt := settings.accuracy.get()
+	if updatedAt.IsZero() {
+		t.Error("expected the update time")
+	}
+	byKey := make(map[string]AccuracyScore)
+	for _, score := range scores {
+		if score.Variable == provider.VariableTemperatureMax {
+			byKey[fmt.Sprintf("%s/%d", score.Provider, score.LeadDays)] = score
+		}
+	}
+	if len(byKey) != 3 {
+		t.Fatalf("expected scores for good at lead 1 and 2 and bad at lead 1, got %+v", scores)
+	}
+	good := byKey["good/1"]
+	if good.Count != 1 || good.MAE != 1 || good.Bias != 1 {
+		t.Errorf("unexpected score: %+v", good)
+	}
+	good2 := byKey["good/2"]
+	if good2.MAE != 1 || good2.Bias != -1 || good2.Region != unknownRegion {
+		t.Errorf("unexpected score: %+v", good2)
+	}
+	// 24 at lead 1 on the 2nd and 26 at lead 1 on the 3rd
+	bad := byKey["bad/1"]
+	if bad.Count != 2 || bad.MAE != 5 || bad.Bias != 5 || math.Abs(bad.RMSE-math.Sqrt(26)) > 1e-9 {
+		t.Errorf("unexpected score: %+v", bad)
+	}
+
+	// the observed days are stored
+	if err := verify(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if observations.calls != 1 {
+		t.Errorf("expected a single observation call, got %d", observations.calls)
+	}
+}
+
+func TestScores_Weights(t *testing.T) {
+	sums := map[scoreKey]*errorSum{
+		{"good", "DE", provider.VariableTemperatureMax, 1}: {count: 6, sumAbs: 3},
+		{"good", "FR", provider.VariableTemperatureMax, 2}: {count: 6, sumAbs: 3},
+		{"rare", "DE", provider.VariableTemperatureMax, 1}: {count: 2, sumAbs: 1},
+	}
+
+	_, weights := scores(sums)
+
+	if got := weights["good"][provider.VariableTemperatureMax]; got != 2 {
+		t.Errorf("expected the inverse of the MAE 0.5, got %v", got)
+	}
+	if _, ok := weights["rare"]; ok {
+		t.Errorf("expected no weight below %d samples, got %v", minWeightSamples, weights["rare"])
+	}
+}
+
+func TestConsensus_Weighted(t *testing.T) {
+	defer resetSettings()
+	settings.weightedConsensus = true
+	settings.accuracy.set(nil, map[string]map[string]float64{
+		"a": {provider.VariableTemperatureMax: 1},
+		"b": {provider.VariableTemperatureMax: 1},
+		"c": {provider.VariableTemperatureMax: 5},
+	}, time.Now())
+
+	wind := 3.0
+	forecast := provider.ProviderForecast{
+		"a": {"2024-08-01": {Temperature: 20, WindSpeed: &wind}},
+		"b": {"2024-08-01": {Temperature: 21}},
+		"c": {"2024-08-01": {Temperature: 30}},
+	}
+
+	day := consensus(forecast)["2024-08-01"]
+	if day.Temperature != 30 {
+		t.Errorf("expected the weighted median 30, got %.1f", day.Temperature)
+	}
+	if day.WindSpeed == nil || *day.WindSpeed != 3 {
+		t.Errorf("expected the unweighted wind speed 3, got %v", day.WindSpeed)
+	}
+
+	// a provider without weight falls back to the median
+	forecast["d"] = provider.ForecastDay{"2024-08-01": {Temperature: 19}}
+	if got := consensus(forecast)["2024-08-01"].Temperature; got != 20.5 {
+		t.Errorf("expected the median 20.5, got %.1f", got)
+	}
+}
+
+func TestWeightedMedian_EvenSplit(t *testing.T) {
+	weights := map[string]map[string]float64{"a": {"v": 2}, "b": {"v": 1}, "c": {"v": 1}}
+	values := []weightedValue{{"b", 30}, {"a", 10}, {"c", 20}}
+	if m := weightedMedian(values, weights, "v"); *m != 15 {
+		t.Errorf("expected 15, got %.1f", *m)
+	}
+	if weightedMedian(nil, weights, "v") != nil {
+		t.Error("expected nil for no values")
+	}
+}
+
+func TestAccuracyHandler_Filters(t *testing.T) {
+	defer resetSettings()
+	settings.accuracy.set([]AccuracyScore{
+		{Provider: "a", Region: "DE", Variable: provider.VariableTemperatureMax, LeadDays: 1, Count: 3},
+		{Provider: "a", Region: "DE", Variable: provider.VariableTemperatureMax, LeadDays: 2, Count: 3},
+		{Provider: "b", Region: "DE", Variable: provider.VariableTemperatureMax, LeadDays: 1, Count: 3},
+	}, nil, time.Date(2024, 8, 5, 0, 0, 0, 0, time.UTC))
+
+	w := httptest.NewRecorder()
+	AccuracyHandler(w, httptest.NewRequest(http.MethodGet, "/accuracy?provider=a&lead_days=2", nil))
+
+	var report AccuracyReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(report.Scores) != 1 || report.Scores[0].LeadDays != 2 || report.UpdatedAt == nil {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	w = httptest.NewRecorder()
+	AccuracyHandler(w, httptest.NewRequest(http.MethodGet, "/accuracy?lead_days=-1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+}
+
+func TestVerify_GivesUpMissingDays(t *testing.T) {
+	defer resetSettings()
+	useHistory(t)
+	clock := provider.NewFakeClock(time.Date(2024, 8, 5, 12, 0, 0, 0, time.UTC))
+	useClock(clock)
+	observations := &mockObservations{temperature: 20, missing: map[string]bool{"2024-06-01": true}}
+	settings.observations = observations
+	settings.APILimit = 1
+
+	issued := time.Date(2024, 5, 30, 6, 0, 0, 0, time.UTC)
+	var records []history.Record
+	for _, date := range []string{"2024-06-01", "2024-06-02", "2024-07-15"} {
+		records = append(records, history.Record{Provider: "mock", Lat: 50, Lon: 10, Timezone: "UTC", IssuedAt: issued, Date: date, Values: provider.ForecastData{Temperature: 21}})
+	}
+	if err := settings.history.Add(records); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for range maxObservationAttempts {
+		if err := verify(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// the range is capped, then the missing day keeps the days after it
+	// until it is given up
+	want := []string{"2024-06-01/2024-06-02", "2024-06-01/2024-06-01", "2024-06-01/2024-06-01", "2024-06-01/2024-06-01"}
+	if !slices.Equal(observations.ranges, want) {
+		t.Errorf("expected the ranges %v, got %v", want, observations.ranges)
+	}
+
+	if err := verify(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last := observations.ranges[len(observations.ranges)-1]; last != "2024-07-15/2024-07-15" {
+		t.Errorf("expected the missing day to be given up, got %s", last)
+	}
+	if unobserved, _ := settings.history.Unobserved(history.LocationKey(50, 10)); len(unobserved) != 0 {
+		t.Errorf("expected every day to be observed or given up, got %+v", unobserved)
+	}
+	scores, _, _ := settings.accuracy.get()
+	var leads []int
+	for _, score := range scores {
+		if score.Variable == provider.VariableTemperatureMax {
+			leads = append(leads, score.LeadDays)
+		}
+	}
+	slices.Sort(leads)
+	// 2024-06-02 and 2024-07-15, not 2024-06-01 at lead 2
+	if !slices.Equal(leads, []int{3, 46}) {
+		t.Errorf("expected the observed days to be verified, got %+v", scores)
+	}
+}
+
+func TestVerify_EveryTimezone(t *testing.T) {
+	defer resetSettings()
+	useHistory(t)
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 5, 12, 0, 0, 0, time.UTC)))
+	observations := &mockObservations{temperature: 20}
+	settings.observations = observations
+	settings.APILimit = 1
+
+	issued := time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)
+	var records []history.Record
+	for _, tz := range []string{"UTC", "Asia/Tokyo"} {
+		records = append(records, history.Record{Provider: "mock", Lat: 50, Lon: 10, Timezone: tz, IssuedAt: issued, Date: "2024-08-02", Values: provider.ForecastData{Temperature: 21}})
+	}
+	if err := settings.history.Add(records); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := verify(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if observations.calls != 2 {
+		t.Errorf("expected the day observed in both timezones, got %d calls", observations.calls)
+	}
+	verifications, err := settings.history.Verifications()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var timezones []string
+	for _, v := range verifications {
+		timezones = append(timezones, v.Timezone)
+	}
+	slices.Sort(timezones)
+	if !slices.Equal(timezones, []string{"Asia/Tokyo", "UTC"}) {
+		t.Errorf("expected a verification in each timezone, got %+v", verifications)
+	}
+	if unobserved, _ := settings.history.Unobserved(history.LocationKey(50, 10)); len(unobserved) != 0 {
+		t.Errorf("expected both days to be observed, got %+v", unobserved)
+	}
+}
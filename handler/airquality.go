@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// airQualityTTL is how long the air quality of a provider is reused for a
+// location; providers update it hourly.
+const airQualityTTL = 15 * time.Minute
+
+// AirQualityResponse is the /airquality response: the air quality of every
+// provider that returned it and their consensus, nil when none did.
+type AirQualityResponse struct {
+	Query       string                         `json:"query,omitempty"`
+	Location    geocoder.Location              `json:"location"`
+	GeneratedAt time.Time                      `json:"generated_at"`
+	Providers   []ProviderResult               `json:"providers"`
+	Attribution []Attribution                  `json:"attribution"`
+	Consensus   *provider.AirQuality           `json:"consensus"`
+	Data        map[string]provider.AirQuality `json:"data"`
+}
+
+// airQualitySource is a provider of a request, or a configured source
+// serving only air quality.
+type airQualitySource interface {
+	Name() string
+}
+
+// airQualitySources returns the providers of a request, then the configured
+// air quality sources.
+func airQualitySources(providers []provider.WeatherProvider) []airQualitySource {
+	sources := make([]airQualitySource, 0, len(providers)+len(settings.airQualitySources))
+	for _, p := range providers {
+		sources = append(sources, p)
+	}
+	for _, source := range settings.airQualitySources {
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// fetchAirQuality returns the air quality of a source, cached for
+// airQualityTTL.
+func fetchAirQuality(ctx context.Context, p airQualitySource, req *weatherRequest) (provider.AirQuality, error) {
+	air, ok := p.(provider.AirQualityProvider)
+	if !ok {
+		return provider.AirQuality{}, fmt.Errorf("%s: air quality %w", p.Name(), errUnsupported)
+	}
+	return fetchCached(ctx, settings.airQuality, circuitKey(p.Name(), apiAirQuality), req, func(ctx context.Context) (provider.AirQuality, error) {
+		return air.GetAirQuality(ctx, req.lat, req.lon, req.loc)
+	})
+}
+
+// airQualityConsensus combines the air quality of several providers: the
+// median of every pollutant, index and pollen count, the categories of the
+// median indexes and the latest observation time.
+func airQualityConsensus(data map[string]provider.AirQuality) *provider.AirQuality {
+	if len(data) == 0 {
+		return nil
+	}
+	var result provider.AirQuality
+	var pm25, pm10, ozone, nitrogenDioxide, usAQI, europeanAQI []float64
+	pollen := make(map[string][]float64)
+	for _, air := range data {
+		pm25 = appendValue(pm25, air.PM25)
+		pm10 = appendValue(pm10, air.PM10)
+		ozone = appendValue(ozone, air.Ozone)
+		nitrogenDioxide = appendValue(nitrogenDioxide, air.NitrogenDioxide)
+		usAQI = appendValue(usAQI, air.USAQI)
+		europeanAQI = appendValue(europeanAQI, air.EuropeanAQI)
+		for plant, count := range air.Pollen {
+			pollen[plant] = append(pollen[plant], count)
+		}
+		if air.ObservedAt.After(result.ObservedAt) {
+			result.ObservedAt = air.ObservedAt
+		}
+	}
+	result.PM25 = median(pm25)
+	result.PM10 = median(pm10)
+	result.Ozone = median(ozone)
+	result.NitrogenDioxide = median(nitrogenDioxide)
+	result.USAQI = median(usAQI)
+	result.EuropeanAQI = median(europeanAQI)
+	if len(pollen) > 0 {
+		result.Pollen = make(map[string]float64, len(pollen))
+		for plant, counts := range pollen {
+			result.Pollen[plant] = *median(counts)
+		}
+	}
+	result.ComputeIndexes()
+	return &result
+}
+
+// AirQualityHandler serves /airquality, the air quality of the providers that
+// report it and of the air quality sources. Providers that do not report it
+// are skipped. It answers 502 Bad Gateway, still with the response, when no
+// provider returned it.
+func AirQualityHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	req, err := resolveWeatherRequest(ctx, queryParams(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	sources := airQualitySources(req.providers)
+	outcomes := callProviders(ctx, sources, func(ctx context.Context, source airQualitySource) (provider.AirQuality, error) {
+		return fetchAirQuality(ctx, source, req)
+	})
+	results, data := collectOutcomes(outcomes, len(sources))
+
+	response := AirQualityResponse{
+		Query:       req.query,
+		Location:    echoLocation(req),
+		GeneratedAt: settings.Clock.Now().UTC(),
+		Providers:   results,
+		Attribution: attributions(sources, data),
+		Consensus:   airQualityConsensus(data),
+		Data:        data,
+	}
+	writeCollected(w, response, len(data) == 0)
+}
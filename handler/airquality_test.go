@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+func TestAirQualityHandler_Consensus(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockAPIProvider{mockProvider: mockProvider{name: "a"}, air: provider.AirQuality{
+			PM25: floatPtr(10), USAQI: floatPtr(53), EuropeanAQI: floatPtr(20), Pollen: map[string]float64{"grass": 12},
+		}},
+		&mockAPIProvider{mockProvider: mockProvider{name: "b"}, air: provider.AirQuality{
+			PM25: floatPtr(30), USAQI: floatPtr(89), EuropeanAQI: floatPtr(64),
+		}},
+		&mockProvider{name: "daily"},
+		&mockAPIProvider{mockProvider: mockProvider{name: "broken", err: errors.New("boom")}},
+	}
+
+	w, response := serveJSON[AirQualityResponse](t, AirQualityHandler, "/airquality?lat=50&lon=10")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	statuses := make([]string, 0, len(response.Providers))
+	for _, result := range response.Providers {
+		statuses = append(statuses, result.Status)
+	}
+	if want := []string{ProviderStatusOK, ProviderStatusOK, ProviderStatusSkipped, ProviderStatusError}; !slices.Equal(statuses, want) {
+		t.Errorf("unexpected statuses %v", statuses)
+	}
+	if len(response.Data) != 2 || len(response.Attribution) != 2 {
+		t.Errorf("expected the data of the 2 providers that succeeded, got %+v", response.Data)
+	}
+
+	consensus := response.Consensus
+	if consensus == nil || *consensus.PM25 != 20 || *consensus.USAQI != 71 || consensus.USCategory != provider.USCategoryModerate {
+		t.Fatalf("unexpected consensus: %+v", consensus)
+	}
+	if *consensus.EuropeanAQI != 42 || consensus.EuropeanCategory != provider.EuropeanCategoryModerate {
+		t.Errorf("unexpected European AQI %v %s", *consensus.EuropeanAQI, consensus.EuropeanCategory)
+	}
+	if consensus.Pollen["grass"] != 12 {
+		t.Errorf("expected the grass pollen of a, got %v", consensus.Pollen)
+	}
+}
+
+func TestAirQualityHandler_Cache(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	clock := provider.NewFakeClock(time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC))
+	useClock(clock)
+
+	p := &mockAPIProvider{mockProvider: mockProvider{name: "a"}, air: provider.AirQuality{PM25: floatPtr(10)}}
+	settings.Providers = []provider.WeatherProvider{p}
+
+	serveJSON[AirQualityResponse](t, AirQualityHandler, "/airquality?lat=50&lon=10")
+	clock.Advance(airQualityTTL - time.Second)
+	serveJSON[AirQualityResponse](t, AirQualityHandler, "/airquality?lat=50&lon=10")
+	if p.calls != 1 {
+		t.Errorf("expected the cached air quality, got %d calls", p.calls)
+	}
+
+	clock.Advance(time.Second)
+	serveJSON[AirQualityResponse](t, AirQualityHandler, "/airquality?lat=50&lon=10")
+	if p.calls != 2 {
+		t.Errorf("expected a call after expiry, got %d calls", p.calls)
+	}
+}
+
+func TestAirQualityHandler_NoneReturned(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "daily"}}
+
+	w, response := serveJSON[AirQualityResponse](t, AirQualityHandler, "/airquality?lat=50&lon=10")
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 Bad Gateway, got %d", w.Code)
+	}
+	if response.Consensus != nil || response.Providers[0].Status != ProviderStatusSkipped {
+		t.Errorf("unexpected response: %+v", response)
+	}
+}
+
+// mockAirQualitySource serves only air quality.
+type mockAirQualitySource struct {
+	name string
+	air  provider.AirQuality
+}
+
+func (m *mockAirQualitySource) Name() string {
+	return m.name
+}
+
+func (m *mockAirQualitySource) GetAirQuality(ctx context.Context, lat, lon string, loc *time.Location) (provider.AirQuality, error) {
+	return m.air, nil
+}
+
+func TestAirQualityHandler_Sources(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "daily"}}
+	settings.airQualitySources = []provider.AirQualityProvider{&mockAirQualitySource{name: "station", air: provider.AirQuality{PM25: floatPtr(12)}}}
+
+	w, response := serveJSON[AirQualityResponse](t, AirQualityHandler, "/airquality?lat=50&lon=10&providers=daily")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if len(response.Providers) != 2 || response.Providers[1].Name != "station" || response.Providers[1].Status != ProviderStatusOK {
+		t.Errorf("expected the source after the providers, got %+v", response.Providers)
+	}
+	if response.Consensus == nil || *response.Consensus.PM25 != 12 {
+		t.Errorf("unexpected consensus: %+v", response.Consensus)
+	}
+	if len(response.Attribution) != 1 || response.Attribution[0].Provider != "station" {
+		t.Errorf("expected the source attributed, got %+v", response.Attribution)
+	}
+}
@@ -0,0 +1,468 @@
+package handler
+
+import (
+	"context"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAlertInterval = 10 * time.Minute
+
+	// defaultAlertHorizon days, today included, are checked when a rule does
+	// not set its horizon.
+	defaultAlertHorizon = 3
+	// maxAlertEvents recent events are kept for GET /alert-events.
+	maxAlertEvents = 200
+)
+
+// alertComparators compare a forecast value with the threshold of a rule.
+var alertComparators = map[string]func(value, threshold float64) bool{
+	"gt":  func(value, threshold float64) bool { return value > threshold },
+	"gte": func(value, threshold float64) bool { return value >= threshold },
+	"lt":  func(value, threshold float64) bool { return value < threshold },
+	"lte": func(value, threshold float64) bool { return value <= threshold },
+}
+
+// AlertRule fires when at least MinAgreement providers forecast Variable
+// compared to Threshold, in Units, on one of the Horizon days starting today.
+// The location and options are those of /weather. Sinks name where the events
+// are delivered, all configured sinks when empty.
+type AlertRule struct {
+	ID           string   `json:"id" yaml:"id"`
+	Name         string   `json:"name,omitempty" yaml:"name"`
+	Q            string   `json:"q,omitempty" yaml:"q"`
+	Lat          *float64 `json:"lat,omitempty" yaml:"lat"`
+	Lon          *float64 `json:"lon,omitempty" yaml:"lon"`
+	Timezone     string   `json:"tz,omitempty" yaml:"tz"`
+	Providers    string   `json:"providers,omitempty" yaml:"providers"`
+	Variable     string   `json:"variable" yaml:"variable"`
+	Comparator   string   `json:"comparator" yaml:"comparator"`
+	Threshold    float64  `json:"threshold" yaml:"threshold"`
+	Units        string   `json:"units,omitempty" yaml:"units"`
+	Horizon      int      `json:"horizon,omitempty" yaml:"horizon"`
+	MinAgreement int      `json:"min_agreement,omitempty" yaml:"min_agreement"`
+	Sinks        []string `json:"sinks,omitempty" yaml:"sinks"`
+}
+
+// AlertsConfig is the alerts section of the config: the named sinks and the
+// rules evaluated from startup.
+type AlertsConfig struct {
+	Sinks map[string]SinkConfig `yaml:"sinks"`
+	Rules []AlertRule           `yaml:"rules"`
+}
+
+// AlertEvent is a rule firing for a day. It fires once while its condition
+// holds, and again only after the condition cleared.
+type AlertEvent struct {
+	ID         string             `json:"id"`
+	RuleID     string             `json:"rule_id"`
+	RuleName   string             `json:"rule_name,omitempty"`
+	Location   geocoder.Location  `json:"location"`
+	Date       string             `json:"date"`
+	Variable   string             `json:"variable"`
+	Comparator string             `json:"comparator"`
+	Threshold  float64            `json:"threshold"`
+	Units      provider.Units     `json:"units"`
+	Agreement  int                `json:"agreement"`
+	Reporting  int                `json:"reporting"`
+	Values     map[string]float64 `json:"values"`
+	Consensus  *float64           `json:"consensus,omitempty"`
+	FiredAt    time.Time          `json:"fired_at"`
+}
+
+// validate checks a rule, filling in its defaults.
+func (rule *AlertRule) validate() error {
+	if rule.Q == "" && (rule.Lat == nil || rule.Lon == nil) {
+		return badRequest("Missing location, expected q or lat and lon")
+	}
+	if _, ok := forecastVariables[rule.Variable]; !ok {
+		return badRequest("Invalid variable " + rule.Variable)
+	}
+	if _, ok := alertComparators[rule.Comparator]; !ok {
+		return badRequest("Invalid comparator, expected gt, gte, lt or lte")
+	}
+	units, err := provider.ParseUnits(rule.Units)
+	if err != nil {
+		return badRequest("Invalid units")
+	}
+	rule.Units = string(units)
+
+	if rule.Horizon == 0 {
+		rule.Horizon = defaultAlertHorizon
+	}
+	if rule.Horizon < 1 || rule.Horizon > provider.FetchDaysCount {
+		return badRequest(fmt.Sprintf("Invalid horizon, expected 1 to %d days", provider.FetchDaysCount))
+	}
+	if rule.MinAgreement == 0 {
+		rule.MinAgreement = 1
+	}
+	if rule.MinAgreement < 1 {
+		return badRequest("Invalid min_agreement")
+	}
+	for _, sink := range rule.Sinks {
+		if _, ok := settings.alertSinks[sink]; !ok {
+			return badRequest("Unknown sink " + sink)
+		}
+	}
+	return nil
+}
+
+func (rule *AlertRule) params() weatherParams {
+	location := BatchLocation{Q: rule.Q, Lat: rule.Lat, Lon: rule.Lon}
+	return location.params(BatchRequest{Units: rule.Units, Timezone: rule.Timezone, Providers: rule.Providers})
+}
+
+type alertRuleState struct {
+	rule AlertRule
+	// active holds the dates the rule fired for and still holds on
+	active map[string]bool
+	// pending holds the deliveries of active dates that some sinks failed
+	pending map[string]alertDelivery
+}
+
+// alertDelivery is an event and the names of the sinks still to send it to.
+type alertDelivery struct {
+	event AlertEvent
+	sinks []string
+}
+
+// alertStore keeps the rules and the recent events in memory.
+type alertStore struct {
+	mu     sync.Mutex
+	rules  map[string]*alertRuleState
+	events []AlertEvent
+}
+
+func newAlertStore() *alertStore {
+	return &alertStore{rules: make(map[string]*alertRuleState)}
+}
+
+func (s *alertStore) add(rule AlertRule) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rules[rule.ID]; ok {
+		return false
+	}
+	s.rules[rule.ID] = &alertRuleState{rule: rule, active: make(map[string]bool), pending: make(map[string]alertDelivery)}
+	return true
+}
+
+func (s *alertStore) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.rules[id]
+	delete(s.rules, id)
+	return ok
+}
+
+func (s *alertStore) get(id string) (AlertRule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.rules[id]
+	if !ok {
+		return AlertRule{}, false
+	}
+	return state.rule, true
+}
+
+// list returns the rules ordered by ID.
+func (s *alertStore) list() []AlertRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]AlertRule, 0, len(s.rules))
+	for _, id := range sortedKeys(s.rules) {
+		result = append(result, s.rules[id].rule)
+	}
+	return result
+}
+
+// fire records the days a rule holds on and returns the deliveries to make:
+// the events of the days it did not hold on at the previous evaluation, to
+// every sink, and those that failed for days it still holds on.
+func (s *alertStore) fire(ruleID string, holding []AlertEvent, sinks []string) []alertDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.rules[ruleID]
+	if !ok {
+		return nil
+	}
+
+	var fired []AlertEvent
+	active := make(map[string]bool, len(holding))
+	for _, event := range holding {
+		active[event.Date] = true
+		if !state.active[event.Date] {
+			fired = append(fired, event)
+			state.pending[event.Date] = alertDelivery{event: event, sinks: sinks}
+		}
+	}
+	state.active = active
+
+	var deliveries []alertDelivery
+	for _, date := range sortedKeys(state.pending) {
+		if !active[date] {
+			delete(state.pending, date)
+			continue
+		}
+		deliveries = append(deliveries, state.pending[date])
+	}
+
+	s.events = append(s.events, fired...)
+	if len(s.events) > maxAlertEvents {
+		s.events = s.events[len(s.events)-maxAlertEvents:]
+	}
+	return deliveries
+}
+
+// delivered records the sinks an event of a rule failed to be sent to, to
+// retry them at the next evaluation.
+func (s *alertStore) delivered(ruleID, date string, failed []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.rules[ruleID]
+	if !ok {
+		return
+	}
+	delivery, ok := state.pending[date]
+	if !ok {
+		return
+	}
+	if len(failed) == 0 {
+		delete(state.pending, date)
+		return
+	}
+	delivery.sinks = failed
+	state.pending[date] = delivery
+}
+
+func (s *alertStore) recentEvents() []AlertEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]AlertEvent{}, s.events...)
+}
+
+// evaluateRule returns an event for every day of the horizon on which enough
+// providers agree with the condition of the rule.
+func evaluateRule(ctx context.Context, rule AlertRule) ([]AlertEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	req, err := resolveWeatherRequest(ctx, rule.params())
+	if err != nil {
+		return nil, err
+	}
+	req.fresh = true
+	_, data := collectForecast(ctx, req)
+	if len(data) == 0 {
+		return nil, errors.New("no provider returned a forecast")
+	}
+
+	variable := forecastVariables[rule.Variable]
+	compare := alertComparators[rule.Comparator]
+	converted := req.units.Convert(data)
+	agreed := req.units.ConvertDays(consensus(data))
+	now := settings.Clock.Now().UTC()
+
+	var events []AlertEvent
+	for _, date := range provider.ForecastDates(settings.Clock, req.loc)[:rule.Horizon] {
+		event := AlertEvent{
+			ID:         rule.ID + "/" + date,
+			RuleID:     rule.ID,
+			RuleName:   rule.Name,
+			Location:   echoLocation(req),
+			Date:       date,
+			Variable:   rule.Variable,
+			Comparator: rule.Comparator,
+			Threshold:  rule.Threshold,
+			Units:      req.units,
+			Values:     make(map[string]float64),
+			FiredAt:    now,
+		}
+		for name, days := range converted {
+			day, ok := days[date]
+			if !ok {
+				continue
+			}
+			value := variable(day)
+			if value == nil {
+				continue
+			}
+			event.Reporting++
+			event.Values[name] = *value
+			if compare(*value, rule.Threshold) {
+				event.Agreement++
+			}
+		}
+		if day, ok := agreed[date]; ok {
+			event.Consensus = variable(day)
+		}
+		if event.Agreement >= rule.MinAgreement {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// sinksOf returns the sinks of a rule, all of them when it names none.
+func sinksOf(rule AlertRule) map[string]AlertSink {
+	if len(rule.Sinks) == 0 {
+		return settings.alertSinks
+	}
+	sinks := make(map[string]AlertSink, len(rule.Sinks))
+	for _, name := range rule.Sinks {
+		if sink, ok := settings.alertSinks[name]; ok {
+			sinks[name] = sink
+		}
+	}
+	return sinks
+}
+
+// runRule evaluates a rule and sends its new events to its sinks, retrying
+// the sinks that failed while the rule still holds.
+func runRule(ctx context.Context, rule AlertRule) error {
+	holding, err := evaluateRule(ctx, rule)
+	if err != nil {
+		return err
+	}
+	sinks := sinksOf(rule)
+	var errs []error
+	for _, delivery := range settings.alerts.fire(rule.ID, holding, sortedKeys(sinks)) {
+		var failed []string
+		for _, name := range delivery.sinks {
+			sink, ok := sinks[name]
+			if !ok {
+				continue
+			}
+			if err := sink.Send(ctx, delivery.event); err != nil {
+				failed = append(failed, name)
+				errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+			}
+		}
+		settings.alerts.delivered(rule.ID, delivery.event.Date, failed)
+	}
+	return errors.Join(errs...)
+}
+
+// evaluateAlerts runs every rule, batchConcurrency at a time.
+func evaluateAlerts(ctx context.Context) {
+	rules := settings.alerts.list()
+	for done := range runBatch(ctx, len(rules), func(ctx context.Context, i int) error {
+		return runRule(ctx, rules[i])
+	}) {
+		if done.value != nil {
+			log.Printf("alert rule %s: %v", rules[done.index].ID, done.value)
+		}
+	}
+}
+
+// RunAlerts evaluates the alert rules every interval until ctx is done.
+func RunAlerts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		evaluateAlerts(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetupAlerts configures the alert sinks and the rules of the config. Without
+// sinks, alerts are logged.
+func SetupAlerts(config AlertsConfig) error {
+	sinks := make(map[string]AlertSink)
+	for name, sinkConfig := range config.Sinks {
+		sink, err := newAlertSink(sinkConfig)
+		if err != nil {
+			return fmt.Errorf("alert sink %s: %w", name, err)
+		}
+		sinks[name] = sink
+	}
+	if len(sinks) == 0 {
+		sinks["log"] = logSink{}
+	}
+	settings.alertSinks = sinks
+
+	for i, rule := range config.Rules {
+		if rule.ID == "" {
+			rule.ID = fmt.Sprintf("rule-%d", i+1)
+		}
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("alert rule %s: %w", rule.ID, err)
+		}
+		if !settings.alerts.add(rule) {
+			return fmt.Errorf("alert rule %s: duplicate id", rule.ID)
+		}
+	}
+	return nil
+}
+
+// CreateAlertRuleHandler serves POST /alert-rules. The location is checked
+// by resolving it once.
+func CreateAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var rule AlertRule
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubscriptionBodySize)).Decode(&rule); err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.ID = randomID(8)
+	if err := rule.validate(); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+	if _, err := resolveWeatherRequest(ctx, rule.params()); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	settings.alerts.add(rule)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/alert-rules/"+rule.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// ListAlertRulesHandler serves GET /alert-rules.
+func ListAlertRulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings.alerts.list())
+}
+
+// GetAlertRuleHandler serves GET /alert-rules/{id}.
+func GetAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule, ok := settings.alerts.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Alert rule not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// DeleteAlertRuleHandler serves DELETE /alert-rules/{id}.
+func DeleteAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if !settings.alerts.remove(r.PathValue("id")) {
+		http.Error(w, "Alert rule not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AlertEventsHandler serves GET /alert-events, the latest events, oldest first.
+func AlertEventsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings.alerts.recentEvents())
+}
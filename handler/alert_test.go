@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+// recordingSink keeps the events it is sent, or fails with err.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []AlertEvent
+	err    error
+}
+
+func (s *recordingSink) Send(ctx context.Context, event AlertEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestRunRule_AgreementAndDeduplication(t *testing.T) {
+	defer resetSettings()
+
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)))
+	hot := &mockProvider{name: "hot", data: provider.ForecastDay{"2024-08-01": {Temperature: 36}, "2024-08-02": {Temperature: 37}, "2024-08-04": {Temperature: 40}}}
+	mild := &mockProvider{name: "mild", data: provider.ForecastDay{"2024-08-01": {Temperature: 30}, "2024-08-02": {Temperature: 36}, "2024-08-04": {Temperature: 40}}}
+	settings.Providers = []provider.WeatherProvider{hot, mild}
+	settings.APILimit = 1
+	sink := &recordingSink{}
+	settings.alertSinks = map[string]AlertSink{"test": sink}
+
+	rule := AlertRule{ID: "heat", Lat: floatPtr(50), Lon: floatPtr(10), Timezone: "UTC", Variable: provider.VariableTemperatureMax, Comparator: "gt", Threshold: 35, MinAgreement: 2}
+	if err := rule.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	settings.alerts.add(rule)
+
+	if err := runRule(context.Background(), rule); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// only the 2nd has both providers above 35, the 4th is past the horizon of 3 days
+	if len(sink.events) != 1 || sink.events[0].Date != "2024-08-02" {
+		t.Fatalf("expected an event for 2024-08-02, got %+v", sink.events)
+	}
+	event := sink.events[0]
+	if event.Agreement != 2 || event.Reporting != 2 || event.Values["hot"] != 37 || *event.Consensus != 36.5 {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	// still holding: not sent again
+	runRule(context.Background(), rule)
+	if len(sink.events) != 1 {
+		t.Fatalf("expected no new event, got %d", len(sink.events))
+	}
+
+	// cleared, then holding again
+	mild.data = provider.ForecastDay{"2024-08-02": {Temperature: 30}}
+	runRule(context.Background(), rule)
+	mild.data = provider.ForecastDay{"2024-08-02": {Temperature: 36}}
+	runRule(context.Background(), rule)
+	if len(sink.events) != 2 {
+		t.Fatalf("expected the event again after it cleared, got %d", len(sink.events))
+	}
+
+	if events := settings.alerts.recentEvents(); len(events) != 2 {
+		t.Errorf("expected 2 recent events, got %d", len(events))
+	}
+}
+
+func TestSetupAlerts(t *testing.T) {
+	defer resetSettings()
+
+	err := SetupAlerts(AlertsConfig{
+		Sinks: map[string]SinkConfig{"ops": {Type: "email", From: "weather@example.com", To: []string{"ops@example.com"}}},
+		Rules: []AlertRule{{Name: "frost", Q: "Berlin,DE", Variable: provider.VariableTemperatureMin, Comparator: "lte", Sinks: []string{"ops"}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rule, ok := settings.alerts.get("rule-1")
+	if !ok || rule.Horizon != defaultAlertHorizon || rule.MinAgreement != 1 || rule.Units != string(provider.UnitsMetric) {
+		t.Errorf("expected the rule with its defaults, got %+v", rule)
+	}
+	if sink, ok := settings.alertSinks["ops"].(emailSink); !ok || sink.addr != "localhost:25" {
+		t.Errorf("unexpected sink: %+v", settings.alertSinks["ops"])
+	}
+}
+
+func TestSetupAlerts_Invalid(t *testing.T) {
+	defer resetSettings()
+
+	for name, config := range map[string]AlertsConfig{
+		"sink type":  {Sinks: map[string]SinkConfig{"x": {Type: "pager"}}},
+		"webhook":    {Sinks: map[string]SinkConfig{"x": {Type: "webhook"}}},
+		"comparator": {Rules: []AlertRule{{Q: "Berlin", Variable: provider.VariablePressure, Comparator: "eq"}}},
+		"sink":       {Rules: []AlertRule{{Q: "Berlin", Variable: provider.VariablePressure, Comparator: "lt", Sinks: []string{"missing"}}}},
+		"location":   {Rules: []AlertRule{{Lat: floatPtr(50), Variable: provider.VariablePressure, Comparator: "lt"}}},
+		"horizon":    {Rules: []AlertRule{{Q: "Berlin", Variable: provider.VariablePressure, Comparator: "lt", Horizon: provider.FetchDaysCount + 1}}},
+	} {
+		settings.alerts = newAlertStore()
+		if err := SetupAlerts(config); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCreateAlertRuleHandler(t *testing.T) {
+	defer resetSettings()
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "mock"}}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodPost, "/alert-rules", strings.NewReader(`{"lat": 50, "lon": 10, "variable": "wind_speed", "comparator": "between"}`))
+	w := httptest.NewRecorder()
+	CreateAlertRuleHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/alert-rules", strings.NewReader(`{"lat": 50, "lon": 10, "variable": "wind_speed", "comparator": "gte", "threshold": 15}`))
+	w = httptest.NewRecorder()
+	CreateAlertRuleHandler(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d: %s", w.Code, w.Body)
+	}
+	if rules := settings.alerts.list(); len(rules) != 1 || w.Header().Get("Location") != "/alert-rules/"+rules[0].ID {
+		t.Errorf("unexpected rules %+v at %q", rules, w.Header().Get("Location"))
+	}
+}
+
+// smtpRelay accepts one mail on a local port, answering every command, and
+// sends the address and message it received once done.
+func smtpRelay(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r, w := bufio.NewReader(conn), conn
+		w.Write([]byte("220 relay ready\r\n"))
+		var message strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line + " ")[0]); command {
+			case "DATA":
+				w.Write([]byte("354 go ahead\r\n"))
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					message.WriteString(line)
+				}
+				w.Write([]byte("250 queued\r\n"))
+			case "QUIT":
+				w.Write([]byte("221 bye\r\n"))
+				received <- message.String()
+				return
+			default:
+				w.Write([]byte("250 ok\r\n"))
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestEmailSink(t *testing.T) {
+	addr, received := smtpRelay(t)
+	sink := emailSink{addr: addr, from: "weather@example.com", to: []string{"ops@example.com"}}
+
+	event := AlertEvent{RuleID: "frost", Date: "2024-08-01", Variable: provider.VariableTemperatureMin, Comparator: "lt", Threshold: 0, Units: provider.UnitsMetric, Agreement: 2, Reporting: 3}
+	event.Location.Name = "Berlin"
+	if err := sink.Send(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	message := <-received
+	if !strings.Contains(message, "Subject: =?utf-8?q?Weather_alert_frost") || !strings.Contains(message, "\r\n\r\nfrost: temperature_min lt 0 °C on 2024-08-01 at Berlin (2 of 3 providers)\r\n") {
+		t.Errorf("unexpected message:\n%s", message)
+	}
+}
+
+func TestEmailSink_ContextDeadline(t *testing.T) {
+	// a relay that accepts the connection and never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	sink := emailSink{addr: listener.Addr().String(), from: "weather@example.com", to: []string{"ops@example.com"}}
+	start := time.Now()
+	if err := sink.Send(ctx, AlertEvent{RuleID: "frost"}); err == nil {
+		t.Fatal("expected the send to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the send to stop at the deadline, took %s", elapsed)
+	}
+}
+
+func TestRunRule_RetriesFailedSinks(t *testing.T) {
+	defer resetSettings()
+
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)))
+	hot := &mockProvider{name: "hot", data: provider.ForecastDay{"2024-08-01": {Temperature: 36}}}
+	settings.Providers = []provider.WeatherProvider{hot}
+	settings.APILimit = 1
+	ok, down := &recordingSink{}, &recordingSink{err: errors.New("relay down")}
+	settings.alertSinks = map[string]AlertSink{"ok": ok, "down": down}
+
+	rule := AlertRule{ID: "heat", Lat: floatPtr(50), Lon: floatPtr(10), Timezone: "UTC", Variable: provider.VariableTemperatureMax, Comparator: "gt", Threshold: 35}
+	if err := rule.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	settings.alerts.add(rule)
+
+	if err := runRule(context.Background(), rule); err == nil || !strings.Contains(err.Error(), "sink down") {
+		t.Fatalf("expected the failure of the down sink, got %v", err)
+	}
+
+	// the failed sink is retried, the other one is not sent the event again
+	down.err = nil
+	if err := runRule(context.Background(), rule); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ok.events) != 1 || len(down.events) != 1 {
+		t.Fatalf("expected one event per sink, got %d and %d", len(ok.events), len(down.events))
+	}
+
+	// delivered: not sent again
+	runRule(context.Background(), rule)
+	if len(ok.events) != 1 || len(down.events) != 1 {
+		t.Errorf("expected no new event, got %d and %d", len(ok.events), len(down.events))
+	}
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultBatchLimit   = 200
+	DefaultBatchTimeout = 2 * time.Minute
+
+	// batchConcurrency locations of a batch are resolved and fetched at a time.
+	batchConcurrency = 8
+	maxBatchBodySize = 1 << 20
+
+	// maxLocationNameLength is the maximum length in characters of the name of
+	// a batch location, which is echoed in every row of the results.
+	maxLocationNameLength = 100
+)
+
+// BatchLocation is a named location of a batch, given either by coordinates
+// or by a place query.
+type BatchLocation struct {
+	Name string   `json:"name"`
+	Q    string   `json:"q,omitempty"`
+	Lat  *float64 `json:"lat,omitempty"`
+	Lon  *float64 `json:"lon,omitempty"`
+}
+
+// BatchRequest is the body of POST /weather/batch. Units, Timezone and
+// Providers apply to every location, like the /weather query parameters.
+type BatchRequest struct {
+	Locations []BatchLocation `json:"locations"`
+	Units     string          `json:"units,omitempty"`
+	Timezone  string          `json:"tz,omitempty"`
+	Providers string          `json:"providers,omitempty"`
+}
+
+// BatchResult is the outcome for one location: the forecast, or the status
+// and error /weather would have answered.
+type BatchResult struct {
+	Name     string                    `json:"name"`
+	Status   int                       `json:"status"`
+	Location *geocoder.Location        `json:"location,omitempty"`
+	Timezone string                    `json:"timezone,omitempty"`
+	Forecast provider.ProviderForecast `json:"forecast,omitempty"`
+	// Skipped are the providers left out because their circuit is open.
+	Skipped    []string            `json:"skipped,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	Candidates []geocoder.Location `json:"candidates,omitempty"`
+
+	// point is the latitude and longitude of a resolved location.
+	point *[2]float64
+}
+
+type BatchResponse struct {
+	Units   provider.UnitLabels `json:"units"`
+	Results []BatchResult       `json:"results"`
+}
+
+// validateLocationName rejects names of batch locations that are too long or
+// contain control characters, which could break the CSV rows.
+func validateLocationName(name string) error {
+	if utf8.RuneCountInString(name) > maxLocationNameLength {
+		return fmt.Errorf("location name longer than %d characters", maxLocationNameLength)
+	}
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		return errors.New("location name with control characters")
+	}
+	return nil
+}
+
+func (l BatchLocation) params(batch BatchRequest) weatherParams {
+	params := weatherParams{
+		Query:     l.Q,
+		Timezone:  batch.Timezone,
+		Units:     batch.Units,
+		Providers: batch.Providers,
+	}
+	if l.Lat != nil {
+		params.Lat = strconv.FormatFloat(*l.Lat, 'f', -1, 64)
+	}
+	if l.Lon != nil {
+		params.Lon = strconv.FormatFloat(*l.Lon, 'f', -1, 64)
+	}
+	return params
+}
+
+// forecastLocation resolves and fetches one location of a batch, with its own
+// APILimit timeout.
+func forecastLocation(ctx context.Context, batch BatchRequest, l BatchLocation) BatchResult {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	result := BatchResult{Name: l.Name}
+
+	req, err := resolveWeatherRequest(ctx, l.params(batch))
+	if err != nil {
+		result.Status, result.Error = statusOf(err), err.Error()
+		var re *requestError
+		if errors.As(err, &re) {
+			result.Candidates = re.candidates
+		}
+		return result
+	}
+
+	data, skipped, err := aggregateForecast(ctx, req.lat, req.lon, req.loc, req.providers)
+	result.Skipped = skipped
+	if err != nil {
+		result.Status, result.Error = statusOf(err), "Failed to aggregate forecast: "+err.Error()
+		return result
+	}
+
+	result.Status = http.StatusOK
+	result.point = &[2]float64{req.latf, req.lonf}
+	result.Location = req.location
+	result.Timezone = req.loc.String()
+	result.Forecast = req.units.Convert(data)
+	return result
+}
+
+type indexed[T any] struct {
+	index int
+	value T
+}
+
+// runBatch calls fn for the n items of a batch, batchConcurrency at a time,
+// sending the values with their index as they complete. The channel is closed
+// once every item is done and must be drained.
+func runBatch[T any](ctx context.Context, n int, fn func(ctx context.Context, i int) T) <-chan indexed[T] {
+	out := make(chan indexed[T])
+	go func() {
+		defer close(out)
+		slots := make(chan struct{}, batchConcurrency)
+
+		var wg sync.WaitGroup
+		for i := range n {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				out <- indexed[T]{i, fn(ctx, i)}
+			}()
+		}
+		wg.Wait()
+	}()
+	return out
+}
+
+func forecastBatch(ctx context.Context, batch BatchRequest) <-chan indexed[BatchResult] {
+	return runBatch(ctx, len(batch.Locations), func(ctx context.Context, i int) BatchResult {
+		return forecastLocation(ctx, batch, batch.Locations[i])
+	})
+}
+
+// BatchHandler serves POST /weather/batch, answering 200 with a result per
+// location, whether each succeeded or not. JSON results and GeoJSON features
+// are in request order; CSV and NDJSON rows are streamed as the locations
+// complete.
+func BatchHandler(w http.ResponseWriter, r *http.Request) {
+	format, err := negotiateFormat(r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	var batch BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBodySize)).Decode(&batch); err != nil {
+		http.Error(w, "Invalid batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(batch.Locations) == 0 {
+		http.Error(w, "Invalid batch: no locations", http.StatusBadRequest)
+		return
+	}
+	if len(batch.Locations) > settings.BatchLimit {
+		http.Error(w, fmt.Sprintf("Too many locations: the limit is %d", settings.BatchLimit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	for i, l := range batch.Locations {
+		if err := validateLocationName(l.Name); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid batch: location %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+	units, err := provider.ParseUnits(batch.Units)
+	if err != nil {
+		http.Error(w, "Invalid units", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("X-Units", string(units))
+
+	ctx, cancel := context.WithTimeout(r.Context(), settings.BatchTimeout)
+	defer cancel()
+
+	if format == formatCSV || format == formatNDJSON {
+		rows := newRowWriter(w, format, true)
+		rows.flush()
+		for done := range forecastBatch(ctx, batch) {
+			rows.write(batchRows(done.value))
+			rows.flush()
+		}
+		return
+	}
+
+	results := make([]BatchResult, len(batch.Locations))
+	for done := range forecastBatch(ctx, batch) {
+		results[done.index] = done.value
+	}
+
+	if format == formatGeoJSON {
+		features := make([]Feature, len(results))
+		for i, result := range results {
+			features[i] = batchFeature(result, units)
+		}
+		w.Header().Set("Content-Type", formatContentTypes[formatGeoJSON])
+		json.NewEncoder(w).Encode(newFeatureCollection(features...))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchResponse{Units: units.Labels(), Results: results})
+}
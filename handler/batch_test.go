@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+)
+
+func postBatch(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/weather/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	BatchHandler(w, req)
+	return w
+}
+
+func TestBatchHandler_Success(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "goodProvider", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+	}
+	settings.APILimit = 1
+	settings.Geocoder = &mockGeocoder{locations: []geocoder.Location{berlin}}
+
+	w := postBatch(t, `{
+		"units": "imperial",
+		"locations": [
+			{"name": "site-1", "lat": 50, "lon": 10},
+			{"name": "hq", "q": "Berlin"},
+			{"name": "broken", "lat": 500, "lon": 10}
+		]
+	}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+
+	var result BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	if result.Units.Temperature != "°F" || len(result.Results) != 3 {
+		t.Fatalf("unexpected response: %+v", result)
+	}
+	if site := result.Results[0]; site.Name != "site-1" || site.Status != http.StatusOK || site.Forecast["goodProvider"]["2024-08-01"].Temperature != 68.0 {
+		t.Errorf("unexpected result for site-1: %+v", site)
+	}
+	if hq := result.Results[1]; hq.Status != http.StatusOK || hq.Location == nil || hq.Location.Name != "Berlin" || hq.Timezone != "Europe/Berlin" {
+		t.Errorf("unexpected result for hq: %+v", hq)
+	}
+	if broken := result.Results[2]; broken.Status != http.StatusBadRequest || broken.Error != "Invalid latitude" || broken.Forecast != nil {
+		t.Errorf("unexpected result for broken: %+v", broken)
+	}
+}
+
+func TestBatchHandler_ProviderError(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "badProvider", err: errors.New("provider failure")},
+	}
+	settings.APILimit = 1
+
+	w := postBatch(t, `{"locations": [{"name": "site-1", "lat": 50, "lon": 10}]}`)
+
+	var result BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if site := result.Results[0]; site.Status != http.StatusInternalServerError || !strings.Contains(site.Error, "provider failure") {
+		t.Errorf("unexpected result: %+v", site)
+	}
+}
+
+func TestBatchHandler_Ambiguous(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "goodProvider"}}
+	settings.APILimit = 1
+	settings.Geocoder = &mockGeocoder{locations: []geocoder.Location{berlin, {Name: "Berlin", CountryCode: "US"}}}
+
+	w := postBatch(t, `{"locations": [{"name": "hq", "q": "Berlin"}]}`)
+
+	var result BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if hq := result.Results[0]; hq.Status != http.StatusMultipleChoices || len(hq.Candidates) != 2 {
+		t.Errorf("unexpected result: %+v", hq)
+	}
+}
+
+func TestBatchHandler_TooManyLocations(t *testing.T) {
+	defer resetSettings()
+
+	SetupBatch(2, DefaultBatchTimeout)
+
+	w := postBatch(t, `{"locations": [{"name": "a"}, {"name": "b"}, {"name": "c"}]}`)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", w.Code)
+	}
+}
+
+func TestBatchHandler_InvalidBody(t *testing.T) {
+	defer resetSettings()
+
+	for _, body := range []string{`{invalid`, `{"locations": []}`, `{"locations": [{"name": "a"}], "units": "kelvin"}`} {
+		if w := postBatch(t, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestBatchHandler_InvalidName(t *testing.T) {
+	defer resetSettings()
+
+	for _, name := range []string{strings.Repeat("a", maxLocationNameLength+1), `site\n1`, `site\u00001`} {
+		if w := postBatch(t, `{"locations": [{"name": "`+name+`", "lat": 50, "lon": 10}]}`); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestBatchHandler_SharesForecastCache(t *testing.T) {
+	defer resetSettings()
+
+	mock := &mockProvider{name: "goodProvider", data: forecastWindow(20)}
+	settings.Providers = []provider.WeatherProvider{mock}
+	settings.APILimit = 1
+
+	w := postBatch(t, `{"locations": [{"name": "a", "lat": 50, "lon": 10}, {"name": "b", "lat": 50.001, "lon": 10.001}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=50&lon=10", nil)
+	WeatherHandler(httptest.NewRecorder(), req)
+
+	if mock.calls != 1 {
+		t.Errorf("expected a single provider call, got %d", mock.calls)
+	}
+}
+
+func TestBatchHandler_Deadline(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "slowProvider", timeout: time.Second}}
+	settings.APILimit = 5
+	SetupBatch(2, 50*time.Millisecond)
+
+	start := time.Now()
+	w := postBatch(t, `{"locations": [{"name": "a", "lat": 50, "lon": 10}, {"name": "b", "lat": 40, "lon": 20}]}`)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the batch to end at its deadline, took %v", elapsed)
+	}
+
+	var result BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	for _, site := range result.Results {
+		if site.Status != http.StatusGatewayTimeout {
+			t.Errorf("expected 504 for %s, got %+v", site.Name, site)
+		}
+	}
+}
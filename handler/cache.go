@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type cachedValue[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// ttlCache keeps the values of every provider and location for its ttl.
+// Locations are rounded to 0.01°, about a kilometre.
+type ttlCache[T any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedValue[T]
+}
+
+func newTTLCache[T any](ttl time.Duration) *ttlCache[T] {
+	return &ttlCache[T]{ttl: ttl, entries: make(map[string]cachedValue[T])}
+}
+
+func pointKey(name string, lat, lon float64) string {
+	return fmt.Sprintf("%s/%.2f,%.2f", name, lat, lon)
+}
+
+func (c *ttlCache[T]) get(key string, now time.Time) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *ttlCache[T]) put(key string, value T, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedValue[T]{value: value, expires: now.Add(c.ttl)}
+}
+
+// fetchCached returns the value of a provider API for the location of req
+// from cache, or calls fetch when the circuit of the API allows it, caching
+// the value on success.
+func fetchCached[T any](ctx context.Context, cache *ttlCache[T], circuit string, req *weatherRequest, fetch func(context.Context) (T, error)) (T, error) {
+	var zero T
+	key := pointKey(circuit, req.latf, req.lonf)
+	if value, ok := cache.get(key, settings.Clock.Now()); ok {
+		return value, nil
+	}
+
+	if !settings.health.allow(circuit) {
+		return zero, fmt.Errorf("%s: %w", circuit, errCircuitOpen)
+	}
+	value, err := fetch(ctx)
+	settings.health.finish(circuit, err)
+	if err != nil {
+		return zero, err
+	}
+	cache.put(key, value, settings.Clock.Now())
+	return value, nil
+}
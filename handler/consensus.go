@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"cmp"
+	"cycloid/test/provider"
+	"slices"
+)
+
+// consensusVariables are the variables of the consensus, in the order of the
+// series built by consensus.
+var consensusVariables = []string{
+	provider.VariableTemperatureMax,
+	provider.VariableTemperatureMin,
+	provider.VariableWindSpeed,
+	provider.VariablePrecipitation,
+	provider.VariablePressure,
+}
+
+// weightedValue is the value of a provider for a day and variable.
+type weightedValue struct {
+	provider string
+	value    float64
+}
+
+// consensus combines the forecasts of several providers into one, taking for
+// every day and variable the median of the values the providers report. With
+// accuracy weights for every provider reporting a variable, the median is
+// weighted.
+func consensus(forecast provider.ProviderForecast) provider.ForecastDay {
+	values := make(map[string][][]weightedValue)
+	for name, days := range forecast {
+		for date, day := range days {
+			if values[date] == nil {
+				values[date] = make([][]weightedValue, len(consensusVariables))
+			}
+			series := values[date]
+			for i, variable := range consensusVariables {
+				if value := forecastVariables[variable](day); value != nil {
+					series[i] = append(series[i], weightedValue{name, *value})
+				}
+			}
+		}
+	}
+
+	weights := consensusWeights()
+	result := make(provider.ForecastDay, len(values))
+	for date, series := range values {
+		medians := make([]*float64, len(series))
+		for i, s := range series {
+			medians[i] = weightedMedian(s, weights, consensusVariables[i])
+		}
+		result[date] = provider.ForecastData{
+			Temperature:    *medians[0],
+			TemperatureMin: medians[1],
+			WindSpeed:      medians[2],
+			Precipitation:  medians[3],
+			Pressure:       medians[4],
+		}
+	}
+	return result
+}
+
+// weightedMedian returns the median of values weighted by the weights of
+// their providers for variable, or the plain median when a provider has no
+// weight. It is nil when there are no values.
+func weightedMedian(values []weightedValue, weights map[string]map[string]float64, variable string) *float64 {
+	plain := make([]float64, len(values))
+	for i, v := range values {
+		plain[i] = v.value
+	}
+	for _, v := range values {
+		if _, ok := weights[v.provider][variable]; !ok {
+			return median(plain)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	slices.SortFunc(values, func(a, b weightedValue) int {
+		return cmp.Compare(a.value, b.value)
+	})
+	total := 0.0
+	for _, v := range values {
+		total += weights[v.provider][variable]
+	}
+	cumulative := 0.0
+	for i, v := range values {
+		cumulative += weights[v.provider][variable]
+		if cumulative > total/2 {
+			return &v.value
+		}
+		// exactly half the weight on each side, like an even plain median
+		if cumulative == total/2 && i+1 < len(values) {
+			m := (v.value + values[i+1].value) / 2
+			return &m
+		}
+	}
+	return &values[len(values)-1].value
+}
+
+// median returns the median of values, nil when there are none.
+func median(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	slices.Sort(values)
+	m := values[len(values)/2]
+	if len(values)%2 == 0 {
+		m = (values[len(values)/2-1] + m) / 2
+	}
+	return &m
+}
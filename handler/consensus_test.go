@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"testing"
+
+	"cycloid/test/provider"
+)
+
+func TestConsensus_Median(t *testing.T) {
+	wind := []float64{2, 4, 9}
+	forecast := provider.ProviderForecast{
+		"a": {"2024-08-01": {Temperature: 20, WindSpeed: &wind[0]}},
+		"b": {"2024-08-01": {Temperature: 30, WindSpeed: &wind[1]}, "2024-08-02": {Temperature: 15}},
+		"c": {"2024-08-01": {Temperature: 21, WindSpeed: &wind[2]}},
+	}
+
+	result := consensus(forecast)
+
+	day := result["2024-08-01"]
+	if day.Temperature != 21 {
+		t.Errorf("expected median temperature 21, got %.1f", day.Temperature)
+	}
+	if day.WindSpeed == nil || *day.WindSpeed != 4 {
+		t.Errorf("expected median wind speed 4, got %v", day.WindSpeed)
+	}
+	if day.Pressure != nil {
+		t.Errorf("expected no pressure when no provider reports it, got %v", *day.Pressure)
+	}
+	if result["2024-08-02"].Temperature != 15 {
+		t.Errorf("expected single provider value for 2024-08-02, got %+v", result["2024-08-02"])
+	}
+}
+
+func TestMedian_Even(t *testing.T) {
+	if m := median([]float64{4, 1, 3, 2}); *m != 2.5 {
+		t.Errorf("expected 2.5, got %.2f", *m)
+	}
+	if median(nil) != nil {
+		t.Error("expected nil for no values")
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// currentTTL is how long the current conditions of a provider are reused for
+// a location.
+const currentTTL = 5 * time.Minute
+
+// CurrentResponse is the /weather/current response: the current conditions
+// of every provider that returned them and their consensus, nil when none did.
+type CurrentResponse struct {
+	Query       string                                `json:"query,omitempty"`
+	Location    geocoder.Location                     `json:"location"`
+	Units       provider.UnitLabels                   `json:"units"`
+	GeneratedAt time.Time                             `json:"generated_at"`
+	Providers   []ProviderResult                      `json:"providers"`
+	Attribution []Attribution                         `json:"attribution"`
+	Consensus   *provider.CurrentConditions           `json:"consensus"`
+	Data        map[string]provider.CurrentConditions `json:"data"`
+}
+
+// fetchCurrent returns the current conditions of a provider, cached for
+// currentTTL.
+func fetchCurrent(ctx context.Context, p provider.WeatherProvider, req *weatherRequest) (provider.CurrentConditions, error) {
+	current, ok := p.(provider.CurrentProvider)
+	if !ok {
+		return provider.CurrentConditions{}, fmt.Errorf("%s: current conditions %w", p.Name(), errUnsupported)
+	}
+	return fetchCached(ctx, settings.current, circuitKey(p.Name(), apiCurrent), req, func(ctx context.Context) (provider.CurrentConditions, error) {
+		return current.GetCurrent(ctx, req.lat, req.lon, req.loc)
+	})
+}
+
+// currentConsensus combines the current conditions of several providers: the
+// median of every variable, the most reported condition, the first provider's
+// on a tie, and the latest observation time.
+func currentConsensus(names []string, data map[string]provider.CurrentConditions) *provider.CurrentConditions {
+	if len(data) == 0 {
+		return nil
+	}
+	var result provider.CurrentConditions
+	var temperature, feelsLike, windSpeed, humidity, pressure []float64
+	votes := make(map[string]int)
+	for _, name := range names {
+		current, ok := data[name]
+		if !ok {
+			continue
+		}
+		temperature = append(temperature, current.Temperature)
+		feelsLike = appendValue(feelsLike, current.FeelsLike)
+		windSpeed = appendValue(windSpeed, current.WindSpeed)
+		humidity = appendValue(humidity, current.Humidity)
+		pressure = appendValue(pressure, current.Pressure)
+		if current.ObservedAt.After(result.ObservedAt) {
+			result.ObservedAt = current.ObservedAt
+		}
+		if current.Condition != "" {
+			votes[current.Condition]++
+			if result.Condition == "" || votes[current.Condition] > votes[result.Condition] {
+				result.Condition = current.Condition
+			}
+		}
+	}
+	result.Temperature = *median(temperature)
+	result.FeelsLike = median(feelsLike)
+	result.WindSpeed = median(windSpeed)
+	result.Humidity = median(humidity)
+	result.Pressure = median(pressure)
+	return &result
+}
+
+func appendValue(values []float64, value *float64) []float64 {
+	if value == nil {
+		return values
+	}
+	return append(values, *value)
+}
+
+// CurrentHandler serves /weather/current, the current conditions of the
+// providers that report them. Providers that do not are reported as skipped.
+// It answers 502 Bad Gateway, still with the response, when no provider
+// returned them.
+func CurrentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	req, err := resolveWeatherRequest(ctx, queryParams(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	outcomes := callProviders(ctx, req.providers, func(ctx context.Context, p provider.WeatherProvider) (provider.CurrentConditions, error) {
+		return fetchCurrent(ctx, p, req)
+	})
+	results, data := collectOutcomes(outcomes, len(req.providers))
+
+	response := CurrentResponse{
+		Query:       req.query,
+		Location:    echoLocation(req),
+		Units:       req.units.Labels(),
+		GeneratedAt: settings.Clock.Now().UTC(),
+		Providers:   results,
+		Attribution: attributions(req.providers, data),
+		Data:        make(map[string]provider.CurrentConditions, len(data)),
+	}
+	names := make([]string, 0, len(req.providers))
+	for _, p := range req.providers {
+		names = append(names, p.Name())
+	}
+	for name, current := range data {
+		response.Data[name] = req.units.ConvertCurrent(current)
+	}
+	if consensus := currentConsensus(names, data); consensus != nil {
+		converted := req.units.ConvertCurrent(*consensus)
+		response.Consensus = &converted
+	}
+	writeCollected(w, response, len(data) == 0)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+func TestCurrentHandler_Consensus(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+
+	humidity, wind := 60.0, 5.0
+	settings.Providers = []provider.WeatherProvider{
+		&mockAPIProvider{mockProvider: mockProvider{name: "a"}, current: provider.CurrentConditions{Temperature: 20, Humidity: &humidity, Condition: provider.ConditionRain}},
+		&mockAPIProvider{mockProvider: mockProvider{name: "b"}, current: provider.CurrentConditions{Temperature: 30, WindSpeed: &wind, Condition: provider.ConditionCloudy}},
+		&mockAPIProvider{mockProvider: mockProvider{name: "c"}, current: provider.CurrentConditions{Temperature: 25, Condition: provider.ConditionCloudy}},
+		&mockProvider{name: "daily"},
+	}
+
+	w, response := serveJSON[CurrentResponse](t, CurrentHandler, "/weather/current?lat=50&lon=10&units=imperial")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if len(response.Data) != 3 || response.Data["a"].Temperature != 68 {
+		t.Errorf("unexpected data: %+v", response.Data)
+	}
+	if got := response.Providers[3]; got.Name != "daily" || got.Status != ProviderStatusSkipped {
+		t.Errorf("expected the provider without current conditions skipped, got %+v", got)
+	}
+	consensus := response.Consensus
+	if consensus == nil || consensus.Temperature != 77 || consensus.Condition != provider.ConditionCloudy {
+		t.Fatalf("unexpected consensus: %+v", consensus)
+	}
+	if consensus.Humidity == nil || *consensus.Humidity != 60 {
+		t.Errorf("expected humidity 60, got %v", consensus.Humidity)
+	}
+	if consensus.WindSpeed == nil || *consensus.WindSpeed != 5/0.44704 {
+		t.Errorf("expected the wind speed in mph, got %v", consensus.WindSpeed)
+	}
+	if response.Units.Temperature != "°F" {
+		t.Errorf("unexpected units %+v", response.Units)
+	}
+}
+
+func TestCurrentHandler_Cache(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	clock := provider.NewFakeClock(time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC))
+	useClock(clock)
+
+	p := &mockAPIProvider{mockProvider: mockProvider{name: "a"}, current: provider.CurrentConditions{Temperature: 20}}
+	settings.Providers = []provider.WeatherProvider{p}
+
+	serveJSON[CurrentResponse](t, CurrentHandler, "/weather/current?lat=50&lon=10")
+	clock.Advance(currentTTL - time.Second)
+	// the same location to 0.01°
+	serveJSON[CurrentResponse](t, CurrentHandler, "/weather/current?lat=50.001&lon=10")
+	if p.calls != 1 {
+		t.Errorf("expected the cached conditions, got %d calls", p.calls)
+	}
+
+	serveJSON[CurrentResponse](t, CurrentHandler, "/weather/current?lat=51&lon=10")
+	clock.Advance(time.Second)
+	serveJSON[CurrentResponse](t, CurrentHandler, "/weather/current?lat=50&lon=10")
+	if p.calls != 3 {
+		t.Errorf("expected a call per location and after expiry, got %d calls", p.calls)
+	}
+}
+
+func TestCurrentHandler_AllFailed(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	settings.Providers = []provider.WeatherProvider{
+		&mockAPIProvider{mockProvider: mockProvider{name: "a", err: errors.New("boom")}},
+	}
+
+	w, response := serveJSON[CurrentResponse](t, CurrentHandler, "/weather/current?lat=50&lon=10")
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 Bad Gateway, got %d", w.Code)
+	}
+	if response.Consensus != nil || response.Providers[0].Status != ProviderStatusError {
+		t.Errorf("unexpected response: %+v", response)
+	}
+	// failures are not cached
+	serveJSON[CurrentResponse](t, CurrentHandler, "/weather/current?lat=50&lon=10")
+	if calls := settings.Providers[0].(*mockAPIProvider).calls; calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"context"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const EnvelopeVersion = "2"
+
+// Provider statuses reported in the envelope.
+const (
+	ProviderStatusOK      = "ok"
+	ProviderStatusError   = "error"
+	ProviderStatusSkipped = "skipped"
+)
+
+// WeatherEnvelope is the /v2/weather response. Unlike /weather, a provider
+// failure does not fail the request: it is reported in Providers and the
+// other forecasts are still returned. Alerts are the severe weather alerts in
+// effect, as served by /alerts, and AlertSources the outcome of their sources.
+type WeatherEnvelope struct {
+	Version      string                    `json:"version"`
+	Request      RequestEcho               `json:"request"`
+	GeneratedAt  time.Time                 `json:"generated_at"`
+	Providers    []ProviderResult          `json:"providers"`
+	Attribution  []Attribution             `json:"attribution"`
+	Consensus    provider.ForecastDay      `json:"consensus"`
+	Data         provider.ProviderForecast `json:"data"`
+	AlertSources []ProviderResult          `json:"alert_sources"`
+	Alerts       []provider.Alert          `json:"alerts"`
+}
+
+// RequestEcho describes the request as it was understood: the resolved
+// location, the units, the timezone and the forecast days.
+type RequestEcho struct {
+	Query    string              `json:"query,omitempty"`
+	Location geocoder.Location   `json:"location"`
+	Units    provider.Units      `json:"units"`
+	Labels   provider.UnitLabels `json:"unit_labels"`
+	Timezone string              `json:"timezone"`
+	Days     []string            `json:"days"`
+}
+
+type ProviderResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Attribution struct {
+	Provider string `json:"provider"`
+	Text     string `json:"text,omitempty"`
+	License  string `json:"license,omitempty"`
+}
+
+// errUnsupported reports a provider that lacks what a request asks for.
+var errUnsupported = errors.New("not supported")
+
+// providerOutcome is what one provider of a request returned.
+type providerOutcome[T any] struct {
+	index  int
+	result ProviderResult
+	data   T
+}
+
+// callProviders calls fetch for every provider concurrently and sends every
+// outcome as soon as its provider returns. The channel is closed once all have
+// returned.
+func callProviders[P interface{ Name() string }, T any](ctx context.Context, providers []P, fetch func(context.Context, P) (T, error)) <-chan providerOutcome[T] {
+	outcomes := make(chan providerOutcome[T], len(providers))
+
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := settings.Clock.Now()
+			data, err := fetch(ctx, p)
+			outcome := providerOutcome[T]{index: i, result: ProviderResult{
+				Name:       p.Name(),
+				Status:     ProviderStatusOK,
+				DurationMs: settings.Clock.Now().Sub(start).Milliseconds(),
+			}}
+			switch {
+			case errors.Is(err, errCircuitOpen), errors.Is(err, errUnsupported):
+				outcome.result.Status, outcome.result.Error = ProviderStatusSkipped, err.Error()
+			case err != nil:
+				outcome.result.Status, outcome.result.Error = ProviderStatusError, err.Error()
+			default:
+				outcome.data = data
+			}
+			outcomes <- outcome
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+	return outcomes
+}
+
+// fetchProviders calls the providers of a forecast request concurrently.
+func fetchProviders(ctx context.Context, req *weatherRequest) <-chan providerOutcome[provider.ForecastDay] {
+	fetch := fetchForecast
+	if req.fresh {
+		fetch = refreshForecast
+	}
+	return callProviders(ctx, req.providers, func(ctx context.Context, p provider.WeatherProvider) (provider.ForecastDay, error) {
+		return fetch(ctx, p, req.lat, req.lon, req.loc)
+	})
+}
+
+// collectOutcomes reports the outcomes of n providers in provider order,
+// keeping the data of the providers that succeeded.
+func collectOutcomes[T any](outcomes <-chan providerOutcome[T], n int) ([]ProviderResult, map[string]T) {
+	results := make([]ProviderResult, n)
+	data := make(map[string]T)
+	for outcome := range outcomes {
+		results[outcome.index] = outcome.result
+		if outcome.result.Status == ProviderStatusOK {
+			data[outcome.result.Name] = outcome.data
+		}
+	}
+	return results, data
+}
+
+// collectForecast calls the providers concurrently and reports every outcome,
+// keeping the forecasts of the providers that succeeded. Their consensus is
+// recorded in the history.
+func collectForecast(ctx context.Context, req *weatherRequest) ([]ProviderResult, provider.ProviderForecast) {
+	results, forecast := collectOutcomes(fetchProviders(ctx, req), len(req.providers))
+	recordConsensus(req, forecast)
+	return results, forecast
+}
+
+// attributions returns the attribution of the providers that returned data,
+// in provider order.
+func attributions[P interface{ Name() string }, T any](providers []P, data map[string]T) []Attribution {
+	result := []Attribution{}
+	for _, p := range providers {
+		if _, ok := data[p.Name()]; !ok {
+			continue
+		}
+		attribution := Attribution{Provider: p.Name()}
+		if described, ok := any(p).(interface{ Capabilities() provider.Capabilities }); ok {
+			capabilities := described.Capabilities()
+			attribution.Text, attribution.License = capabilities.Attribution, capabilities.License
+		}
+		result = append(result, attribution)
+	}
+	return result
+}
+
+// writeCollected writes the response of a request to several providers, with
+// 502 Bad Gateway when none of them returned data.
+func writeCollected(w http.ResponseWriter, response any, failed bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if failed {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// echoLocation returns the resolved location, or the requested point named
+// after the nearest place.
+func echoLocation(req *weatherRequest) geocoder.Location {
+	if req.location != nil {
+		return *req.location
+	}
+	location := geocoder.Location{Lat: req.latf, Lon: req.lonf, Timezone: req.loc.String()}
+	if req.place != nil {
+		location.Name = req.place.Name
+		location.Region = req.place.Region
+		location.Country = req.place.Country
+		location.CountryCode = req.place.CountryCode
+	}
+	return location
+}
+
+// WeatherV2Handler serves /v2/weather, calling the alert sources alongside
+// the providers. It answers 502 Bad Gateway, still with the envelope, when no
+// provider returned a forecast; failing alert sources do not fail it.
+func WeatherV2Handler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	req, err := resolveWeatherRequest(ctx, queryParams(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	var alertResults []ProviderResult
+	var alerts []provider.Alert
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		alertResults, alerts = collectAlerts(ctx, req)
+	}()
+	results, data := collectForecast(ctx, req)
+	<-collected
+
+	envelope := WeatherEnvelope{
+		Version: EnvelopeVersion,
+		Request: RequestEcho{
+			Query:    req.query,
+			Location: echoLocation(req),
+			Units:    req.units,
+			Labels:   req.units.Labels(),
+			Timezone: req.loc.String(),
+			Days:     provider.ForecastDates(settings.Clock, req.loc),
+		},
+		GeneratedAt:  settings.Clock.Now().UTC(),
+		Providers:    results,
+		Attribution:  attributions(req.providers, data),
+		Consensus:    req.units.ConvertDays(consensus(data)),
+		Data:         req.units.Convert(data),
+		AlertSources: alertResults,
+		Alerts:       alerts,
+	}
+	writeCollected(w, envelope, len(data) == 0)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+)
+
+func TestWeatherV2Handler_Envelope(t *testing.T) {
+	defer resetSettings()
+
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)))
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "first", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+		&mockProvider{name: "second", data: provider.ForecastDay{"2024-08-01": {Temperature: 24.0}}},
+	}
+	settings.APILimit = 1
+	settings.ReverseGeocoder = &mockReverseGeocoder{place: geocoder.Place{Location: geocoder.Location{Name: "Oslo", CountryCode: "NO", Timezone: "UTC"}}}
+	settings.alertSources = []provider.AlertSource{
+		&mockAlertSource{name: "agency", alerts: []provider.Alert{{Event: "Gale Warning", Effective: time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC), Sources: []string{"agency"}}}},
+		&mockAlertSource{name: "down", err: errors.New("boom")},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/weather?lat=59.91&lon=10.75&units=imperial", nil)
+	w := httptest.NewRecorder()
+
+	WeatherV2Handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+
+	var result WeatherEnvelope
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	if result.Version != EnvelopeVersion {
+		t.Errorf("expected version %s, got %q", EnvelopeVersion, result.Version)
+	}
+	if result.Request.Location.Name != "Oslo" || result.Request.Location.Lat != 59.91 {
+		t.Errorf("unexpected location: %+v", result.Request.Location)
+	}
+	if result.Request.Units != provider.UnitsImperial || result.Request.Labels.Temperature != "°F" {
+		t.Errorf("unexpected units: %q %+v", result.Request.Units, result.Request.Labels)
+	}
+	if result.Request.Timezone != "UTC" || len(result.Request.Days) != provider.FetchDaysCount || result.Request.Days[0] != "2024-08-01" {
+		t.Errorf("unexpected timezone or days: %s %v", result.Request.Timezone, result.Request.Days)
+	}
+	if !result.GeneratedAt.Equal(time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected generated_at: %v", result.GeneratedAt)
+	}
+	if len(result.Providers) != 2 || result.Providers[0].Status != ProviderStatusOK {
+		t.Errorf("unexpected providers: %+v", result.Providers)
+	}
+	if len(result.Attribution) != 2 {
+		t.Errorf("expected an attribution per provider, got %+v", result.Attribution)
+	}
+	// the median of 20 and 24 °C is 22 °C
+	if got := result.Consensus["2024-08-01"].Temperature; got < 71.59 || got > 71.61 {
+		t.Errorf("expected consensus 71.6 °F, got %.2f", got)
+	}
+	if got := result.Data["first"]["2024-08-01"].Temperature; got != 68.0 {
+		t.Errorf("expected 68 °F, got %.2f", got)
+	}
+	if len(result.Alerts) != 1 || result.Alerts[0].Event != "Gale Warning" {
+		t.Errorf("expected the gale warning, got %+v", result.Alerts)
+	}
+	if len(result.AlertSources) != 2 || result.AlertSources[1].Status != ProviderStatusError {
+		t.Errorf("expected the failing alert source reported, got %+v", result.AlertSources)
+	}
+}
+
+func TestWeatherV2Handler_PartialFailure(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "good", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+		&mockProvider{name: "bad", err: errors.New("upstream down")},
+	}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/weather?lat=50&lon=10", nil)
+	w := httptest.NewRecorder()
+
+	WeatherV2Handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+
+	var result WeatherEnvelope
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	if result.Providers[1].Name != "bad" || result.Providers[1].Status != ProviderStatusError || result.Providers[1].Error != "upstream down" {
+		t.Errorf("unexpected status for failing provider: %+v", result.Providers[1])
+	}
+	if _, ok := result.Data["bad"]; ok {
+		t.Error("expected no data for failing provider")
+	}
+	if _, ok := result.Data["good"]; !ok {
+		t.Error("expected data for good provider")
+	}
+}
+
+func TestWeatherV2Handler_AllFailed(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "bad", err: errors.New("upstream down")},
+	}
+	settings.APILimit = 1
+	for range circuitFailureThreshold {
+		settings.health.record("bad", errors.New("upstream down"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/weather?lat=50&lon=10", nil)
+	w := httptest.NewRecorder()
+
+	WeatherV2Handler(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 Bad Gateway, got %d", w.Code)
+	}
+
+	var result WeatherEnvelope
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if result.Providers[0].Status != ProviderStatusSkipped {
+		t.Errorf("expected provider with open circuit to be skipped, got %+v", result.Providers[0])
+	}
+}
+
+func TestWeatherV2Handler_InvalidRequest(t *testing.T) {
+	defer resetSettings()
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/weather?lat=500&lon=10", nil)
+	w := httptest.NewRecorder()
+
+	WeatherV2Handler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+}
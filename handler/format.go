@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"cycloid/test/provider"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// outputFormat is the representation of a forecast response.
+type outputFormat string
+
+const (
+	formatJSON    outputFormat = "json"
+	formatCSV     outputFormat = "csv"
+	formatNDJSON  outputFormat = "ndjson"
+	formatGeoJSON outputFormat = "geojson"
+)
+
+var formatContentTypes = map[outputFormat]string{
+	formatJSON:    "application/json",
+	formatCSV:     "text/csv; charset=utf-8",
+	formatNDJSON:  "application/x-ndjson",
+	formatGeoJSON: "application/geo+json",
+}
+
+// acceptedFormats maps the media types of the Accept header to formats.
+var acceptedFormats = map[string]outputFormat{
+	"application/json":     formatJSON,
+	"text/csv":             formatCSV,
+	"application/x-ndjson": formatNDJSON,
+	"application/ndjson":   formatNDJSON,
+	"application/jsonl":    formatNDJSON,
+	"application/geo+json": formatGeoJSON,
+}
+
+// negotiateFormat picks the response format from the format query parameter,
+// else the media type of the Accept header it knows with the highest q-value,
+// the first one on ties, else JSON.
+func negotiateFormat(r *http.Request) (outputFormat, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := formatContentTypes[outputFormat(format)]; !ok {
+			return "", badRequest("Invalid format")
+		}
+		return outputFormat(format), nil
+	}
+
+	best, bestQ := formatJSON, 0.0
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		format, ok := acceptedFormats[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best, nil
+}
+
+// ForecastRow is one provider and day of a forecast in the tabular formats.
+// Location, Status and Error are only set in batch responses, where a failed
+// location is a single row without forecast.
+type ForecastRow struct {
+	Location       string   `json:"location,omitempty"`
+	Status         int      `json:"status,omitempty"`
+	Error          string   `json:"error,omitempty"`
+	Provider       string   `json:"provider,omitempty"`
+	Date           string   `json:"date,omitempty"`
+	Temperature    *float64 `json:"temperature,omitempty"`
+	TemperatureMin *float64 `json:"temperature_min,omitempty"`
+	WindSpeed      *float64 `json:"wind_speed,omitempty"`
+	Precipitation  *float64 `json:"precipitation,omitempty"`
+	Pressure       *float64 `json:"pressure,omitempty"`
+}
+
+// forecastRows flattens a forecast into rows ordered by provider and date.
+func forecastRows(forecast provider.ProviderForecast) []ForecastRow {
+	var rows []ForecastRow
+	for _, name := range sortedKeys(forecast) {
+		days := forecast[name]
+		for _, date := range sortedKeys(days) {
+			day := days[date]
+			rows = append(rows, ForecastRow{
+				Provider:       name,
+				Date:           date,
+				Temperature:    &day.Temperature,
+				TemperatureMin: day.TemperatureMin,
+				WindSpeed:      day.WindSpeed,
+				Precipitation:  day.Precipitation,
+				Pressure:       day.Pressure,
+			})
+		}
+	}
+	return rows
+}
+
+// batchRows flattens the result of a batch location, a single row with the
+// error when it failed.
+func batchRows(result BatchResult) []ForecastRow {
+	if result.Status != http.StatusOK {
+		return []ForecastRow{{Location: result.Name, Status: result.Status, Error: result.Error}}
+	}
+	rows := forecastRows(result.Forecast)
+	for i := range rows {
+		rows[i].Location, rows[i].Status = result.Name, result.Status
+	}
+	return rows
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// rowWriter writes forecast rows in a tabular format, flushing them to the
+// client on flush.
+type rowWriter interface {
+	write(rows []ForecastRow) error
+	flush()
+}
+
+// newRowWriter sets the content type and returns the writer of format, CSV or
+// NDJSON. Batch rows have the location, status and error columns.
+func newRowWriter(w http.ResponseWriter, format outputFormat, batch bool) rowWriter {
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	if format == formatNDJSON {
+		return &ndjsonWriter{w: w, encoder: json.NewEncoder(w)}
+	}
+	writer := &csvWriter{w: w, csv: csv.NewWriter(w), batch: batch}
+	writer.csv.Write(writer.header())
+	return writer
+}
+
+func flushResponse(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	encoder *json.Encoder
+}
+
+func (n *ndjsonWriter) write(rows []ForecastRow) error {
+	for _, row := range rows {
+		if err := n.encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) flush() {
+	flushResponse(n.w)
+}
+
+var csvColumns = []string{"provider", "date", "temperature", "temperature_min", "wind_speed", "precipitation", "pressure"}
+
+type csvWriter struct {
+	w     http.ResponseWriter
+	csv   *csv.Writer
+	batch bool
+}
+
+func (c *csvWriter) header() []string {
+	if c.batch {
+		return append([]string{"location", "status", "error"}, csvColumns...)
+	}
+	return csvColumns
+}
+
+func csvFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+func (c *csvWriter) write(rows []ForecastRow) error {
+	for _, row := range rows {
+		record := []string{
+			row.Provider,
+			row.Date,
+			csvFloat(row.Temperature),
+			csvFloat(row.TemperatureMin),
+			csvFloat(row.WindSpeed),
+			csvFloat(row.Precipitation),
+			csvFloat(row.Pressure),
+		}
+		if c.batch {
+			record = append([]string{row.Location, fmt.Sprint(row.Status), row.Error}, record...)
+		}
+		if err := c.csv.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) flush() {
+	c.csv.Flush()
+	flushResponse(c.w)
+}
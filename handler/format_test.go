@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cycloid/test/provider"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		url, accept string
+		want        outputFormat
+	}{
+		{"/weather", "", formatJSON},
+		{"/weather", "*/*", formatJSON},
+		{"/weather", "text/csv", formatCSV},
+		{"/weather", "text/html, application/x-ndjson;q=0.9", formatNDJSON},
+		{"/weather", "text/csv;q=0.5, application/json", formatJSON},
+		{"/weather", "application/json;q=0.2, application/x-ndjson;q=0.8, text/csv;q=0.8", formatNDJSON},
+		{"/weather", "text/csv;q=0", formatJSON},
+		{"/weather?format=csv", "application/json", formatCSV},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		req.Header.Set("Accept", tt.accept)
+		got, err := negotiateFormat(req)
+		if err != nil || got != tt.want {
+			t.Errorf("%s with Accept %q: expected %s, got %s, %v", tt.url, tt.accept, tt.want, got, err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?format=xml", nil)
+	if _, err := negotiateFormat(req); statusOf(err) != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown format, got %v", err)
+	}
+}
+
+func TestWeatherHandler_CSV(t *testing.T) {
+	defer resetSettings()
+
+	wind := 5.0
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "b", data: provider.ForecastDay{"2024-08-02": {Temperature: 21.5}, "2024-08-01": {Temperature: 20.0, WindSpeed: &wind}}},
+		&mockProvider{name: "a", data: provider.ForecastDay{"2024-08-01": {Temperature: 19.0}}},
+	}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=50&lon=10", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("unexpected content type %q", got)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV response: %v", err)
+	}
+	want := [][]string{
+		{"provider", "date", "temperature", "temperature_min", "wind_speed", "precipitation", "pressure"},
+		{"a", "2024-08-01", "19", "", "", "", ""},
+		{"b", "2024-08-01", "20", "", "18", "", ""},
+		{"b", "2024-08-02", "21.5", "", "", "", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %v", len(want), records)
+	}
+	for i := range want {
+		if strings.Join(records[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("record %d: expected %v, got %v", i, want[i], records[i])
+		}
+	}
+}
+
+func TestBatchHandler_NDJSON(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "goodProvider", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+	}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodPost, "/weather/batch?format=ndjson", strings.NewReader(`{
+		"locations": [{"name": "site-1", "lat": 50, "lon": 10}, {"name": "broken", "lat": 500, "lon": 10}]
+	}`))
+	w := httptest.NewRecorder()
+
+	BatchHandler(w, req)
+
+	if got := w.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("unexpected content type %q", got)
+	}
+
+	rows := make(map[string]ForecastRow)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var row ForecastRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		rows[row.Location] = row
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected a row per location, got %v", rows)
+	}
+	if site := rows["site-1"]; site.Status != http.StatusOK || site.Provider != "goodProvider" || *site.Temperature != 20.0 {
+		t.Errorf("unexpected row for site-1: %+v", site)
+	}
+	if broken := rows["broken"]; broken.Status != http.StatusBadRequest || broken.Error != "Invalid latitude" || broken.Temperature != nil {
+		t.Errorf("unexpected row for broken: %+v", broken)
+	}
+}
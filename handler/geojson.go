@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+)
+
+// FeatureCollection is the GeoJSON (RFC 7946) representation of forecasts,
+// with a Point feature per location.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string            `json:"type"`
+	Geometry   *Point            `json:"geometry"`
+	Properties FeatureProperties `json:"properties"`
+}
+
+// Point is a GeoJSON point, its coordinates being longitude then latitude.
+type Point struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// FeatureProperties carries the forecast of a location by provider and day.
+// Name, Status and Error are only set for batch locations; a location that
+// failed has no geometry nor forecast.
+type FeatureProperties struct {
+	Name     string                    `json:"name,omitempty"`
+	Status   int                       `json:"status,omitempty"`
+	Error    string                    `json:"error,omitempty"`
+	Location *geocoder.Location        `json:"location,omitempty"`
+	Timezone string                    `json:"timezone,omitempty"`
+	Units    provider.UnitLabels       `json:"units"`
+	Forecast provider.ProviderForecast `json:"forecast,omitempty"`
+}
+
+func newPoint(lat, lon float64) *Point {
+	return &Point{Type: "Point", Coordinates: []float64{lon, lat}}
+}
+
+func newFeatureCollection(features ...Feature) FeatureCollection {
+	return FeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// weatherFeature is the feature of a /weather response.
+func weatherFeature(req *weatherRequest, data provider.ProviderForecast) Feature {
+	return Feature{
+		Type:     "Feature",
+		Geometry: newPoint(req.latf, req.lonf),
+		Properties: FeatureProperties{
+			Location: req.location,
+			Timezone: req.loc.String(),
+			Units:    req.units.Labels(),
+			Forecast: data,
+		},
+	}
+}
+
+// batchFeature is the feature of a batch location.
+func batchFeature(result BatchResult, units provider.Units) Feature {
+	feature := Feature{
+		Type: "Feature",
+		Properties: FeatureProperties{
+			Name:     result.Name,
+			Status:   result.Status,
+			Error:    result.Error,
+			Location: result.Location,
+			Timezone: result.Timezone,
+			Units:    units.Labels(),
+			Forecast: result.Forecast,
+		},
+	}
+	if result.point != nil {
+		feature.Geometry = newPoint(result.point[0], result.point[1])
+	}
+	return feature
+}
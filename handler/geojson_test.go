@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cycloid/test/provider"
+)
+
+func TestWeatherHandler_GeoJSON(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "goodProvider", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+	}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=50.5&lon=10.25&format=geojson", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if got := w.Header().Get("Content-Type"); got != "application/geo+json" {
+		t.Errorf("unexpected content type %q", got)
+	}
+
+	var result FeatureCollection
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	if result.Type != "FeatureCollection" || len(result.Features) != 1 {
+		t.Fatalf("unexpected collection: %+v", result)
+	}
+	feature := result.Features[0]
+	if feature.Type != "Feature" || feature.Geometry.Type != "Point" {
+		t.Errorf("unexpected feature: %+v", feature)
+	}
+	// GeoJSON positions are longitude first
+	if c := feature.Geometry.Coordinates; len(c) != 2 || c[0] != 10.25 || c[1] != 50.5 {
+		t.Errorf("unexpected coordinates: %v", c)
+	}
+	if feature.Properties.Forecast["goodProvider"]["2024-08-01"].Temperature != 20.0 || feature.Properties.Units.Temperature != "°C" {
+		t.Errorf("unexpected properties: %+v", feature.Properties)
+	}
+}
+
+func TestBatchHandler_GeoJSON(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "goodProvider", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+	}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodPost, "/weather/batch", strings.NewReader(`{
+		"locations": [{"name": "site-1", "lat": 50, "lon": 10}, {"name": "site-2", "lat": 51, "lon": 11}, {"name": "broken", "lat": 500, "lon": 10}]
+	}`))
+	req.Header.Set("Accept", "application/geo+json")
+	w := httptest.NewRecorder()
+
+	BatchHandler(w, req)
+
+	var result FeatureCollection
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	if len(result.Features) != 3 {
+		t.Fatalf("expected a feature per site, got %d", len(result.Features))
+	}
+	if site := result.Features[1]; site.Properties.Name != "site-2" || site.Geometry == nil || site.Geometry.Coordinates[0] != 11 {
+		t.Errorf("unexpected feature for site-2: %+v", site)
+	}
+	if broken := result.Features[2]; broken.Geometry != nil || broken.Properties.Status != http.StatusBadRequest || broken.Properties.Error == "" {
+		t.Errorf("unexpected feature for broken: %+v", broken)
+	}
+}
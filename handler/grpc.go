@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	weatherv1 "cycloid/test/api/weather/v1"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WeatherServer implements the gRPC WeatherService on the code of the HTTP
+// handlers: the same validation, provider selection, circuit breakers and
+// units.
+type WeatherServer struct {
+	weatherv1.UnimplementedWeatherServiceServer
+}
+
+// NewGRPCServer returns a gRPC server with the WeatherService registered.
+func NewGRPCServer(options ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(options...)
+	weatherv1.RegisterWeatherServiceServer(server, &WeatherServer{})
+	return server
+}
+
+var unitsFromProto = map[weatherv1.Units]provider.Units{
+	weatherv1.Units_UNITS_UNSPECIFIED: provider.UnitsMetric,
+	weatherv1.Units_UNITS_METRIC:      provider.UnitsMetric,
+	weatherv1.Units_UNITS_IMPERIAL:    provider.UnitsImperial,
+	weatherv1.Units_UNITS_SI:          provider.UnitsSI,
+}
+
+var unitsToProto = map[provider.Units]weatherv1.Units{
+	provider.UnitsMetric:   weatherv1.Units_UNITS_METRIC,
+	provider.UnitsImperial: weatherv1.Units_UNITS_IMPERIAL,
+	provider.UnitsSI:       weatherv1.Units_UNITS_SI,
+}
+
+// grpcParams converts the location and options of a request into the
+// parameters of the HTTP endpoints.
+func grpcParams(coordinates *weatherv1.Coordinates, query, timezone string, units weatherv1.Units, providers []string) (weatherParams, error) {
+	u, ok := unitsFromProto[units]
+	if !ok {
+		return weatherParams{}, badRequest("Invalid units")
+	}
+	params := weatherParams{
+		Query:     query,
+		Timezone:  timezone,
+		Units:     string(u),
+		Providers: strings.Join(providers, ","),
+	}
+	if coordinates != nil {
+		params.Lat = strconv.FormatFloat(coordinates.Latitude, 'f', -1, 64)
+		params.Lon = strconv.FormatFloat(coordinates.Longitude, 'f', -1, 64)
+	}
+	return params, nil
+}
+
+// grpcCodes maps the statuses of the HTTP endpoints to gRPC codes.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusMultipleChoices:       codes.InvalidArgument,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusRequestEntityTooLarge: codes.InvalidArgument,
+	http.StatusInternalServerError:   codes.Internal,
+	http.StatusBadGateway:            codes.Unavailable,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+	http.StatusGatewayTimeout:        codes.DeadlineExceeded,
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	if code, ok := grpcCodes[httpStatus]; ok {
+		return code
+	}
+	return codes.Unknown
+}
+
+// grpcError converts an error of resolveWeatherRequest into a gRPC status,
+// listing the candidates of an ambiguous query in the message.
+func grpcError(err error) error {
+	message := err.Error()
+	var re *requestError
+	if errors.As(err, &re) && re.candidates != nil {
+		names := make([]string, len(re.candidates))
+		for i, candidate := range re.candidates {
+			names[i] = fmt.Sprintf("%s (%s)", candidate.Name, candidate.CountryCode)
+		}
+		message += ": " + strings.Join(names, ", ")
+	}
+	return status.Error(grpcCode(statusOf(err)), message)
+}
+
+func locationToProto(location *geocoder.Location) *weatherv1.Location {
+	if location == nil {
+		return nil
+	}
+	return &weatherv1.Location{
+		Name:        location.Name,
+		Region:      location.Region,
+		Country:     location.Country,
+		CountryCode: location.CountryCode,
+		Latitude:    location.Lat,
+		Longitude:   location.Lon,
+		Timezone:    location.Timezone,
+	}
+}
+
+func forecastToProto(forecast provider.ProviderForecast) []*weatherv1.ProviderForecast {
+	result := make([]*weatherv1.ProviderForecast, 0, len(forecast))
+	for _, name := range sortedKeys(forecast) {
+		days := forecast[name]
+		pf := &weatherv1.ProviderForecast{Provider: name}
+		for _, date := range sortedKeys(days) {
+			day := days[date]
+			pf.Days = append(pf.Days, &weatherv1.DailyForecast{
+				Date:           date,
+				TemperatureMax: day.Temperature,
+				TemperatureMin: day.TemperatureMin,
+				WindSpeed:      day.WindSpeed,
+				Precipitation:  day.Precipitation,
+				Pressure:       day.Pressure,
+			})
+		}
+		result = append(result, pf)
+	}
+	return result
+}
+
+func forecastResponse(req *weatherRequest, data provider.ProviderForecast) *weatherv1.GetForecastResponse {
+	labels := req.units.Labels()
+	return &weatherv1.GetForecastResponse{
+		Location: locationToProto(req.location),
+		Timezone: req.loc.String(),
+		Units:    unitsToProto[req.units],
+		UnitLabels: &weatherv1.UnitLabels{
+			Temperature:   labels.Temperature,
+			WindSpeed:     labels.WindSpeed,
+			Precipitation: labels.Precipitation,
+			Pressure:      labels.Pressure,
+		},
+		Forecasts: forecastToProto(req.units.Convert(data)),
+	}
+}
+
+// forecast resolves and fetches one location like /weather, returning the
+// providers skipped because their circuit is open.
+func (s *WeatherServer) forecast(ctx context.Context, params weatherParams) (*weatherv1.GetForecastResponse, []string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	req, err := resolveWeatherRequest(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, skipped, err := aggregateForecast(ctx, req.lat, req.lon, req.loc, req.providers)
+	if err != nil {
+		return nil, skipped, fmt.Errorf("Failed to aggregate forecast: %w", err)
+	}
+	return forecastResponse(req, data), skipped, nil
+}
+
+func (s *WeatherServer) GetForecast(ctx context.Context, in *weatherv1.GetForecastRequest) (*weatherv1.GetForecastResponse, error) {
+	params, err := grpcParams(in.GetCoordinates(), in.GetQuery(), in.GetTimezone(), in.GetUnits(), in.GetProviders())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	response, skipped, err := s.forecast(ctx, params)
+	if len(skipped) > 0 {
+		grpc.SetHeader(ctx, metadata.MD{strings.ToLower(skippedHeader): skipped})
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return response, nil
+}
+
+func (s *WeatherServer) BatchGetForecast(in *weatherv1.BatchGetForecastRequest, stream grpc.ServerStreamingServer[weatherv1.BatchGetForecastResponse]) error {
+	if len(in.GetLocations()) == 0 {
+		return status.Error(codes.InvalidArgument, "Invalid batch: no locations")
+	}
+	if len(in.GetLocations()) > settings.BatchLimit {
+		return status.Errorf(codes.InvalidArgument, "Too many locations: the limit is %d", settings.BatchLimit)
+	}
+	for i, l := range in.GetLocations() {
+		if err := validateLocationName(l.GetName()); err != nil {
+			return status.Errorf(codes.InvalidArgument, "Invalid batch: location %d: %v", i, err)
+		}
+	}
+	if _, ok := unitsFromProto[in.GetUnits()]; !ok {
+		return status.Error(codes.InvalidArgument, "Invalid units")
+	}
+
+	params := make([]weatherParams, len(in.GetLocations()))
+	for i, l := range in.GetLocations() {
+		params[i], _ = grpcParams(l.GetCoordinates(), l.GetQuery(), in.GetTimezone(), in.GetUnits(), in.GetProviders())
+	}
+
+	ctx, cancel := context.WithTimeout(stream.Context(), settings.BatchTimeout)
+	defer cancel()
+
+	var sendErr error
+	for done := range runBatch(ctx, len(params), func(ctx context.Context, i int) *weatherv1.BatchGetForecastResponse {
+		response := &weatherv1.BatchGetForecastResponse{Name: in.GetLocations()[i].GetName(), Index: int32(i)}
+		forecast, _, err := s.forecast(ctx, params[i])
+		if err != nil {
+			batchError := &weatherv1.BatchError{
+				Code:    int32(grpcCode(statusOf(err))),
+				Message: err.Error(),
+			}
+			var re *requestError
+			if errors.As(err, &re) {
+				for _, candidate := range re.candidates {
+					batchError.Candidates = append(batchError.Candidates, locationToProto(&candidate))
+				}
+			}
+			response.Result = &weatherv1.BatchGetForecastResponse_Error{Error: batchError}
+		} else {
+			response.Result = &weatherv1.BatchGetForecastResponse_Forecast{Forecast: forecast}
+		}
+		return response
+	}) {
+		// keep draining so every worker finishes
+		if sendErr == nil {
+			sendErr = stream.Send(done.value)
+		}
+	}
+	return sendErr
+}
+
+func (s *WeatherServer) ListProviders(ctx context.Context, in *weatherv1.ListProvidersRequest) (*weatherv1.ListProvidersResponse, error) {
+	response := &weatherv1.ListProvidersResponse{}
+	for _, p := range settings.Providers {
+		capabilities := p.Capabilities()
+
+		info := &weatherv1.ProviderInfo{
+			Name: p.Name(),
+			Capabilities: &weatherv1.Capabilities{
+				Variables:       capabilities.Variables,
+				MaxForecastDays: int32(capabilities.MaxForecastDays),
+				Hourly:          capabilities.Hourly,
+				RequiresApiKey:  capabilities.RequiresAPIKey,
+				Attribution:     capabilities.Attribution,
+				License:         capabilities.License,
+				Current:         capabilities.Current,
+				Historical:      capabilities.Historical,
+				AirQuality:      capabilities.AirQuality,
+			},
+			Health: healthToProto(settings.health.health(p.Name())),
+		}
+		for _, key := range providerCircuits(p) {
+			if info.Circuits == nil {
+				info.Circuits = make(map[string]*weatherv1.ProviderHealth)
+			}
+			info.Circuits[key] = healthToProto(settings.health.health(key))
+		}
+		for _, area := range capabilities.Coverage {
+			a := &weatherv1.Area{}
+			if box := area.BoundingBox; box != nil {
+				a.BoundingBox = &weatherv1.BoundingBox{MinLat: box.MinLat, MinLon: box.MinLon, MaxLat: box.MaxLat, MaxLon: box.MaxLon}
+			}
+			for _, point := range area.Polygon {
+				a.Polygon = append(a.Polygon, &weatherv1.Coordinates{Latitude: point.Lat, Longitude: point.Lon})
+			}
+			info.Capabilities.Coverage = append(info.Capabilities.Coverage, a)
+		}
+		response.Providers = append(response.Providers, info)
+	}
+	return response, nil
+}
+
+func healthToProto(health ProviderHealth) *weatherv1.ProviderHealth {
+	return &weatherv1.ProviderHealth{
+		Status:              health.Status,
+		Circuit:             health.Circuit,
+		ConsecutiveFailures: int32(health.ConsecutiveFailures),
+		LastSuccess:         timestampToProto(health.LastSuccess),
+		LastFailure:         timestampToProto(health.LastFailure),
+		LastError:           health.LastError,
+	}
+}
+
+func timestampToProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	weatherv1 "cycloid/test/api/weather/v1"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves the WeatherService on an in-memory listener.
+func newTestClient(t *testing.T) weatherv1.WeatherServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := NewGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return weatherv1.NewWeatherServiceClient(conn)
+}
+
+func TestGRPC_GetForecast(t *testing.T) {
+	defer resetSettings()
+
+	wind := 10.0
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "goodProvider", data: provider.ForecastDay{
+			"2024-08-02": {Temperature: 22.0},
+			"2024-08-01": {Temperature: 20.0, WindSpeed: &wind},
+		}},
+	}
+	settings.APILimit = 1
+
+	client := newTestClient(t)
+	response, err := client.GetForecast(context.Background(), &weatherv1.GetForecastRequest{
+		Location: &weatherv1.GetForecastRequest_Coordinates{Coordinates: &weatherv1.Coordinates{Latitude: 50, Longitude: 10}},
+		Units:    weatherv1.Units_UNITS_SI,
+		Timezone: "UTC",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if response.GetTimezone() != "UTC" || response.GetUnits() != weatherv1.Units_UNITS_SI || response.GetUnitLabels().GetTemperature() != "K" {
+		t.Errorf("unexpected response metadata: %v", response)
+	}
+	if len(response.GetForecasts()) != 1 || len(response.GetForecasts()[0].GetDays()) != 2 {
+		t.Fatalf("unexpected forecasts: %v", response.GetForecasts())
+	}
+	first := response.GetForecasts()[0].GetDays()[0]
+	if first.GetDate() != "2024-08-01" || first.GetTemperatureMax() != 293.15 || first.GetWindSpeed() != 10 || first.TemperatureMin != nil {
+		t.Errorf("unexpected first day: %v", first)
+	}
+}
+
+func TestGRPC_GetForecast_Errors(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "badProvider", err: errors.New("provider failure")}}
+	settings.APILimit = 1
+	settings.Geocoder = &mockGeocoder{locations: []geocoder.Location{berlin, {Name: "Berlin", CountryCode: "US"}}}
+
+	client := newTestClient(t)
+	tests := []struct {
+		request *weatherv1.GetForecastRequest
+		code    codes.Code
+	}{
+		{&weatherv1.GetForecastRequest{Location: &weatherv1.GetForecastRequest_Coordinates{Coordinates: &weatherv1.Coordinates{Latitude: 500}}}, codes.InvalidArgument},
+		{&weatherv1.GetForecastRequest{}, codes.InvalidArgument},
+		{&weatherv1.GetForecastRequest{Location: &weatherv1.GetForecastRequest_Query{Query: "Berlin"}}, codes.InvalidArgument},
+		{&weatherv1.GetForecastRequest{Location: &weatherv1.GetForecastRequest_Coordinates{Coordinates: &weatherv1.Coordinates{Latitude: 50, Longitude: 10}}}, codes.Internal},
+		{&weatherv1.GetForecastRequest{Location: &weatherv1.GetForecastRequest_Coordinates{Coordinates: &weatherv1.Coordinates{Latitude: 50, Longitude: 10}}, Providers: []string{"unknown"}}, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		_, err := client.GetForecast(context.Background(), tt.request)
+		if got := status.Code(err); got != tt.code {
+			t.Errorf("%v: expected %s, got %s (%v)", tt.request, tt.code, got, err)
+		}
+	}
+}
+
+func TestGRPC_BatchGetForecast(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "goodProvider", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+	}
+	settings.APILimit = 1
+	settings.Geocoder = &mockGeocoder{err: geocoder.ErrNotFound}
+
+	client := newTestClient(t)
+	stream, err := client.BatchGetForecast(context.Background(), &weatherv1.BatchGetForecastRequest{
+		Locations: []*weatherv1.BatchLocation{
+			{Name: "site-1", Location: &weatherv1.BatchLocation_Coordinates{Coordinates: &weatherv1.Coordinates{Latitude: 50, Longitude: 10}}},
+			{Name: "nowhere", Location: &weatherv1.BatchLocation_Query{Query: "Nowhere"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := make(map[string]*weatherv1.BatchGetForecastResponse)
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected stream error: %v", err)
+		}
+		results[response.GetName()] = response
+	}
+
+	if site := results["site-1"]; site.GetIndex() != 0 || site.GetForecast().GetForecasts()[0].GetDays()[0].GetTemperatureMax() != 20.0 {
+		t.Errorf("unexpected result for site-1: %v", site)
+	}
+	if nowhere := results["nowhere"]; nowhere.GetIndex() != 1 || codes.Code(nowhere.GetError().GetCode()) != codes.NotFound {
+		t.Errorf("unexpected result for nowhere: %v", nowhere)
+	}
+}
+
+func TestGRPC_BatchGetForecast_TooManyLocations(t *testing.T) {
+	defer resetSettings()
+
+	SetupBatch(1, DefaultBatchTimeout)
+
+	client := newTestClient(t)
+	stream, err := client.BatchGetForecast(context.Background(), &weatherv1.BatchGetForecastRequest{
+		Locations: []*weatherv1.BatchLocation{{Name: "a"}, {Name: "b"}},
+	})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestGRPC_ListProviders(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "regional", coverage: provider.Coverage{{BoundingBox: &provider.BoundingBox{MinLat: 35, MinLon: -10, MaxLat: 70, MaxLon: 40}}}},
+	}
+	settings.health.record("regional", errors.New("timeout"))
+
+	client := newTestClient(t)
+	response, err := client.ListProviders(context.Background(), &weatherv1.ListProvidersRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(response.GetProviders()) != 1 {
+		t.Fatalf("expected 1 provider, got %v", response.GetProviders())
+	}
+	info := response.GetProviders()[0]
+	if info.GetName() != "regional" || info.GetCapabilities().GetCoverage()[0].GetBoundingBox().GetMaxLat() != 70 {
+		t.Errorf("unexpected capabilities: %v", info)
+	}
+	if info.GetHealth().GetConsecutiveFailures() != 1 || info.GetHealth().GetLastError() != "timeout" || info.GetHealth().GetLastFailure() == nil {
+		t.Errorf("unexpected health: %v", info.GetHealth())
+	}
+}
+
+func TestGRPC_ListProviders_APIs(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{provider.NewOpenMeteo(settings.Clock)}
+	settings.health.record(circuitKey("OpenMeteo", apiAirQuality), errors.New("timeout"))
+
+	client := newTestClient(t)
+	response, err := client.ListProviders(context.Background(), &weatherv1.ListProvidersRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info := response.GetProviders()[0]
+	if capabilities := info.GetCapabilities(); !capabilities.GetCurrent() || !capabilities.GetHistorical() || !capabilities.GetAirQuality() {
+		t.Errorf("unexpected capabilities: %v", capabilities)
+	}
+	circuits := info.GetCircuits()
+	if len(circuits) != 3 {
+		t.Fatalf("expected the circuits of current, historical and air quality, got %v", circuits)
+	}
+	if air := circuits["OpenMeteo/airquality"]; air.GetLastError() != "timeout" || air.GetConsecutiveFailures() != 1 {
+		t.Errorf("unexpected air quality circuit: %v", air)
+	}
+	if current := circuits["OpenMeteo/current"]; current.GetStatus() != "unknown" {
+		t.Errorf("unexpected current circuit: %v", current)
+	}
+}
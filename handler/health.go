@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+
+	// circuitFailureThreshold consecutive failures open the circuit of a provider,
+	// which is then skipped for circuitOpenDuration before a single trial call.
+	circuitFailureThreshold = 3
+	circuitOpenDuration     = 30 * time.Second
+)
+
+// The APIs of a provider besides the forecast have their own circuit, keyed
+// by circuitKey, so an outage of one leaves the others callable.
+const (
+	apiCurrent    = "current"
+	apiHistorical = "historical"
+	apiAlerts     = "alerts"
+	apiAirQuality = "airquality"
+)
+
+var errCircuitOpen = errors.New("circuit open")
+
+func circuitKey(name, api string) string {
+	return name + "/" + api
+}
+
+// providerCircuits returns the keys of the circuits of the APIs a provider
+// serves besides the forecast.
+func providerCircuits(p provider.WeatherProvider) []string {
+	var keys []string
+	if _, ok := p.(provider.CurrentProvider); ok {
+		keys = append(keys, circuitKey(p.Name(), apiCurrent))
+	}
+	if _, ok := p.(provider.HistoricalProvider); ok {
+		keys = append(keys, circuitKey(p.Name(), apiHistorical))
+	}
+	if _, ok := p.(provider.AlertSource); ok {
+		keys = append(keys, circuitKey(p.Name(), apiAlerts))
+	}
+	if _, ok := p.(provider.AirQualityProvider); ok {
+		keys = append(keys, circuitKey(p.Name(), apiAirQuality))
+	}
+	return keys
+}
+
+type ProviderHealth struct {
+	Status              string     `json:"status"`
+	Circuit             string     `json:"circuit"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+type providerState struct {
+	consecutiveFailures int
+	lastSuccess         time.Time
+	lastFailure         time.Time
+	lastError           string
+	openedAt            time.Time
+	trial               bool
+}
+
+// healthRegistry tracks the outcome of provider calls and acts as a circuit breaker.
+type healthRegistry struct {
+	mu     sync.Mutex
+	clock  provider.Clock
+	states map[string]*providerState
+}
+
+func newHealthRegistry(clock provider.Clock) *healthRegistry {
+	return &healthRegistry{
+		clock:  clock,
+		states: make(map[string]*providerState),
+	}
+}
+
+func (h *healthRegistry) state(name string) *providerState {
+	state, ok := h.states[name]
+	if !ok {
+		state = &providerState{}
+		h.states[name] = state
+	}
+	return state
+}
+
+func (s *providerState) circuit(now time.Time) string {
+	switch {
+	case s.consecutiveFailures < circuitFailureThreshold:
+		return circuitClosed
+	case now.Sub(s.openedAt) < circuitOpenDuration:
+		return circuitOpen
+	default:
+		return circuitHalfOpen
+	}
+}
+
+// allow reports whether the provider may be called. While half-open only one
+// trial call is let through until its outcome is recorded.
+func (h *healthRegistry) allow(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := h.state(name)
+	switch state.circuit(h.clock.Now()) {
+	case circuitOpen:
+		return false
+	case circuitHalfOpen:
+		if state.trial {
+			return false
+		}
+		state.trial = true
+	}
+	return true
+}
+
+func (h *healthRegistry) record(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.clock.Now()
+	state := h.state(name)
+	state.trial = false
+	if err == nil {
+		state.consecutiveFailures = 0
+		state.lastSuccess = now
+		return
+	}
+
+	state.consecutiveFailures++
+	state.lastFailure = now
+	state.lastError = err.Error()
+	if state.consecutiveFailures >= circuitFailureThreshold {
+		state.openedAt = now
+	}
+}
+
+// release ends a call without counting its outcome, letting another trial
+// call through while half-open.
+func (h *healthRegistry) release(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state(name).trial = false
+}
+
+// finish records the outcome of a call allowed by allow. A canceled call says
+// nothing about the provider and is only released.
+func (h *healthRegistry) finish(name string, err error) {
+	if errors.Is(err, context.Canceled) {
+		h.release(name)
+		return
+	}
+	h.record(name, err)
+}
+
+func (h *healthRegistry) health(name string) ProviderHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := h.state(name)
+	result := ProviderHealth{
+		Circuit:             state.circuit(h.clock.Now()),
+		ConsecutiveFailures: state.consecutiveFailures,
+		LastError:           state.lastError,
+	}
+	if !state.lastSuccess.IsZero() {
+		lastSuccess := state.lastSuccess
+		result.LastSuccess = &lastSuccess
+	}
+	if !state.lastFailure.IsZero() {
+		lastFailure := state.lastFailure
+		result.LastFailure = &lastFailure
+	}
+
+	switch {
+	case result.Circuit != circuitClosed:
+		result.Status = "down"
+	case state.consecutiveFailures > 0:
+		result.Status = "degraded"
+	case result.LastSuccess != nil:
+		result.Status = "ok"
+	default:
+		result.Status = "unknown"
+	}
+	return result
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+func TestHealthRegistry_OpensAfterFailures(t *testing.T) {
+	h := newHealthRegistry(provider.SystemClock)
+	fetchErr := errors.New("fetch error")
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		if !h.allow("p") {
+			t.Fatalf("expected call %d to be allowed", i)
+		}
+		h.record("p", fetchErr)
+	}
+
+	if h.allow("p") {
+		t.Error("expected circuit to be open")
+	}
+
+	health := h.health("p")
+	if health.Circuit != circuitOpen || health.Status != "down" || health.LastError != "fetch error" {
+		t.Errorf("unexpected health: %+v", health)
+	}
+}
+
+func TestHealthRegistry_HalfOpenTrial(t *testing.T) {
+	clock := provider.NewFakeClock(time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC))
+	h := newHealthRegistry(clock)
+	for i := 0; i < circuitFailureThreshold; i++ {
+		h.record("p", errors.New("fetch error"))
+	}
+
+	clock.Advance(circuitOpenDuration - time.Second)
+	if h.allow("p") {
+		t.Fatal("expected circuit to stay open before the open period is over")
+	}
+
+	clock.Advance(time.Second)
+	if !h.allow("p") {
+		t.Fatal("expected a trial call once the open period is over")
+	}
+	if h.allow("p") {
+		t.Error("expected only one trial call while half-open")
+	}
+
+	h.record("p", nil)
+
+	health := h.health("p")
+	if health.Circuit != circuitClosed || health.Status != "ok" || health.ConsecutiveFailures != 0 {
+		t.Errorf("unexpected health: %+v", health)
+	}
+}
+
+func TestHealthRegistry_CanceledTrialIsReleased(t *testing.T) {
+	clock := provider.NewFakeClock(time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC))
+	h := newHealthRegistry(clock)
+	for i := 0; i < circuitFailureThreshold; i++ {
+		h.record("p", errors.New("fetch error"))
+	}
+
+	clock.Advance(circuitOpenDuration)
+	if !h.allow("p") {
+		t.Fatal("expected a trial call once the open period is over")
+	}
+	h.finish("p", context.Canceled)
+
+	if !h.allow("p") {
+		t.Fatal("expected another trial call after the canceled one")
+	}
+	if health := h.health("p"); health.Circuit != circuitHalfOpen {
+		t.Errorf("expected circuit to stay half-open, got %s", health.Circuit)
+	}
+}
+
+func TestHealthRegistry_Unknown(t *testing.T) {
+	h := newHealthRegistry(provider.SystemClock)
+
+	if health := h.health("p"); health.Status != "unknown" || health.Circuit != circuitClosed {
+		t.Errorf("unexpected health: %+v", health)
+	}
+}
+
+func TestHealthRegistry_ReopensAfterFailedTrial(t *testing.T) {
+	clock := provider.NewFakeClock(time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC))
+	h := newHealthRegistry(clock)
+	for i := 0; i < circuitFailureThreshold; i++ {
+		h.record("p", errors.New("fetch error"))
+	}
+
+	clock.Advance(circuitOpenDuration)
+	if !h.allow("p") {
+		t.Fatal("expected a trial call once the open period is over")
+	}
+	h.record("p", errors.New("still failing"))
+
+	if h.allow("p") {
+		t.Error("expected circuit to open again after a failed trial")
+	}
+	health := h.health("p")
+	if health.LastFailure == nil || !health.LastFailure.Equal(clock.Now()) {
+		t.Errorf("expected last failure at %v, got %v", clock.Now(), health.LastFailure)
+	}
+}
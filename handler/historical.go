@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// maxHistoricalDays bounds the range of a /weather/historical request.
+	maxHistoricalDays = 366
+	// maxHistoricalCacheDays provider days are cached, arbitrary ones evicted
+	// first once full.
+	maxHistoricalCacheDays = 200_000
+	// The archives revise the days of the last revisedDays, which are cached
+	// for revisedTTL only.
+	revisedDays = 7
+	revisedTTL  = 6 * time.Hour
+)
+
+// HistoricalResponse is the /weather/historical response. Like the /v2/weather
+// envelope, failing providers are reported in Providers rather than failing
+// the request.
+type HistoricalResponse struct {
+	Query       string                    `json:"query,omitempty"`
+	Location    geocoder.Location         `json:"location"`
+	Units       provider.UnitLabels       `json:"units"`
+	Timezone    string                    `json:"timezone"`
+	Start       string                    `json:"start"`
+	End         string                    `json:"end"`
+	Providers   []ProviderResult          `json:"providers"`
+	Attribution []Attribution             `json:"attribution"`
+	Consensus   provider.ForecastDay      `json:"consensus"`
+	Data        provider.ProviderForecast `json:"data"`
+}
+
+// historicalCache keeps the past days providers returned. Older days no
+// longer change and do not expire, those of the last revisedDays expire after
+// revisedTTL. Locations are rounded to 0.01°, about a kilometre.
+type historicalCache struct {
+	mu   sync.Mutex
+	days map[string]cachedValue[provider.ForecastData]
+}
+
+func newHistoricalCache() *historicalCache {
+	return &historicalCache{days: make(map[string]cachedValue[provider.ForecastData])}
+}
+
+func historicalKey(name string, req *weatherRequest, date string) string {
+	return fmt.Sprintf("%s/%.2f,%.2f/%s/%s", name, req.latf, req.lonf, req.loc, date)
+}
+
+// get returns the cached days of a provider and the dates that are not cached.
+func (c *historicalCache) get(name string, req *weatherRequest, dates []string) (provider.ForecastDay, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := settings.Clock.Now()
+	days := make(provider.ForecastDay)
+	var missing []string
+	for _, date := range dates {
+		if day, ok := c.days[historicalKey(name, req, date)]; ok && (day.expires.IsZero() || now.Before(day.expires)) {
+			days[date] = day.value
+		} else {
+			missing = append(missing, date)
+		}
+	}
+	return days, missing
+}
+
+func (c *historicalCache) put(name string, req *weatherRequest, days provider.ForecastDay) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := settings.Clock.Now()
+	revised := now.In(req.loc).AddDate(0, 0, -revisedDays).Format(time.DateOnly)
+	for date, day := range days {
+		key := historicalKey(name, req, date)
+		if _, ok := c.days[key]; !ok && len(c.days) >= maxHistoricalCacheDays {
+			for evicted := range c.days {
+				delete(c.days, evicted)
+				break
+			}
+		}
+		entry := cachedValue[provider.ForecastData]{value: day}
+		if date >= revised {
+			entry.expires = now.Add(revisedTTL)
+		}
+		c.days[key] = entry
+	}
+}
+
+// historicalChunks splits sorted dates into ranges of consecutive dates of at
+// most size days.
+func historicalChunks(dates []string, size int) [][2]string {
+	var chunks [][2]string
+	var first, previous time.Time
+	for _, date := range dates {
+		day, _ := time.Parse(time.DateOnly, date)
+		if len(chunks) == 0 || !day.Equal(previous.AddDate(0, 0, 1)) || !day.Before(first.AddDate(0, 0, size)) {
+			chunks = append(chunks, [2]string{date, date})
+			first = day
+		}
+		chunks[len(chunks)-1][1] = date
+		previous = day
+	}
+	return chunks
+}
+
+// fetchHistorical returns the days of a provider from the cache, fetching the
+// missing ones chunk by chunk.
+func fetchHistorical(ctx context.Context, p provider.WeatherProvider, req *weatherRequest, dates []string) (provider.ForecastDay, error) {
+	historical, ok := p.(provider.HistoricalProvider)
+	if !ok {
+		return nil, fmt.Errorf("%s: historical weather %w", p.Name(), errUnsupported)
+	}
+	days, missing := settings.historical.get(p.Name(), req, dates)
+	if len(missing) == 0 {
+		return days, nil
+	}
+
+	circuit := circuitKey(p.Name(), apiHistorical)
+	if !settings.health.allow(circuit) {
+		return nil, fmt.Errorf("%s: %w", circuit, errCircuitOpen)
+	}
+	var err error
+	for _, chunk := range historicalChunks(missing, historical.HistoricalChunkDays()) {
+		var fetched provider.ForecastDay
+		if fetched, err = historical.GetHistorical(ctx, req.lat, req.lon, req.loc, chunk[0], chunk[1]); err != nil {
+			break
+		}
+		settings.historical.put(p.Name(), req, fetched)
+		for date, day := range fetched {
+			days[date] = day
+		}
+	}
+	settings.health.finish(circuit, err)
+	if err != nil {
+		return nil, err
+	}
+	return days, nil
+}
+
+// historicalDates validates the start and end parameters: past days in loc,
+// at most maxHistoricalDays of them.
+func historicalDates(start, end string, loc *time.Location) ([]string, error) {
+	if start == "" || end == "" {
+		return nil, badRequest("start and end are required")
+	}
+	dates, err := provider.DateRange(start, end)
+	if err != nil {
+		return nil, badRequest(fmt.Sprintf("Invalid date: %v", err))
+	}
+	if len(dates) == 0 {
+		return nil, badRequest("end is before start")
+	}
+	if len(dates) > maxHistoricalDays {
+		return nil, badRequest(fmt.Sprintf("At most %d days can be requested", maxHistoricalDays))
+	}
+	if today := settings.Clock.Now().In(loc).Format(time.DateOnly); end >= today {
+		return nil, badRequest("end must be before today")
+	}
+	return dates, nil
+}
+
+// HistoricalHandler serves /weather/historical, the weather of past days
+// from the providers with an archive. Providers without one are reported as
+// skipped. It answers 502 Bad Gateway, still with the response, when no
+// provider returned any day.
+func HistoricalHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	req, err := resolveWeatherRequest(ctx, queryParams(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	dates, err := historicalDates(query.Get("start"), query.Get("end"), req.loc)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	outcomes := callProviders(ctx, req.providers, func(ctx context.Context, p provider.WeatherProvider) (provider.ForecastDay, error) {
+		return fetchHistorical(ctx, p, req, dates)
+	})
+	results, data := collectOutcomes(outcomes, len(req.providers))
+	maps.DeleteFunc(data, func(_ string, days provider.ForecastDay) bool { return len(days) == 0 })
+
+	response := HistoricalResponse{
+		Query:       req.query,
+		Location:    echoLocation(req),
+		Units:       req.units.Labels(),
+		Timezone:    req.loc.String(),
+		Start:       dates[0],
+		End:         dates[len(dates)-1],
+		Providers:   results,
+		Attribution: attributions(req.providers, data),
+		Consensus:   req.units.ConvertDays(consensus(data)),
+		Data:        req.units.Convert(data),
+	}
+	writeCollected(w, response, len(data) == 0)
+}
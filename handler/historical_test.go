@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+func TestHistoricalChunks(t *testing.T) {
+	dates := []string{"2024-01-01", "2024-01-02", "2024-01-03", "2024-01-04", "2024-01-05", "2024-01-07", "2024-01-08"}
+
+	got := historicalChunks(dates, 2)
+
+	want := [][2]string{
+		{"2024-01-01", "2024-01-02"},
+		{"2024-01-03", "2024-01-04"},
+		{"2024-01-05", "2024-01-05"},
+		{"2024-01-07", "2024-01-08"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected chunks %v", got)
+	}
+}
+
+func TestHistoricalHandler_ChunksAndCache(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)))
+
+	archive := &mockAPIProvider{mockProvider: mockProvider{name: "archive"}, chunkDays: 30, unpublished: "2024-07-30"}
+	settings.Providers = []provider.WeatherProvider{archive, &mockProvider{name: "daily"}}
+
+	w, response := serveJSON[HistoricalResponse](t, HistoricalHandler, "/weather/historical?lat=50&lon=10&start=2024-06-01&end=2024-07-31&units=imperial")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if fmt.Sprint(archive.ranges) != "[2024-06-01/2024-06-30 2024-07-01/2024-07-30 2024-07-31/2024-07-31]" {
+		t.Errorf("unexpected ranges %v", archive.ranges)
+	}
+	if days := response.Data["archive"]; len(days) != 59 || days["2024-06-01"].Temperature != 68 {
+		t.Errorf("expected the 59 published days in °F, got %d", len(days))
+	}
+	if response.Consensus["2024-07-29"].Temperature != 68 {
+		t.Errorf("unexpected consensus %+v", response.Consensus["2024-07-29"])
+	}
+	if got := response.Providers[1]; got.Status != ProviderStatusSkipped {
+		t.Errorf("expected the provider without archive skipped, got %+v", got)
+	}
+
+	// only the unpublished days are fetched again
+	archive.ranges = nil
+	serveJSON[HistoricalResponse](t, HistoricalHandler, "/weather/historical?lat=50&lon=10&start=2024-06-15&end=2024-07-31")
+	if fmt.Sprint(archive.ranges) != "[2024-07-30/2024-07-31]" {
+		t.Errorf("unexpected ranges %v", archive.ranges)
+	}
+}
+
+func TestHistoricalHandler_RevisedDaysExpire(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	clock := provider.NewFakeClock(time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC))
+	useClock(clock)
+
+	archive := &mockAPIProvider{mockProvider: mockProvider{name: "archive"}, chunkDays: 31}
+	settings.Providers = []provider.WeatherProvider{archive}
+
+	serveJSON[HistoricalResponse](t, HistoricalHandler, "/weather/historical?lat=50&lon=10&start=2024-07-01&end=2024-07-31")
+	clock.Advance(revisedTTL - time.Second)
+	serveJSON[HistoricalResponse](t, HistoricalHandler, "/weather/historical?lat=50&lon=10&start=2024-07-01&end=2024-07-31")
+	if len(archive.ranges) != 1 {
+		t.Fatalf("expected the cached days, got %v", archive.ranges)
+	}
+
+	// only the days of the last week are fetched again
+	clock.Advance(time.Second)
+	serveJSON[HistoricalResponse](t, HistoricalHandler, "/weather/historical?lat=50&lon=10&start=2024-07-01&end=2024-07-31")
+	if fmt.Sprint(archive.ranges) != "[2024-07-01/2024-07-31 2024-07-25/2024-07-31]" {
+		t.Errorf("unexpected ranges %v", archive.ranges)
+	}
+}
+
+func TestHistoricalHandler_InvalidDates(t *testing.T) {
+	defer resetSettings()
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)))
+	settings.Providers = []provider.WeatherProvider{&mockAPIProvider{mockProvider: mockProvider{name: "archive"}, chunkDays: 30}}
+
+	for _, query := range []string{
+		"start=2024-07-01",
+		"start=2024-07-01&end=2024-07-32",
+		"start=2024-07-02&end=2024-07-01",
+		"start=2024-07-01&end=2024-08-01",
+		"start=2023-01-01&end=2024-07-01",
+	} {
+		w, _ := serveJSON[HistoricalResponse](t, HistoricalHandler, "/weather/historical?lat=50&lon=10&"+query)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"cycloid/test/geocoder"
+	"cycloid/test/history"
+	"cycloid/test/provider"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is a forecast of a provider for the requested day, as issued
+// at IssuedAt, LeadDays before the day.
+type HistoryEntry struct {
+	IssuedAt time.Time             `json:"issued_at"`
+	LeadDays int                   `json:"lead_days"`
+	Timezone string                `json:"timezone"`
+	Forecast provider.ForecastData `json:"forecast"`
+}
+
+// HistoryResponse is the /weather/history response: by provider, the
+// forecasts issued for a day, oldest first.
+type HistoryResponse struct {
+	Location  geocoder.Location         `json:"location"`
+	Date      string                    `json:"date"`
+	Units     provider.UnitLabels       `json:"units"`
+	Providers map[string][]HistoryEntry `json:"providers"`
+}
+
+// DefaultHistoryRetention is how long the days of the forecast history are
+// kept.
+const DefaultHistoryRetention = 90 * 24 * time.Hour
+
+// consensusName is the provider name the consensus is recorded under in the
+// history, as what the API showed.
+const consensusName = "consensus"
+
+// SetupHistory opens the forecast history at path, keeping the days of the
+// last retention. Forecasts are not kept when path is empty.
+func SetupHistory(path string, retention time.Duration) error {
+	if path == "" {
+		return nil
+	}
+	store, err := history.Open(path)
+	if err != nil {
+		return err
+	}
+	settings.history = store
+	settings.historyRetention = retention
+	return nil
+}
+
+// pruneHistory deletes the days of the history older than its retention.
+func pruneHistory() error {
+	if settings.historyRetention <= 0 {
+		return nil
+	}
+	before := settings.Clock.Now().UTC().Add(-settings.historyRetention).Format(time.DateOnly)
+	deleted, err := settings.history.Prune(before)
+	if deleted > 0 {
+		log.Printf("history: pruned %d forecasts before %s", deleted, before)
+	}
+	return err
+}
+
+// recordConsensus stores the consensus of a forecast request in the history,
+// at most once per forecastTTL for the location, timezone and providers.
+func recordConsensus(req *weatherRequest, data provider.ProviderForecast) {
+	if settings.history == nil || len(data) == 0 {
+		return
+	}
+	key := forecastKey(consensusName+"/"+strings.Join(sortedKeys(data), ","), req.lat, req.lon, req.loc)
+	if _, ok := settings.recordedConsensus.get(key, settings.Clock.Now()); ok {
+		return
+	}
+	settings.recordedConsensus.put(key, struct{}{}, settings.Clock.Now())
+	recordForecast(consensusName, req.lat, req.lon, req.loc, consensus(data))
+}
+
+// recordForecast queues the forecast a provider returned to be stored in the
+// history, logging when the queue is full rather than slowing the request.
+func recordForecast(name, lat, lon string, loc *time.Location, data provider.ForecastDay) {
+	if settings.history == nil {
+		return
+	}
+	latf, _ := strconv.ParseFloat(lat, 64)
+	lonf, _ := strconv.ParseFloat(lon, 64)
+	issuedAt := settings.Clock.Now().UTC()
+
+	records := make([]history.Record, 0, len(data))
+	for date, values := range data {
+		records = append(records, history.Record{
+			Provider: name,
+			Lat:      latf,
+			Lon:      lonf,
+			Timezone: loc.String(),
+			IssuedAt: issuedAt,
+			Date:     date,
+			Values:   values,
+		})
+	}
+	if !settings.history.Enqueue(records) {
+		log.Printf("history queue full, dropped the forecast of %s", name)
+	}
+}
+
+// HistoryHandler serves /weather/history, how the forecasts for the date
+// parameter evolved across the times they were fetched. It takes the location,
+// units and providers parameters of /weather; without providers, every
+// provider that forecast the day is listed.
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if settings.history == nil {
+		http.Error(w, "Forecast history is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	params := queryParams(r)
+	req, err := resolveWeatherRequest(ctx, params)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	records, err := settings.history.Forecasts(req.latf, req.lonf, date)
+	if err != nil {
+		http.Error(w, "Failed to read forecast history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	selected := make(map[string]bool, len(req.providers))
+	for _, p := range req.providers {
+		selected[p.Name()] = true
+	}
+
+	response := HistoryResponse{
+		Location:  echoLocation(req),
+		Date:      date,
+		Units:     req.units.Labels(),
+		Providers: make(map[string][]HistoryEntry),
+	}
+	for _, record := range records {
+		if params.Providers != "" && !selected[record.Provider] {
+			continue
+		}
+		converted := req.units.ConvertDays(provider.ForecastDay{date: record.Values})
+		response.Providers[record.Provider] = append(response.Providers[record.Provider], HistoryEntry{
+			IssuedAt: record.IssuedAt,
+			LeadDays: record.LeadDays(),
+			Timezone: record.Timezone,
+			Forecast: converted[date],
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cycloid/test/history"
+	"cycloid/test/provider"
+)
+
+func useHistory(t *testing.T) {
+	t.Helper()
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("failed to open history: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	settings.history = store
+}
+
+func TestHistoryHandler_ForecastDrift(t *testing.T) {
+	defer resetSettings()
+	useHistory(t)
+
+	clock := provider.NewFakeClock(time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC))
+	useClock(clock)
+	mock := &mockProvider{name: "mock", data: forecastWindow(20)}
+	other := &mockProvider{name: "other", data: forecastWindow(25)}
+	settings.Providers = []provider.WeatherProvider{mock, other}
+	settings.APILimit = 1
+
+	if _, _, err := aggregateForecast(context.Background(), "50", "10", time.UTC, settings.Providers); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clock.Advance(24 * time.Hour)
+	mock.data = forecastWindow(22)
+	if _, _, err := aggregateForecast(context.Background(), "50", "10", time.UTC, settings.Providers[:1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	settings.history.Flush()
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/history?lat=50.001&lon=10&date=2024-08-03&units=imperial&providers=mock", nil)
+	w := httptest.NewRecorder()
+	HistoryHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", w.Code, w.Body)
+	}
+	var result HistoryResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	if _, ok := result.Providers["other"]; ok {
+		t.Errorf("expected only the requested provider, got %+v", result.Providers)
+	}
+	entries := result.Providers["mock"]
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 forecasts, got %+v", entries)
+	}
+	if entries[0].LeadDays != 2 || entries[0].Forecast.Temperature != 68 {
+		t.Errorf("unexpected first forecast: %+v", entries[0])
+	}
+	if entries[1].LeadDays != 1 || !entries[1].IssuedAt.Equal(time.Date(2024, 8, 2, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected second forecast: %+v", entries[1])
+	}
+}
+
+func TestHistoryHandler_Invalid(t *testing.T) {
+	defer resetSettings()
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/history?lat=50&lon=10&date=2024-08-03", nil)
+	w := httptest.NewRecorder()
+	HistoryHandler(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without history, got %d", w.Code)
+	}
+
+	useHistory(t)
+	req = httptest.NewRequest(http.MethodGet, "/weather/history?lat=50&lon=10&date=tomorrow", nil)
+	w = httptest.NewRecorder()
+	HistoryHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+}
+
+func TestCollectForecast_RecordsConsensus(t *testing.T) {
+	defer resetSettings()
+	useHistory(t)
+
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)))
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "mock", data: provider.ForecastDay{"2024-08-03": {Temperature: 20}}},
+		&mockProvider{name: "other", data: provider.ForecastDay{"2024-08-03": {Temperature: 24}}},
+	}
+	settings.APILimit = 1
+
+	req := &weatherRequest{lat: "50", lon: "10", latf: 50, lonf: 10, loc: time.UTC, providers: settings.Providers}
+	collectForecast(context.Background(), req)
+	// the same consensus is recorded once per forecastTTL
+	collectForecast(context.Background(), req)
+	settings.history.Flush()
+
+	records, err := settings.history.Forecasts(50, 10, "2024-08-03")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var recorded []history.Record
+	for _, r := range records {
+		if r.Provider == consensusName {
+			recorded = append(recorded, r)
+		}
+	}
+	if len(recorded) != 1 || recorded[0].Values.Temperature != 22 {
+		t.Errorf("expected the consensus once, got %+v", recorded)
+	}
+}
+
+func TestStreamHandler_RecordsConsensus(t *testing.T) {
+	defer resetSettings()
+	useHistory(t)
+
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)))
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "mock", data: provider.ForecastDay{"2024-08-03": {Temperature: 20}}},
+		&mockProvider{name: "other", data: provider.ForecastDay{"2024-08-03": {Temperature: 24}}},
+	}
+	settings.APILimit = 1
+
+	StreamHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/weather/stream?lat=50&lon=10&tz=UTC", nil))
+	settings.history.Flush()
+
+	records, err := settings.history.Forecasts(50, 10, "2024-08-03")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var recorded []history.Record
+	for _, r := range records {
+		if r.Provider == consensusName {
+			recorded = append(recorded, r)
+		}
+	}
+	if len(recorded) != 1 || recorded[0].Values.Temperature != 22 {
+		t.Errorf("expected the consensus of the stream, got %+v", recorded)
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	defer resetSettings()
+	useHistory(t)
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 10, 6, 0, 0, 0, time.UTC)))
+	settings.historyRetention = 7 * 24 * time.Hour
+
+	issued := time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)
+	err := settings.history.Add([]history.Record{
+		{Provider: "mock", Lat: 50, Lon: 10, Timezone: "UTC", IssuedAt: issued, Date: "2024-08-02", Values: provider.ForecastData{Temperature: 20}},
+		{Provider: "mock", Lat: 50, Lon: 10, Timezone: "UTC", IssuedAt: issued, Date: "2024-08-03", Values: provider.ForecastData{Temperature: 21}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := pruneHistory(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if records, _ := settings.history.Forecasts(50, 10, "2024-08-02"); len(records) != 0 {
+		t.Errorf("expected the day before the retention to be pruned, got %+v", records)
+	}
+	if records, _ := settings.history.Forecasts(50, 10, "2024-08-03"); len(records) != 1 {
+		t.Errorf("expected the day within the retention to be kept, got %+v", records)
+	}
+}
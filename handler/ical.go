@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"context"
+	"cycloid/test/provider"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calendarRefresh is how often calendar clients are asked to refresh the feed.
+const calendarRefresh = time.Hour
+
+// icalWriter builds an RFC 5545 document, folding long lines and ending them
+// with CRLF.
+type icalWriter struct {
+	b strings.Builder
+}
+
+func (c *icalWriter) line(name, value string) {
+	line := name + ":" + value
+	// lines are folded at 75 octets, the leading space of continuations
+	// included, without splitting UTF-8 sequences
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		c.b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	c.b.WriteString(line + "\r\n")
+}
+
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func (c *icalWriter) text(name, value string) {
+	c.line(name, icalTextEscaper.Replace(value))
+}
+
+// conditions describes a day in words from its canonical precipitation and wind speed.
+func conditions(day provider.ForecastData) string {
+	var words []string
+	if day.Precipitation != nil {
+		switch rain := *day.Precipitation; {
+		case rain >= 10:
+			words = append(words, "heavy rain")
+		case rain >= 1:
+			words = append(words, "rain")
+		case rain >= 0.2:
+			words = append(words, "light rain")
+		default:
+			words = append(words, "dry")
+		}
+	}
+	// Beaufort 6, strong breeze
+	if day.WindSpeed != nil && *day.WindSpeed >= 10.8 {
+		words = append(words, "windy")
+	}
+	return strings.Join(words, ", ")
+}
+
+func formatValue(value float64, label string) string {
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + label
+}
+
+// eventSummary is the title of a day: max and min temperature and conditions.
+func eventSummary(canonical, day provider.ForecastData, labels provider.UnitLabels) string {
+	summary := formatValue(day.Temperature, labels.Temperature)
+	if day.TemperatureMin != nil {
+		summary += " / " + formatValue(*day.TemperatureMin, labels.Temperature)
+	}
+	if words := conditions(canonical); words != "" {
+		summary += ", " + words
+	}
+	return summary
+}
+
+// eventDescription details the consensus and the value of every provider.
+func eventDescription(date string, day provider.ForecastData, data provider.ProviderForecast, labels provider.UnitLabels) string {
+	lines := []string{"Max " + formatValue(day.Temperature, labels.Temperature)}
+	if day.TemperatureMin != nil {
+		lines = append(lines, "Min "+formatValue(*day.TemperatureMin, labels.Temperature))
+	}
+	if day.Precipitation != nil {
+		lines = append(lines, "Precipitation "+formatValue(*day.Precipitation, labels.Precipitation))
+	}
+	if day.WindSpeed != nil {
+		lines = append(lines, "Wind "+formatValue(*day.WindSpeed, labels.WindSpeed))
+	}
+	if day.Pressure != nil {
+		lines = append(lines, "Pressure "+formatValue(*day.Pressure, labels.Pressure))
+	}
+	lines = append(lines, "", "Providers:")
+	for _, name := range sortedKeys(data) {
+		if providerDay, ok := data[name][date]; ok {
+			lines = append(lines, name+": "+formatValue(providerDay.Temperature, labels.Temperature))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// eventUID identifies the event of a day at a location, rounded to about a
+// kilometre, so refreshed feeds update the events in place.
+func eventUID(date string, lat, lon float64) string {
+	return fmt.Sprintf("%s%+.2f%+.2f@weather", strings.ReplaceAll(date, "-", ""), lat, lon)
+}
+
+// calendar renders the consensus of data as one all-day event per day.
+func calendar(req *weatherRequest, data provider.ProviderForecast, now time.Time) string {
+	name := fmt.Sprintf("Weather forecast for %s, %s", req.lat, req.lon)
+	if req.location != nil {
+		name = "Weather forecast for " + req.location.Name
+	} else if req.place != nil {
+		name = "Weather forecast near " + req.place.Name
+	}
+
+	labels := req.units.Labels()
+	canonical := consensus(data)
+	converted := req.units.ConvertDays(canonical)
+	convertedData := req.units.Convert(data)
+	stamp := now.UTC().Format("20060102T150405Z")
+	refresh := "PT" + strconv.Itoa(int(calendarRefresh.Hours())) + "H"
+
+	var c icalWriter
+	c.line("BEGIN", "VCALENDAR")
+	c.line("VERSION", "2.0")
+	c.line("PRODID", "-//cycloid//weather forecast//EN")
+	c.line("CALSCALE", "GREGORIAN")
+	c.line("METHOD", "PUBLISH")
+	c.text("NAME", name)
+	c.text("X-WR-CALNAME", name)
+	c.line("X-WR-TIMEZONE", req.loc.String())
+	c.line("REFRESH-INTERVAL;VALUE=DURATION", refresh)
+	c.line("X-PUBLISHED-TTL", refresh)
+
+	for _, date := range sortedKeys(converted) {
+		start, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			continue
+		}
+		c.line("BEGIN", "VEVENT")
+		c.line("UID", eventUID(date, req.latf, req.lonf))
+		c.line("DTSTAMP", stamp)
+		c.line("LAST-MODIFIED", stamp)
+		c.line("DTSTART;VALUE=DATE", start.Format("20060102"))
+		c.line("DTEND;VALUE=DATE", start.AddDate(0, 0, 1).Format("20060102"))
+		c.text("SUMMARY", eventSummary(canonical[date], converted[date], labels))
+		c.text("DESCRIPTION", eventDescription(date, converted[date], convertedData, labels))
+		c.line("GEO", fmt.Sprintf("%s;%s", strconv.FormatFloat(req.latf, 'f', -1, 64), strconv.FormatFloat(req.lonf, 'f', -1, 64)))
+		c.line("TRANSP", "TRANSPARENT")
+		c.line("END", "VEVENT")
+	}
+	c.line("END", "VCALENDAR")
+	return c.b.String()
+}
+
+// CalendarHandler serves /weather.ics, the consensus forecast as an
+// iCalendar feed. It takes the /weather parameters and, like /v2/weather,
+// skips failing providers.
+func CalendarHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	req, err := resolveWeatherRequest(ctx, queryParams(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	_, data := collectForecast(ctx, req)
+	if len(data) == 0 {
+		http.Error(w, "No provider returned a forecast", http.StatusBadGateway)
+		return
+	}
+
+	annotate(w, req.loc, req.place)
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(calendarRefresh.Seconds())))
+	w.Write([]byte(calendar(req, data, settings.Clock.Now())))
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+)
+
+func TestCalendarHandler(t *testing.T) {
+	defer resetSettings()
+
+	useClock(provider.NewFakeClock(time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)))
+	tmin, rain := 12.0, 4.0
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "first", data: provider.ForecastDay{
+			"2024-08-01": {Temperature: 20.0, TemperatureMin: &tmin, Precipitation: &rain},
+			"2024-08-02": {Temperature: 25.0},
+		}},
+		&mockProvider{name: "second", data: provider.ForecastDay{"2024-08-01": {Temperature: 24.0}}},
+	}
+	settings.APILimit = 1
+	settings.Geocoder = &mockGeocoder{locations: []geocoder.Location{berlin}}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather.ics?q=Berlin", nil)
+	w := httptest.NewRecorder()
+
+	CalendarHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/calendar; charset=utf-8" {
+		t.Errorf("unexpected content type %q", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("unexpected Cache-Control %q", got)
+	}
+
+	body := w.Body.String()
+	for _, line := range []string{
+		"BEGIN:VCALENDAR",
+		"X-WR-CALNAME:Weather forecast for Berlin",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT1H",
+		"UID:20240801+52.52+13.41@weather",
+		"DTSTAMP:20240801T060000Z",
+		"DTSTART;VALUE=DATE:20240801",
+		"DTEND;VALUE=DATE:20240802",
+		`SUMMARY:22.0 °C / 12.0 °C\, rain`,
+		"SUMMARY:25.0 °C",
+		"END:VCALENDAR",
+	} {
+		if !strings.Contains(body, line+"\r\n") {
+			t.Errorf("expected line %q in calendar:\n%s", line, body)
+		}
+	}
+	if n := strings.Count(body, "BEGIN:VEVENT"); n != 2 {
+		t.Errorf("expected 2 events, got %d", n)
+	}
+}
+
+func TestCalendarHandler_AllProvidersFailed(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "bad", err: http.ErrHandlerTimeout}}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/weather.ics?lat=50&lon=10", nil)
+	w := httptest.NewRecorder()
+
+	CalendarHandler(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", w.Code)
+	}
+}
+
+func TestICalWriter_Folding(t *testing.T) {
+	var c icalWriter
+	c.text("DESCRIPTION", strings.Repeat("é", 100)+"; done")
+
+	lines := strings.Split(strings.TrimSuffix(c.b.String(), "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("expected folded lines, got %q", lines)
+	}
+	for i, line := range lines {
+		if len(line) > 75 {
+			t.Errorf("line %d is %d octets long", i, len(line))
+		}
+		if i > 0 && !strings.HasPrefix(line, " ") {
+			t.Errorf("continuation line %d does not start with a space", i)
+		}
+	}
+	unfolded := strings.ReplaceAll(c.b.String(), "\r\n ", "")
+	if !strings.HasSuffix(unfolded, `\; done`+"\r\n") {
+		t.Errorf("expected escaped text, got %q", unfolded)
+	}
+}
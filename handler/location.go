@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cycloid/test/geocoder"
+)
+
+type AmbiguousLocation struct {
+	Error      string              `json:"error"`
+	Candidates []geocoder.Location `json:"candidates"`
+}
+
+// requestError is a client error in the parameters of a forecast request,
+// carrying the status of its response and, for ambiguous place queries, the
+// candidates to choose from.
+type requestError struct {
+	status     int
+	message    string
+	candidates []geocoder.Location
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func badRequest(message string) error {
+	return &requestError{status: http.StatusBadRequest, message: message}
+}
+
+// statusOf returns the response status of an error returned while resolving
+// or aggregating a forecast request.
+func statusOf(err error) int {
+	var re *requestError
+	if errors.As(err, &re) {
+		return re.status
+	}
+	if errors.Is(err, errCircuitOpen) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// writeRequestError writes the response of an error returned while resolving
+// a forecast request.
+func writeRequestError(w http.ResponseWriter, err error) {
+	var re *requestError
+	if errors.As(err, &re) && re.candidates != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(re.status)
+		json.NewEncoder(w).Encode(AmbiguousLocation{
+			Error:      re.message,
+			Candidates: re.candidates,
+		})
+		return
+	}
+	http.Error(w, err.Error(), statusOf(err))
+}
+
+// geocode resolves a place query, failing when the query matches no place or
+// several of them.
+func geocode(ctx context.Context, query string) (*geocoder.Location, error) {
+	if settings.Geocoder == nil {
+		return nil, badRequest("Location search is not configured")
+	}
+
+	locations, err := settings.Geocoder.Search(ctx, query)
+	if errors.Is(err, geocoder.ErrNotFound) {
+		return nil, &requestError{status: http.StatusNotFound, message: "Location not found"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve location: %w", err)
+	}
+
+	if len(locations) > 1 {
+		return nil, &requestError{
+			status:     http.StatusMultipleChoices,
+			message:    "Ambiguous location",
+			candidates: locations,
+		}
+	}
+	return &locations[0], nil
+}
+
+// coordinates parses lat and lon or, when set, takes those of the resolved location.
+func coordinates(lat, lon string, location *geocoder.Location) (string, string, float64, float64, error) {
+	if location != nil {
+		lat = strconv.FormatFloat(location.Lat, 'f', -1, 64)
+		lon = strconv.FormatFloat(location.Lon, 'f', -1, 64)
+		return lat, lon, location.Lat, location.Lon, nil
+	}
+
+	if lat == "" {
+		return "", "", 0, 0, badRequest("Missing latitude")
+	}
+	latf, err := strconv.ParseFloat(lat, 64)
+	if latf < -90 || latf > 90 || err != nil {
+		return "", "", 0, 0, badRequest("Invalid latitude")
+	}
+	if lon == "" {
+		return "", "", 0, 0, badRequest("Missing longitude")
+	}
+	lonf, err := strconv.ParseFloat(lon, 64)
+	if lonf < -180 || lonf > 180 || err != nil {
+		return "", "", 0, 0, badRequest("Invalid longitude")
+	}
+	return lat, lon, latf, lonf, nil
+}
+
+// localize returns the timezone defining the forecast days and the place
+// nearest to the point when the reverse geocoder is configured. The timezone is
+// the tz query parameter unless it is empty or "auto", then the one of the
+// resolved location or the reverse geocoder, and UTC when neither knows it.
+func localize(lat, lon float64, location *geocoder.Location, tz string) (*time.Location, *geocoder.Place, error) {
+	zone := ""
+	if location != nil {
+		zone = location.Timezone
+	}
+	if tz != "" && tz != "auto" {
+		zone = tz
+	}
+
+	var place *geocoder.Place
+	if settings.ReverseGeocoder != nil {
+		if p, err := settings.ReverseGeocoder.Reverse(lat, lon); err == nil {
+			place = &p
+			if zone == "" {
+				zone = p.Timezone
+			}
+		}
+	}
+
+	if tz != "" && tz != "auto" {
+		if tz == "Local" {
+			return nil, nil, fmt.Errorf("server local timezone is not allowed")
+		}
+		loc, err := time.LoadLocation(tz)
+		return loc, place, err
+	}
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return loc, place, nil
+}
+
+// annotate describes the forecast location in response headers, leaving the
+// body shape unchanged.
+func annotate(w http.ResponseWriter, loc *time.Location, place *geocoder.Place) {
+	w.Header().Set("X-Timezone", loc.String())
+	if place != nil {
+		w.Header().Set("X-Place-Name", place.Name)
+		w.Header().Set("X-Place-Country", place.CountryCode)
+	}
+}
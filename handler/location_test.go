@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+)
+
+type mockGeocoder struct {
+	locations []geocoder.Location
+	err       error
+}
+
+func (m *mockGeocoder) Search(ctx context.Context, query string) ([]geocoder.Location, error) {
+	return m.locations, m.err
+}
+
+type mockReverseGeocoder struct {
+	place geocoder.Place
+}
+
+func (m *mockReverseGeocoder) Reverse(lat, lon float64) (geocoder.Place, error) {
+	return m.place, nil
+}
+
+var berlin = geocoder.Location{Name: "Berlin", Country: "Germany", CountryCode: "DE", Lat: 52.52, Lon: 13.41, Timezone: "Europe/Berlin"}
+
+func TestWeatherHandler_Query(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{
+			name: "goodProvider",
+			data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}},
+		},
+	}
+	settings.APILimit = 1
+	settings.Geocoder = &mockGeocoder{locations: []geocoder.Location{berlin}}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?q=Berlin", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+
+	var result LocatedForecast
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if result.Location == nil || result.Location.Name != "Berlin" || result.Location.Timezone != "Europe/Berlin" {
+		t.Errorf("unexpected location: %+v", result.Location)
+	}
+	if _, ok := result.Forecast["goodProvider"]; !ok {
+		t.Errorf("expected 'goodProvider' key in forecast")
+	}
+}
+
+func TestWeatherHandler_QueryAmbiguous(t *testing.T) {
+	defer resetSettings()
+
+	other := berlin
+	other.CountryCode = "US"
+	settings.Geocoder = &mockGeocoder{locations: []geocoder.Location{berlin, other}}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?q=Berlin", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusMultipleChoices {
+		t.Fatalf("expected 300 Multiple Choices, got %d", w.Code)
+	}
+
+	var result AmbiguousLocation
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(result.Candidates) != 2 {
+		t.Errorf("expected 2 candidates, got %d", len(result.Candidates))
+	}
+}
+
+func TestWeatherHandler_QueryNotFound(t *testing.T) {
+	defer resetSettings()
+
+	settings.Geocoder = &mockGeocoder{err: geocoder.ErrNotFound}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?q=Atlantis", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found, got %d", w.Code)
+	}
+}
+
+func TestWeatherHandler_QueryWithCoordinates(t *testing.T) {
+	defer resetSettings()
+
+	settings.Geocoder = &mockGeocoder{locations: []geocoder.Location{berlin}}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?q=Berlin&lat=50&lon=10", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+}
+
+func TestWeatherHandler_ReverseGeocoded(t *testing.T) {
+	defer resetSettings()
+
+	p := &mockProvider{
+		name: "goodProvider",
+		data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}},
+	}
+	settings.Providers = []provider.WeatherProvider{p}
+	settings.APILimit = 1
+	settings.ReverseGeocoder = &mockReverseGeocoder{
+		place: geocoder.Place{Location: geocoder.Location{Name: "Oslo", CountryCode: "NO", Timezone: "Europe/Oslo"}},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=59.91&lon=10.75", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if w.Header().Get("X-Place-Name") != "Oslo" || w.Header().Get("X-Place-Country") != "NO" {
+		t.Errorf("unexpected place headers: %v", w.Header())
+	}
+	if w.Header().Get("X-Timezone") != "Europe/Oslo" {
+		t.Errorf("unexpected timezone header: %s", w.Header().Get("X-Timezone"))
+	}
+	if p.loc == nil || p.loc.String() != "Europe/Oslo" {
+		t.Errorf("expected provider to be called with Europe/Oslo, got %v", p.loc)
+	}
+
+	var result provider.ProviderForecast
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if _, ok := result["goodProvider"]; !ok {
+		t.Errorf("expected unchanged response shape, got %v", result)
+	}
+}
+
+func TestLocalize_DefaultsToUTC(t *testing.T) {
+	defer resetSettings()
+
+	loc, place, err := localize(50, 10, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loc != time.UTC || place != nil {
+		t.Errorf("expected UTC without place, got %v, %+v", loc, place)
+	}
+}
+
+func TestWeatherHandler_ExplicitTimezone(t *testing.T) {
+	defer resetSettings()
+
+	p := &mockProvider{
+		name: "goodProvider",
+		data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}},
+	}
+	settings.Providers = []provider.WeatherProvider{p}
+	settings.APILimit = 1
+	settings.ReverseGeocoder = &mockReverseGeocoder{
+		place: geocoder.Place{Location: geocoder.Location{Name: "Oslo", CountryCode: "NO", Timezone: "Europe/Oslo"}},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=59.91&lon=10.75&tz=America/New_York", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if p.loc == nil || p.loc.String() != "America/New_York" {
+		t.Errorf("expected provider to be called with America/New_York, got %v", p.loc)
+	}
+	if w.Header().Get("X-Timezone") != "America/New_York" || w.Header().Get("X-Place-Name") != "Oslo" {
+		t.Errorf("unexpected headers: %v", w.Header())
+	}
+}
+
+func TestWeatherHandler_AutoTimezone(t *testing.T) {
+	defer resetSettings()
+
+	p := &mockProvider{name: "goodProvider"}
+	settings.Providers = []provider.WeatherProvider{p}
+	settings.APILimit = 1
+	settings.ReverseGeocoder = &mockReverseGeocoder{
+		place: geocoder.Place{Location: geocoder.Location{Name: "Oslo", CountryCode: "NO", Timezone: "Europe/Oslo"}},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=59.91&lon=10.75&tz=auto", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if p.loc == nil || p.loc.String() != "Europe/Oslo" {
+		t.Errorf("expected provider to be called with Europe/Oslo, got %v", p.loc)
+	}
+}
+
+func TestWeatherHandler_InvalidTimezone(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "goodProvider"}}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=50&lon=10&tz=Mars/Olympus_Mons", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+}
@@ -0,0 +1,648 @@
+package handler
+
+import (
+	"bytes"
+	"cmp"
+	"cycloid/test/provider"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// openAPIDocument is the committed OpenAPI 3 description of the API, served as
+// is. TestOpenAPI_UpToDate fails when it no longer matches buildOpenAPI, run
+// `go test ./handler -run TestOpenAPI -update` to regenerate it.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+//go:embed docs.html
+var docsTemplate string
+
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := docsPage()
+	if err != nil {
+		http.Error(w, "Failed to render the docs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+type docsResponse struct {
+	Code        string
+	Description string
+}
+
+type docsOperation struct {
+	openAPIOperation
+	Method, Path string
+	// FormMethod is the method of the try-it form when scripts are off.
+	FormMethod string
+	Responses  []docsResponse
+}
+
+// docsPage renders the docs page from openAPIDocument: every operation with
+// its parameters and responses, and a form to try it.
+var docsPage = sync.OnceValues(func() ([]byte, error) {
+	var spec openAPISpec
+	if err := json.Unmarshal(openAPIDocument, &spec); err != nil {
+		return nil, err
+	}
+
+	var operations []docsOperation
+	for path, methods := range spec.Paths {
+		for method, op := range methods {
+			operation := docsOperation{openAPIOperation: op, Method: method, Path: path, FormMethod: "post"}
+			if method == "get" {
+				operation.FormMethod = "get"
+			}
+			for code, response := range op.Responses {
+				operation.Responses = append(operation.Responses, docsResponse{code, response.Description})
+			}
+			slices.SortFunc(operation.Responses, func(a, b docsResponse) int { return cmp.Compare(a.Code, b.Code) })
+			operations = append(operations, operation)
+		}
+	}
+	slices.SortFunc(operations, func(a, b docsOperation) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Method, b.Method))
+	})
+
+	schemas, err := json.MarshalIndent(spec.Components.Schemas, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := template.New("docs").Parse(docsTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = page.Execute(&buf, map[string]any{
+		"Title":       spec.Info.Title,
+		"Version":     spec.Info.Version,
+		"Description": spec.Info.Description,
+		"Operations":  operations,
+		"Schemas":     string(schemas),
+	})
+	return buf.Bytes(), err
+})
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*openAPISchema          `json:"oneOf,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	OperationID string                     `json:"operationId"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPISpec struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Version     string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*openAPISchema `json:"schemas"`
+	} `json:"components"`
+}
+
+// openAPIEnums lists the values of the string types with a closed set of values.
+var openAPIEnums = map[reflect.Type][]string{
+	reflect.TypeFor[provider.Units](): {string(provider.UnitsMetric), string(provider.UnitsImperial), string(provider.UnitsSI)},
+}
+
+// schemaBuilder derives JSON schemas from Go types the way encoding/json
+// encodes them, collecting named structs and maps as components.
+type schemaBuilder struct {
+	components map[string]*openAPISchema
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) *openAPISchema {
+	if t == reflect.TypeFor[time.Time]() {
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	}
+	if t == reflect.TypeFor[json.RawMessage]() {
+		// any JSON value
+		return &openAPISchema{}
+	}
+	if values, ok := openAPIEnums[t]; ok {
+		return &openAPISchema{Type: "string", Enum: values}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schema(t.Elem())
+		if s.Ref != "" {
+			return &openAPISchema{OneOf: []*openAPISchema{s}, Nullable: true}
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int32:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Int64:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &openAPISchema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return b.component(t, func() *openAPISchema {
+			return &openAPISchema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+		})
+	case reflect.Struct:
+		return b.component(t, func() *openAPISchema {
+			s := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+			b.fields(t, s)
+			return s
+		})
+	}
+	// interfaces and anything encoding/json decides at run time
+	return &openAPISchema{}
+}
+
+// component registers named types once under components/schemas and refers to them.
+func (b *schemaBuilder) component(t reflect.Type, build func() *openAPISchema) *openAPISchema {
+	if t.Name() == "" {
+		return build()
+	}
+	if _, ok := b.components[t.Name()]; !ok {
+		b.components[t.Name()] = nil // breaks recursion
+		b.components[t.Name()] = build()
+	}
+	return &openAPISchema{Ref: "#/components/schemas/" + t.Name()}
+}
+
+// fields adds the JSON properties of a struct, inlining embedded structs.
+func (b *schemaBuilder) fields(t reflect.Type, s *openAPISchema) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			b.fields(field.Type, s)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		// omitted rather than null when empty
+		omitempty, ft := strings.Contains(options, "omitempty"), field.Type
+		if omitempty && ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		s.Properties[name] = b.schema(ft)
+		if !omitempty {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func queryParameter(name, description string, schema *openAPISchema) openAPIParameter {
+	return openAPIParameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func requiredParameter(parameter openAPIParameter) openAPIParameter {
+	parameter.Required = true
+	return parameter
+}
+
+func pathParameter(name, description string) openAPIParameter {
+	return openAPIParameter{Name: name, In: "path", Description: description, Required: true, Schema: &openAPISchema{Type: "string"}}
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+// weatherParameters are the query parameters shared by the forecast endpoints.
+func weatherParameters(b *schemaBuilder) []openAPIParameter {
+	return []openAPIParameter{
+		queryParameter("lat", "Latitude in degrees, required unless q is set.",
+			&openAPISchema{Type: "number", Minimum: bound(-90), Maximum: bound(90)}),
+		queryParameter("lon", "Longitude in degrees, required unless q is set.",
+			&openAPISchema{Type: "number", Minimum: bound(-180), Maximum: bound(180)}),
+		queryParameter("q", "Place name or postal code, optionally followed by a comma and a country (Berlin,DE).",
+			&openAPISchema{Type: "string"}),
+		queryParameter("tz", "IANA timezone defining the forecast days, or auto to derive it from the location.",
+			&openAPISchema{Type: "string"}),
+		queryParameter("units", "Units of the returned values.", b.schema(reflect.TypeFor[provider.Units]())),
+		queryParameter("providers", "Comma separated provider names to use, or to exclude when prefixed with -.",
+			&openAPISchema{Type: "string"}),
+	}
+}
+
+// formatParameter selects the representation of the responses supporting
+// tabularResponse, also negotiable with the Accept header.
+func formatParameter() openAPIParameter {
+	return queryParameter("format", "Response format, overriding the Accept header.",
+		&openAPISchema{Type: "string", Enum: []string{string(formatJSON), string(formatCSV), string(formatNDJSON), string(formatGeoJSON)}})
+}
+
+// tabularResponse adds the CSV, NDJSON and GeoJSON representations to a JSON response.
+func tabularResponse(b *schemaBuilder, response openAPIResponse) openAPIResponse {
+	response.Content["text/csv"] = openAPIMediaType{Schema: &openAPISchema{Type: "string"}}
+	response.Content["application/x-ndjson"] = openAPIMediaType{Schema: b.schema(reflect.TypeFor[ForecastRow]())}
+	response.Content["application/geo+json"] = openAPIMediaType{Schema: b.schema(reflect.TypeFor[FeatureCollection]())}
+	return response
+}
+
+func jsonResponse(description string, schema *openAPISchema) openAPIResponse {
+	return openAPIResponse{
+		Description: description,
+		Content:     map[string]openAPIMediaType{"application/json": {Schema: schema}},
+	}
+}
+
+func textResponse(description string) openAPIResponse {
+	return openAPIResponse{
+		Description: description,
+		Content:     map[string]openAPIMediaType{"text/plain": {Schema: &openAPISchema{Type: "string"}}},
+	}
+}
+
+// buildOpenAPI describes every endpoint, deriving the response schemas from
+// the types the handlers encode.
+func buildOpenAPI() openAPISpec {
+	b := &schemaBuilder{components: make(map[string]*openAPISchema)}
+
+	var spec openAPISpec
+	spec.OpenAPI = "3.0.3"
+	spec.Info.Title = "Weather aggregation API"
+	spec.Info.Description = "Daily forecasts aggregated from several weather providers."
+	spec.Info.Version = EnvelopeVersion + ".0.0"
+
+	errorResponses := map[string]openAPIResponse{
+		"300": jsonResponse("The place query matches several places.", b.schema(reflect.TypeFor[AmbiguousLocation]())),
+		"400": textResponse("Invalid parameters, or no provider covers the location."),
+		"404": textResponse("The place query matches no place."),
+	}
+	withErrors := func(responses map[string]openAPIResponse) map[string]openAPIResponse {
+		for status, response := range errorResponses {
+			responses[status] = response
+		}
+		return responses
+	}
+
+	spec.Paths = map[string]map[string]openAPIOperation{
+		"/weather": {"get": {
+			Summary: "Forecast from every selected provider",
+			Description: "Returns the forecast keyed by provider and date, wrapped with the resolved location when q is set. " +
+				"Providers are called concurrently and the request fails when any of them fails. " +
+				"The X-Timezone, X-Units, X-Place-Name and X-Place-Country headers describe the response, " +
+				"X-Skipped-Providers lists the providers skipped because their circuit is open.",
+			OperationID: "getWeather",
+			Parameters:  append(weatherParameters(b), formatParameter()),
+			Responses: withErrors(map[string]openAPIResponse{
+				"200": tabularResponse(b, jsonResponse("Forecast by provider, a row per provider and day in CSV and NDJSON.", &openAPISchema{OneOf: []*openAPISchema{
+					b.schema(reflect.TypeFor[provider.ProviderForecast]()),
+					b.schema(reflect.TypeFor[LocatedForecast]()),
+				}})),
+				"500": textResponse("A provider failed."),
+			}),
+		}},
+		"/v2/weather": {"get": {
+			Summary:     "Forecast envelope with provider status and consensus",
+			Description: "Providers are called concurrently; failing ones are reported in providers instead of failing the request.",
+			OperationID: "getWeatherV2",
+			Parameters:  weatherParameters(b),
+			Responses: withErrors(map[string]openAPIResponse{
+				"200": jsonResponse("Forecast envelope.", b.schema(reflect.TypeFor[WeatherEnvelope]())),
+				"502": jsonResponse("No provider returned a forecast.", b.schema(reflect.TypeFor[WeatherEnvelope]())),
+			}),
+		}},
+		"/weather/batch": {"post": {
+			Summary: "Forecasts for many locations in one call",
+			Description: "Every location gets the result /weather would have returned for it. " +
+				"JSON results are in request order, CSV and NDJSON rows are streamed as locations complete. " +
+				"Locations still pending at the batch timeout fail with status 504.",
+			OperationID: "postWeatherBatch",
+			Parameters:  []openAPIParameter{formatParameter()},
+			RequestBody: &openAPIRequestBody{
+				Required: true,
+				Content:  map[string]openAPIMediaType{"application/json": {Schema: b.schema(reflect.TypeFor[BatchRequest]())}},
+			},
+			Responses: map[string]openAPIResponse{
+				"200": tabularResponse(b, jsonResponse("A result per location.", b.schema(reflect.TypeFor[BatchResponse]()))),
+				"400": textResponse("Invalid body, units or format."),
+				"413": textResponse("More locations than the batch limit."),
+			},
+		}},
+		"/weather.ics": {"get": {
+			Summary: "Consensus forecast as an iCalendar feed",
+			Description: "One all-day event per day with the consensus max and min temperature and conditions. " +
+				"Event UIDs are stable for a location and day, so subscribed calendars update them in place.",
+			OperationID: "getWeatherCalendar",
+			Parameters:  weatherParameters(b),
+			Responses: withErrors(map[string]openAPIResponse{
+				"200": {Description: "RFC 5545 calendar.", Content: map[string]openAPIMediaType{"text/calendar": {Schema: &openAPISchema{Type: "string"}}}},
+				"502": textResponse("No provider returned a forecast."),
+			}),
+		}},
+		"/weather/stream": {"get": {
+			Summary: "Forecast streamed as Server-Sent Events",
+			Description: "Sends a request event with the resolved request, a provider event per provider as soon as it returns " +
+				"and a final consensus event. Providers still pending after the API deadline are reported as failed.",
+			OperationID: "getWeatherStream",
+			Parameters:  weatherParameters(b),
+			Responses: withErrors(map[string]openAPIResponse{
+				"200": {Description: "Event stream; the data of each event is one of the listed schemas, by event name.", Content: map[string]openAPIMediaType{"text/event-stream": {Schema: &openAPISchema{OneOf: []*openAPISchema{
+					b.schema(reflect.TypeFor[RequestEcho]()),
+					b.schema(reflect.TypeFor[StreamProviderEvent]()),
+					b.schema(reflect.TypeFor[StreamConsensusEvent]()),
+				}}}}},
+			}),
+		}},
+		"/weather/current": {"get": {
+			Summary: "Current conditions from every selected provider",
+			Description: "Returns the current temperature, feels-like temperature, wind, humidity, pressure and condition of the " +
+				"providers that report them, with their consensus. Providers are called concurrently and their answers reused for " +
+				"5 minutes at a location; providers without current conditions are reported as skipped.",
+			OperationID: "getWeatherCurrent",
+			Parameters:  weatherParameters(b),
+			Responses: withErrors(map[string]openAPIResponse{
+				"200": jsonResponse("Current conditions by provider.", b.schema(reflect.TypeFor[CurrentResponse]())),
+				"502": jsonResponse("No provider returned current conditions.", b.schema(reflect.TypeFor[CurrentResponse]())),
+			}),
+		}},
+		"/weather/historical": {"get": {
+			Summary: "Weather of past days from provider archives",
+			Description: "Returns the days from start to end, up to 366 past days, of the providers with an archive, in the forecast " +
+				"shape, with their consensus. Ranges are fetched in chunks the provider accepts and the days are cached since they " +
+				"never change; days an archive has not published yet are left out. Providers without an archive are reported as skipped.",
+			OperationID: "getWeatherHistorical",
+			Parameters: append(weatherParameters(b),
+				requiredParameter(queryParameter("start", "First day, YYYY-MM-DD.", &openAPISchema{Type: "string", Format: "date"})),
+				requiredParameter(queryParameter("end", "Last day, YYYY-MM-DD, before today.", &openAPISchema{Type: "string", Format: "date"})),
+			),
+			Responses: withErrors(map[string]openAPIResponse{
+				"200": jsonResponse("Past days by provider.", b.schema(reflect.TypeFor[HistoricalResponse]())),
+				"502": jsonResponse("No provider returned any day.", b.schema(reflect.TypeFor[HistoricalResponse]())),
+			}),
+		}},
+		"/airquality": {"get": {
+			Summary: "Air quality from every selected provider",
+			Description: "Returns PM2.5, PM10, ozone and nitrogen dioxide in µg/m³, the US and European air quality indexes with " +
+				"their categories and pollen in grains/m³ where available, by provider, with their consensus. Indexes a provider does " +
+				"not report are computed from its pollutants. Providers are called concurrently and their answers reused for 15 minutes " +
+				"at a location; providers without air quality are reported as skipped.",
+			OperationID: "getAirQuality",
+			// lat, lon, q, tz and providers
+			Parameters: append(weatherParameters(b)[:4], weatherParameters(b)[5]),
+			Responses: withErrors(map[string]openAPIResponse{
+				"200": jsonResponse("Air quality by provider.", b.schema(reflect.TypeFor[AirQualityResponse]())),
+				"502": jsonResponse("No provider returned air quality.", b.schema(reflect.TypeFor[AirQualityResponse]())),
+			}),
+		}},
+		"/alerts": {"get": {
+			Summary: "Severe weather alerts in effect at a location",
+			Description: "Returns the government alerts of the sources covering the location: the NWS when configured, for the " +
+				"United States, and the providers relaying alerts. Severity and urgency are normalized to the CAP values and an alert " +
+				"reported by several sources, matched by event and effective time, is listed once with all of them.",
+			OperationID: "getSevereAlerts",
+			// lat, lon and q
+			Parameters: weatherParameters(b)[:3],
+			Responses: withErrors(map[string]openAPIResponse{
+				"200": jsonResponse("Alerts, most severe first.", b.schema(reflect.TypeFor[SevereAlertsResponse]())),
+				"502": jsonResponse("Every source failed.", b.schema(reflect.TypeFor[SevereAlertsResponse]())),
+			}),
+		}},
+		"/weather/history": {"get": {
+			Summary: "How the forecasts for a day evolved",
+			Description: "Every forecast fetched from a provider is kept with its issue time. Returns, by provider, the forecasts " +
+				"issued for the date at the location, oldest first. Locations match to 0.01°.",
+			OperationID: "getWeatherHistory",
+			Parameters:  append(weatherParameters(b), requiredParameter(queryParameter("date", "Forecast day, YYYY-MM-DD.", &openAPISchema{Type: "string", Format: "date"}))),
+			Responses: withErrors(map[string]openAPIResponse{
+				"200": jsonResponse("Forecasts by provider.", b.schema(reflect.TypeFor[HistoryResponse]())),
+				"500": textResponse("The history could not be read."),
+				"503": textResponse("The history is disabled."),
+			}),
+		}},
+		"/providers": {"get": {
+			Summary:     "Configured providers with their capabilities and health",
+			OperationID: "getProviders",
+			Responses: map[string]openAPIResponse{
+				"200": jsonResponse("Providers.", b.schema(reflect.TypeFor[[]ProviderInfo]())),
+			},
+		}},
+		"/sources": {"get": {
+			Summary:     "Configured alert and air quality sources with their health",
+			OperationID: "getSources",
+			Responses: map[string]openAPIResponse{
+				"200": jsonResponse("Sources.", b.schema(reflect.TypeFor[[]SourceInfo]())),
+			},
+		}},
+		"/subscriptions": {
+			"post": {
+				Summary: "Subscribe a webhook to forecast changes",
+				Description: "The location is resolved like in /weather. Every subscription interval, the consensus forecast is " +
+					"refreshed and the values that changed by at least their threshold since the last push are posted to the webhook, " +
+					"signed in the X-Webhook-Signature header with the secret returned here only, over the X-Webhook-Timestamp " +
+					"header, a dot and the body. Receivers should reject timestamps more than 5 minutes away from their clock.",
+				OperationID: "createSubscription",
+				RequestBody: &openAPIRequestBody{
+					Required: true,
+					Content:  map[string]openAPIMediaType{"application/json": {Schema: b.schema(reflect.TypeFor[SubscriptionRequest]())}},
+				},
+				Responses: withErrors(map[string]openAPIResponse{
+					"201": jsonResponse("The subscription, with its secret.", b.schema(reflect.TypeFor[Subscription]())),
+					"429": textResponse("The 1000 subscriptions are taken."),
+				}),
+			},
+			"get": {
+				Summary:     "List the subscriptions",
+				OperationID: "listSubscriptions",
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("Subscriptions in creation order.", b.schema(reflect.TypeFor[[]Subscription]())),
+				},
+			},
+		},
+		"/subscriptions/{id}": {
+			"get": {
+				Summary:     "Get a subscription",
+				OperationID: "getSubscription",
+				Parameters:  []openAPIParameter{pathParameter("id", "Subscription ID.")},
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("The subscription.", b.schema(reflect.TypeFor[Subscription]())),
+					"404": textResponse("No such subscription."),
+				},
+			},
+			"delete": {
+				Summary:     "Delete a subscription",
+				OperationID: "deleteSubscription",
+				Parameters:  []openAPIParameter{pathParameter("id", "Subscription ID.")},
+				Responses: map[string]openAPIResponse{
+					"204": {Description: "Deleted."},
+					"404": textResponse("No such subscription."),
+				},
+			},
+		},
+		"/subscriptions/{id}/dead-letters": {"get": {
+			Summary:     "Webhook deliveries of a subscription that failed every retry",
+			Description: "The payloads are those of the webhook. The latest 50 failed deliveries are kept.",
+			OperationID: "getDeadLetters",
+			Parameters:  []openAPIParameter{pathParameter("id", "Subscription ID.")},
+			Responses: map[string]openAPIResponse{
+				"200": jsonResponse("Failed deliveries, oldest first.", b.schema(reflect.TypeFor[[]DeadLetter]())),
+				"404": textResponse("No such subscription."),
+			},
+		}},
+		"/alert-rules": {
+			"post": {
+				Summary: "Add an alert rule",
+				Description: "The rule fires when at least min_agreement providers forecast the variable compared to the threshold " +
+					"(gt, gte, lt or lte, in the rule units) on one of the horizon days starting today. " +
+					"Rules are evaluated every alert interval; an event is sent to the sinks once per day while the condition holds.",
+				OperationID: "createAlertRule",
+				RequestBody: &openAPIRequestBody{
+					Required: true,
+					Content:  map[string]openAPIMediaType{"application/json": {Schema: b.schema(reflect.TypeFor[AlertRule]())}},
+				},
+				Responses: withErrors(map[string]openAPIResponse{
+					"201": jsonResponse("The rule with its defaults.", b.schema(reflect.TypeFor[AlertRule]())),
+				}),
+			},
+			"get": {
+				Summary:     "List the alert rules",
+				OperationID: "listAlertRules",
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("Rules ordered by ID, those of the config included.", b.schema(reflect.TypeFor[[]AlertRule]())),
+				},
+			},
+		},
+		"/alert-rules/{id}": {
+			"get": {
+				Summary:     "Get an alert rule",
+				OperationID: "getAlertRule",
+				Parameters:  []openAPIParameter{pathParameter("id", "Rule ID.")},
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("The rule.", b.schema(reflect.TypeFor[AlertRule]())),
+					"404": textResponse("No such rule."),
+				},
+			},
+			"delete": {
+				Summary:     "Delete an alert rule",
+				OperationID: "deleteAlertRule",
+				Parameters:  []openAPIParameter{pathParameter("id", "Rule ID.")},
+				Responses: map[string]openAPIResponse{
+					"204": {Description: "Deleted."},
+					"404": textResponse("No such rule."),
+				},
+			},
+		},
+		"/alert-events": {"get": {
+			Summary:     "Latest alert events",
+			Description: "The latest 200 events fired by the alert rules.",
+			OperationID: "getAlertEvents",
+			Responses: map[string]openAPIResponse{
+				"200": jsonResponse("Events, oldest first.", b.schema(reflect.TypeFor[[]AlertEvent]())),
+			},
+		}},
+		"/accuracy": {"get": {
+			Summary: "Accuracy of the providers against the observed weather",
+			Description: "Past days of the forecast history are compared with observations every verification interval. " +
+				"The days of a location are observed in the timezone of each forecast, so forecasts in different timezones are scored against their own days. " +
+				"Days the archive does not report within a week are retried a few times, then not scored. " +
+				"Scores are by provider, region (country code), variable and lead time, with errors in canonical units. " +
+				"With the weighted consensus, providers are weighted by the inverse of their mean absolute error.",
+			OperationID: "getAccuracy",
+			Parameters: []openAPIParameter{
+				queryParameter("provider", "Only the scores of this provider.", &openAPISchema{Type: "string"}),
+				queryParameter("region", "Only the scores of this region.", &openAPISchema{Type: "string"}),
+				queryParameter("variable", "Only the scores of this variable.", &openAPISchema{Type: "string"}),
+				queryParameter("lead_days", "Only the scores of forecasts issued this many days ahead.", &openAPISchema{Type: "integer", Minimum: bound(0)}),
+			},
+			Responses: map[string]openAPIResponse{
+				"200": jsonResponse("Scores of the last verification.", b.schema(reflect.TypeFor[AccuracyReport]())),
+				"400": textResponse("Invalid lead_days."),
+			},
+		}},
+		"/docs": {"get": {
+			Summary:     "Interactive documentation of this API",
+			OperationID: "getDocs",
+			Responses: map[string]openAPIResponse{
+				"200": {Description: "HTML page.", Content: map[string]openAPIMediaType{"text/html": {Schema: &openAPISchema{Type: "string"}}}},
+			},
+		}},
+		"/openapi.json": {"get": {
+			Summary:     "This document",
+			OperationID: "getOpenAPI",
+			Responses: map[string]openAPIResponse{
+				"200": jsonResponse("OpenAPI 3 document.", &openAPISchema{Type: "object"}),
+			},
+		}},
+	}
+	spec.Components.Schemas = b.components
+
+	return spec
+}
+
+func marshalOpenAPI(spec openAPISpec) ([]byte, error) {
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
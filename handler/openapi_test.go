@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite openapi.json from the handler types")
+
+func TestOpenAPI_UpToDate(t *testing.T) {
+	data, err := marshalOpenAPI(buildOpenAPI())
+	if err != nil {
+		t.Fatalf("failed to marshal spec: %v", err)
+	}
+
+	if *update {
+		if err := os.WriteFile("openapi.json", data, 0o644); err != nil {
+			t.Fatalf("failed to write openapi.json: %v", err)
+		}
+		return
+	}
+
+	if !bytes.Equal(data, openAPIDocument) {
+		t.Fatal("openapi.json is out of date with the handler types, run `go test ./handler -run TestOpenAPI -update`")
+	}
+}
+
+func TestOpenAPI_SchemasResolve(t *testing.T) {
+	spec := buildOpenAPI()
+
+	data, _ := json.Marshal(spec)
+	var refs []string
+	var walk func(any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				refs = append(refs, ref)
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	var document any
+	json.Unmarshal(data, &document)
+	walk(document)
+
+	for _, ref := range refs {
+		name := ref[len("#/components/schemas/"):]
+		if spec.Components.Schemas[name] == nil {
+			t.Errorf("unresolved reference %s", ref)
+		}
+	}
+
+	envelope := spec.Components.Schemas["WeatherEnvelope"]
+	if envelope == nil || envelope.Properties["consensus"] == nil || envelope.Properties["generated_at"].Format != "date-time" {
+		t.Errorf("unexpected WeatherEnvelope schema: %+v", envelope)
+	}
+	day := spec.Components.Schemas["ForecastData"]
+	if len(day.Required) != 1 || day.Required[0] != "temperature" {
+		t.Errorf("expected only temperature to be required, got %v", day.Required)
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	w := httptest.NewRecorder()
+
+	OpenAPIHandler(w, req)
+
+	var document map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&document); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if document["openapi"] != "3.0.3" {
+		t.Errorf("unexpected openapi version: %v", document["openapi"])
+	}
+}
+
+func TestDocsHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/docs", nil)
+	w := httptest.NewRecorder()
+
+	DocsHandler(w, req)
+
+	if w.Header().Get("Content-Type") != "text/html; charset=utf-8" || !bytes.Contains(w.Body.Bytes(), []byte("/openapi.json")) {
+		t.Errorf("unexpected docs page: %s", w.Header().Get("Content-Type"))
+	}
+	// the operations are rendered on the server, each with a try-it form
+	for _, fragment := range []string{
+		`<form method="get" action="/weather"`,
+		`<form method="post" action="/weather/batch"`,
+		`<select name="units">`,
+	} {
+		if !bytes.Contains(w.Body.Bytes(), []byte(fragment)) {
+			t.Errorf("expected %q in the docs page", fragment)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"cycloid/test/provider"
+)
+
+// ProviderInfo describes a provider. Health is that of its forecast, and
+// Circuits that of its other APIs, by circuit key.
+type ProviderInfo struct {
+	Name         string                    `json:"name"`
+	Capabilities provider.Capabilities     `json:"capabilities"`
+	Health       ProviderHealth            `json:"health"`
+	Circuits     map[string]ProviderHealth `json:"circuits,omitempty"`
+}
+
+func ProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	result := make([]ProviderInfo, 0, len(settings.Providers))
+	for _, p := range settings.Providers {
+		info := ProviderInfo{
+			Name:         p.Name(),
+			Capabilities: p.Capabilities(),
+			Health:       settings.health.health(p.Name()),
+		}
+		for _, key := range providerCircuits(p) {
+			if info.Circuits == nil {
+				info.Circuits = make(map[string]ProviderHealth)
+			}
+			info.Circuits[key] = settings.health.health(key)
+		}
+		result = append(result, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// SourceInfo describes a source of the sources section, with the health of
+// its APIs by circuit key.
+type SourceInfo struct {
+	Name         string                    `json:"name"`
+	Capabilities *provider.Capabilities    `json:"capabilities,omitempty"`
+	Circuits     map[string]ProviderHealth `json:"circuits"`
+}
+
+func sourceInfo(name string, source any, api string) SourceInfo {
+	info := SourceInfo{Name: name, Circuits: make(map[string]ProviderHealth)}
+	if described, ok := source.(interface{ Capabilities() provider.Capabilities }); ok {
+		capabilities := described.Capabilities()
+		info.Capabilities = &capabilities
+	}
+	key := circuitKey(name, api)
+	info.Circuits[key] = settings.health.health(key)
+	return info
+}
+
+// SourcesHandler serves GET /sources, the alert then air quality sources
+// with their live health.
+func SourcesHandler(w http.ResponseWriter, r *http.Request) {
+	result := make([]SourceInfo, 0, len(settings.alertSources)+len(settings.airQualitySources))
+	for _, source := range settings.alertSources {
+		result = append(result, sourceInfo(source.Name(), source, apiAlerts))
+	}
+	for _, source := range settings.airQualitySources {
+		result = append(result, sourceInfo(source.Name(), source, apiAirQuality))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cycloid/test/provider"
+)
+
+func TestProvidersHandler(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "goodProvider"},
+		&mockProvider{name: "badProvider", err: errors.New("fetch error")},
+	}
+	settings.APILimit = 1
+
+	WeatherHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/weather?lat=50&lon=10", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/providers", nil)
+	w := httptest.NewRecorder()
+
+	ProvidersHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+
+	var result []ProviderInfo
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	if len(result) != 2 {
+		t.Fatalf("expected 2 providers, got %d", len(result))
+	}
+	if result[0].Name != "goodProvider" || result[0].Health.Status != "ok" {
+		t.Errorf("unexpected first provider: %+v", result[0])
+	}
+	if result[0].Capabilities.MaxForecastDays != provider.FetchDaysCount {
+		t.Errorf("unexpected capabilities: %+v", result[0].Capabilities)
+	}
+	if result[1].Health.Status != "degraded" || result[1].Health.LastError != "fetch error" {
+		t.Errorf("unexpected second provider: %+v", result[1])
+	}
+}
+
+func TestProvidersHandler_APICircuits(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+
+	p := &mockAPIProvider{mockProvider: mockProvider{name: "a", data: provider.ForecastDay{"2024-08-01": {Temperature: 20}}, err: errors.New("boom")}}
+	settings.Providers = []provider.WeatherProvider{p}
+	for range circuitFailureThreshold {
+		serveJSON[AirQualityResponse](t, AirQualityHandler, "/airquality?lat=50&lon=10")
+	}
+
+	w := httptest.NewRecorder()
+	ProvidersHandler(w, httptest.NewRequest(http.MethodGet, "/providers", nil))
+	var result []ProviderInfo
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if health := result[0].Health; health.Circuit != circuitClosed || health.Status != "unknown" {
+		t.Errorf("expected the forecast circuit untouched, got %+v", health)
+	}
+	if health := result[0].Circuits["a/airquality"]; health.Circuit != circuitOpen {
+		t.Errorf("expected the air quality circuit open, got %+v", result[0].Circuits)
+	}
+	if _, ok := result[0].Circuits["a/current"]; !ok || len(result[0].Circuits) != 3 {
+		t.Errorf("expected the circuits of the 3 APIs, got %+v", result[0].Circuits)
+	}
+}
+
+func TestSourcesHandler(t *testing.T) {
+	defer resetSettings()
+
+	if err := SetupSources(map[string]map[string]any{"nws": {}, "openmeteoairquality": {}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	settings.health.record(circuitKey("NWS", apiAlerts), errors.New("fetch error"))
+
+	w := httptest.NewRecorder()
+	SourcesHandler(w, httptest.NewRequest(http.MethodGet, "/sources", nil))
+
+	var result []SourceInfo
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("expected 2 sources, got %+v", result)
+	}
+	if nws := result[0]; nws.Name != "NWS" || nws.Circuits["NWS/alerts"].LastError != "fetch error" {
+		t.Errorf("unexpected alert source: %+v", nws)
+	}
+	if aq := result[1]; aq.Name != "OpenMeteoAirQuality" || aq.Capabilities == nil || aq.Circuits["OpenMeteoAirQuality/airquality"].Status != "unknown" {
+		t.Errorf("unexpected air quality source: %+v", aq)
+	}
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+// DefaultRateLimit is the number of forecast calls per second a provider gets
+// when its RateLimit parameter is not set.
+const DefaultRateLimit = 10.0
+
+// rateLimiter is a token bucket of rate calls per second, holding at most a
+// second of calls.
+type rateLimiter struct {
+	mu     sync.Mutex
+	clock  provider.Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(clock provider.Clock, rate float64) *rateLimiter {
+	burst := max(rate, 1)
+	return &rateLimiter{clock: clock, rate: rate, burst: burst, tokens: burst, last: clock.Now()}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel gives back a token reserved but not used.
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(l.burst, l.tokens+1)
+}
+
+// wait blocks until a call is allowed, or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateLimiters holds the rate limiter of every provider, shared by all the
+// requests and batches calling it.
+type rateLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*rateLimiter
+}
+
+func newRateLimiters() *rateLimiters {
+	return &rateLimiters{limiters: make(map[string]*rateLimiter)}
+}
+
+// set limits the calls of a provider to rate per second, or lifts its limit
+// when rate is zero.
+func (r *rateLimiters) set(name string, rate float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rate == 0 {
+		delete(r.limiters, name)
+		return
+	}
+	r.limiters[name] = newRateLimiter(settings.Clock, rate)
+}
+
+// wait blocks until the provider may be called, or ctx is done. Providers
+// without a limiter are not waited for.
+func (r *rateLimiters) wait(ctx context.Context, name string) error {
+	r.mu.Lock()
+	limiter, ok := r.limiters[name]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return limiter.wait(ctx)
+}
+
+// rateLimitParam reads the RateLimit provider parameter, the forecast calls
+// per second, DefaultRateLimit when missing and 0 for no limit.
+func rateLimitParam(value any) (float64, error) {
+	var rate float64
+	switch v := value.(type) {
+	case nil:
+		return DefaultRateLimit, nil
+	case int:
+		rate = float64(v)
+	case float64:
+		rate = v
+	default:
+		return 0, fmt.Errorf("invalid RateLimit %v", value)
+	}
+	if rate < 0 {
+		return 0, fmt.Errorf("invalid RateLimit %v", value)
+	}
+	return rate, nil
+}
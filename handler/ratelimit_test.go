@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	clock := provider.NewFakeClock(time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC))
+	l := newRateLimiter(clock, 2)
+
+	for i := 0; i < 2; i++ {
+		if delay := l.reserve(); delay != 0 {
+			t.Fatalf("call %d: expected no delay within the burst, got %v", i, delay)
+		}
+	}
+	if delay := l.reserve(); delay != 500*time.Millisecond {
+		t.Errorf("expected to wait 500ms past the burst, got %v", delay)
+	}
+
+	clock.Advance(time.Second)
+	if delay := l.reserve(); delay != 0 {
+		t.Errorf("expected a refilled token, got %v", delay)
+	}
+}
+
+func TestRateLimiter_WaitCanceled(t *testing.T) {
+	clock := provider.NewFakeClock(time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC))
+	l := newRateLimiter(clock, 1)
+	l.reserve()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to end the wait, got %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if delay := l.reserve(); delay != 0 {
+		t.Errorf("expected the canceled wait to give its token back, got %v", delay)
+	}
+}
+
+func TestRateLimitParam(t *testing.T) {
+	for _, test := range []struct {
+		value any
+		rate  float64
+		ok    bool
+	}{
+		{nil, DefaultRateLimit, true},
+		{0, 0, true},
+		{5, 5, true},
+		{0.5, 0.5, true},
+		{-1, 0, false},
+		{"fast", 0, false},
+	} {
+		rate, err := rateLimitParam(test.value)
+		if (err == nil) != test.ok || rate != test.rate {
+			t.Errorf("%v: got %v, %v", test.value, rate, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"cycloid/test/provider"
+)
+
+// selectProviders returns the providers covering the point, restricted by the
+// providers query parameter: a comma separated list of names to use, where
+// names prefixed with "-" are excluded instead. Names are case-insensitive.
+func selectProviders(providers []provider.WeatherProvider, lat, lon float64, filter string) ([]provider.WeatherProvider, error) {
+	include := make(map[string]bool)
+	exclude := make(map[string]bool)
+	for _, name := range strings.Split(filter, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "":
+		case strings.HasPrefix(name, "-"):
+			exclude[strings.TrimPrefix(name, "-")] = true
+		default:
+			include[name] = true
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, p := range providers {
+		known[strings.ToLower(p.Name())] = true
+	}
+	for _, names := range []map[string]bool{include, exclude} {
+		for name := range names {
+			if !known[name] {
+				return nil, fmt.Errorf("unknown provider %q", name)
+			}
+		}
+	}
+
+	var selected []provider.WeatherProvider
+	for _, p := range providers {
+		name := strings.ToLower(p.Name())
+		if exclude[name] || (len(include) > 0 && !include[name]) {
+			continue
+		}
+		if !p.Capabilities().Coverage.Contains(lat, lon) {
+			continue
+		}
+		selected = append(selected, p)
+	}
+	return selected, nil
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"testing"
+
+	"cycloid/test/provider"
+)
+
+func selectedNames(providers []provider.WeatherProvider) []string {
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+func TestSelectProviders(t *testing.T) {
+	denmark := provider.Coverage{{BoundingBox: &provider.BoundingBox{MinLat: 54.5, MinLon: 8, MaxLat: 57.8, MaxLon: 15.2}}}
+	providers := []provider.WeatherProvider{
+		&mockProvider{name: "OpenMeteo"},
+		&mockProvider{name: "WeatherAPI"},
+		&mockProvider{name: "dmi", coverage: denmark},
+	}
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		filter   string
+		expected []string
+	}{
+		{"all in coverage", 55.68, 12.57, "", []string{"OpenMeteo", "WeatherAPI", "dmi"}},
+		{"regional skipped", 52.52, 13.41, "", []string{"OpenMeteo", "WeatherAPI"}},
+		{"include", 55.68, 12.57, "openmeteo,DMI", []string{"OpenMeteo", "dmi"}},
+		{"exclude", 55.68, 12.57, "-weatherapi", []string{"OpenMeteo", "dmi"}},
+		{"include outside coverage", 52.52, 13.41, "dmi", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := selectProviders(providers, tt.lat, tt.lon, tt.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			names := selectedNames(selected)
+			if len(names) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, names)
+			}
+			for i := range names {
+				if names[i] != tt.expected[i] {
+					t.Errorf("expected %v, got %v", tt.expected, names)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectProviders_Unknown(t *testing.T) {
+	providers := []provider.WeatherProvider{&mockProvider{name: "OpenMeteo"}}
+
+	if _, err := selectProviders(providers, 0, 0, "-nosuch"); err == nil {
+		t.Fatal("expected an error for unknown provider")
+	}
+}
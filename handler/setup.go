@@ -1,34 +1,169 @@
 package handler
 
 import (
+	"cycloid/test/geocoder"
+	"cycloid/test/history"
 	"cycloid/test/provider"
+	"fmt"
+	"time"
 )
 
 type Settings struct {
-	Providers []provider.WeatherProvider
-	APILimit  int
+	Providers  []provider.WeatherProvider
+	APILimit   int
+	BatchLimit int
+	// BatchTimeout bounds a whole batch, each location having the APILimit.
+	BatchTimeout time.Duration
+	Geocoder     geocoder.Geocoder
+
+	ReverseGeocoder geocoder.ReverseGeocoder
+	Clock           provider.Clock
+
+	health        *healthRegistry
+	limiters      *rateLimiters
+	subscriptions *subscriptionStore
+	webhooks      *webhookDispatcher
+	alerts        *alertStore
+	alertSinks    map[string]AlertSink
+	history       *history.Store
+	// historyRetention is how long the days of the history are kept, all of
+	// them when zero.
+	historyRetention  time.Duration
+	recordedConsensus *ttlCache[struct{}]
+	forecasts         *ttlCache[provider.ForecastDay]
+	current           *ttlCache[provider.CurrentConditions]
+	airQuality        *ttlCache[provider.AirQuality]
+	alertSources      []provider.AlertSource
+	airQualitySources []provider.AirQualityProvider
+	historical        *historicalCache
+
+	observations      provider.ObservationSource
+	accuracy          *accuracyState
+	weightedConsensus bool
 }
 
-var settings Settings
+var settings = Settings{
+	BatchLimit:   DefaultBatchLimit,
+	BatchTimeout: DefaultBatchTimeout,
+	Clock:        provider.SystemClock,
+	health:       newHealthRegistry(provider.SystemClock),
+	limiters:     newRateLimiters(),
+
+	subscriptions:     newSubscriptionStore(),
+	webhooks:          newWebhookDispatcher(false),
+	alerts:            newAlertStore(),
+	alertSinks:        map[string]AlertSink{"log": logSink{}},
+	forecasts:         newTTLCache[provider.ForecastDay](forecastTTL),
+	recordedConsensus: newTTLCache[struct{}](forecastTTL),
+	current:           newTTLCache[provider.CurrentConditions](currentTTL),
+	airQuality:        newTTLCache[provider.AirQuality](airQualityTTL),
+	historical:        newHistoricalCache(),
+
+	observations: provider.NewOpenMeteoArchive(),
+	accuracy:     &accuracyState{},
+}
 
-func setParams(provider provider.WeatherProvider, params map[string]any) {
+func setParams(provider interface{ SetParams(string, any) }, params map[string]any) {
 	for name, param := range params {
 		provider.SetParams(name, param)
 	}
 }
 
-func Setup(apiLimit int, config map[string]map[string]any) {
+func Setup(apiLimit int, config map[string]map[string]any) error {
 	for providerName, providerSettings := range config {
+		if _, err := provider.ParseCoverage(providerSettings["Coverage"]); err != nil {
+			return fmt.Errorf("%s: %w", providerName, err)
+		}
 		switch providerName {
 		case "openmeteo":
-			openmeteo := provider.NewOpenMeteo()
+			openmeteo := provider.NewOpenMeteo(settings.Clock)
 			setParams(openmeteo, providerSettings)
 			settings.Providers = append(settings.Providers, openmeteo)
 		case "weatherapi":
-			weatherapi := provider.NewWeatherAPI()
+			weatherapi := provider.NewWeatherAPI(settings.Clock)
 			setParams(weatherapi, providerSettings)
 			settings.Providers = append(settings.Providers, weatherapi)
+		case "openweathermap":
+			openweathermap := provider.NewOpenWeatherMap(settings.Clock)
+			setParams(openweathermap, providerSettings)
+			settings.Providers = append(settings.Providers, openweathermap)
+		case "nws", "openmeteoairquality":
+			return fmt.Errorf("%s is not a forecast provider, declare it under sources", providerName)
+		default:
+			if providerSettings["Type"] != "generic" {
+				continue
+			}
+			generic := provider.NewGeneric(providerName, settings.Clock)
+			setParams(generic, providerSettings)
+			if err := generic.Validate(); err != nil {
+				return err
+			}
+			settings.Providers = append(settings.Providers, generic)
+		}
+	}
+	for _, p := range settings.Providers {
+		rate, err := rateLimitParam(p.GetParams("RateLimit"))
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Name(), err)
 		}
+		settings.limiters.set(p.Name(), rate)
 	}
 	settings.APILimit = apiLimit
+
+	reverseGeocoder, err := geocoder.NewOffline()
+	if err != nil {
+		return err
+	}
+	settings.ReverseGeocoder = reverseGeocoder
+	return nil
+}
+
+// SetupSources configures the sources of the sources section of the config,
+// which serve alerts or air quality but no forecast.
+func SetupSources(config map[string]map[string]any) error {
+	for name, params := range config {
+		if _, err := provider.ParseCoverage(params["Coverage"]); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		switch name {
+		case "nws":
+			nws := provider.NewNWS()
+			setParams(nws, params)
+			settings.alertSources = append(settings.alertSources, nws)
+		case "openmeteoairquality":
+			settings.airQualitySources = append(settings.airQualitySources, provider.NewOpenMeteoAirQuality())
+		default:
+			return fmt.Errorf("unknown source %s", name)
+		}
+	}
+	return nil
+}
+
+// SetupGeocoder configures location search from the geocoder section of the
+// config. Open-Meteo geocoding is used when the section is missing.
+func SetupGeocoder(config map[string]any) error {
+	switch config["Type"] {
+	case nil, "openmeteo":
+		settings.Geocoder = geocoder.NewOpenMeteo()
+	case "gazetteer":
+		path, _ := config["Path"].(string)
+		if path == "" {
+			return fmt.Errorf("gazetteer geocoder requires a Path")
+		}
+		gazetteer, err := geocoder.LoadGazetteer(path)
+		if err != nil {
+			return err
+		}
+		settings.Geocoder = gazetteer
+	default:
+		return fmt.Errorf("unknown geocoder type %v", config["Type"])
+	}
+	return nil
+}
+
+// SetupBatch sets the maximum number of locations of a batch request and how
+// long a whole batch may take.
+func SetupBatch(limit int, timeout time.Duration) {
+	settings.BatchLimit = limit
+	settings.BatchTimeout = timeout
 }
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"testing"
+)
+
+func TestSetup_GenericProvider(t *testing.T) {
+	defer resetSettings()
+
+	err := Setup(5, map[string]map[string]any{
+		"mysource": {
+			"Type":            "generic",
+			"URL":             "https://example.com/forecast?lat={lat}&lon={lon}",
+			"DatePath":        "daily.time",
+			"TemperaturePath": "daily.temperature_2m_max",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(settings.Providers) != 1 || settings.Providers[0].Name() != "mysource" {
+		t.Fatalf("expected generic provider 'mysource', got %+v", settings.Providers)
+	}
+}
+
+func TestSetup_InvalidGenericProvider(t *testing.T) {
+	defer resetSettings()
+
+	err := Setup(5, map[string]map[string]any{
+		"mysource": {
+			"Type": "generic",
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error for generic provider without URL")
+	}
+}
+
+func TestSetupSources(t *testing.T) {
+	defer resetSettings()
+
+	if err := SetupSources(map[string]map[string]any{"nws": {}, "openmeteoairquality": {}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(settings.Providers) != 0 || len(settings.alertSources) != 1 || len(settings.airQualitySources) != 1 {
+		t.Fatalf("expected sources only, got %+v %+v %+v", settings.Providers, settings.alertSources, settings.airQualitySources)
+	}
+}
+
+func TestSetupSources_Unknown(t *testing.T) {
+	defer resetSettings()
+
+	if err := SetupSources(map[string]map[string]any{"openmeteo": {}}); err == nil {
+		t.Fatal("expected an error for a forecast provider under sources")
+	}
+}
+
+func TestSetup_SourceUnderProviders(t *testing.T) {
+	defer resetSettings()
+
+	if err := Setup(5, map[string]map[string]any{"nws": {}}); err == nil {
+		t.Fatal("expected an error for a source under providers")
+	}
+}
+
+func TestSetup_RateLimit(t *testing.T) {
+	defer resetSettings()
+
+	err := Setup(5, map[string]map[string]any{
+		"openmeteo":  {},
+		"weatherapi": {"apiKey": "key", "RateLimit": 0},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := settings.limiters.limiters["OpenMeteo"]; !ok {
+		t.Error("expected openmeteo to get the default rate limit")
+	}
+	if _, ok := settings.limiters.limiters["WeatherAPI"]; ok {
+		t.Error("expected weatherapi to be unlimited")
+	}
+}
+
+func TestSetup_InvalidRateLimit(t *testing.T) {
+	defer resetSettings()
+
+	if err := Setup(5, map[string]map[string]any{"openmeteo": {"RateLimit": -1}}); err == nil {
+		t.Fatal("expected an error for a negative RateLimit")
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SevereAlertsResponse is the /alerts response: the severe weather alerts in
+// effect at the location, most severe first, each listed once with every
+// source that reported it.
+type SevereAlertsResponse struct {
+	Query       string            `json:"query,omitempty"`
+	Location    geocoder.Location `json:"location"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Sources     []ProviderResult  `json:"sources"`
+	Alerts      []provider.Alert  `json:"alerts"`
+}
+
+// alertSources returns the sources covering a point: the agencies first, then
+// the forecast providers relaying their alerts.
+func alertSources(lat, lon float64) []provider.AlertSource {
+	var sources []provider.AlertSource
+	for _, source := range settings.alertSources {
+		if source.Covers(lat, lon) {
+			sources = append(sources, source)
+		}
+	}
+	for _, p := range settings.Providers {
+		if source, ok := p.(provider.AlertSource); ok && source.Covers(lat, lon) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// fetchAlerts calls an alert source when the circuit of its alerts allows it.
+func fetchAlerts(ctx context.Context, source provider.AlertSource, req *weatherRequest) ([]provider.Alert, error) {
+	circuit := circuitKey(source.Name(), apiAlerts)
+	if !settings.health.allow(circuit) {
+		return nil, fmt.Errorf("%s: %w", circuit, errCircuitOpen)
+	}
+	alerts, err := source.Alerts(ctx, req.lat, req.lon)
+	settings.health.finish(circuit, err)
+	return alerts, err
+}
+
+// alertKey identifies an alert across sources by its event and the minute it
+// takes effect, which relaying sources keep from the issuing agency. Without
+// an effective time, the headline and area tell alerts of the same event
+// apart instead.
+func alertKey(alert provider.Alert) string {
+	event := strings.ToLower(strings.TrimSpace(alert.Event))
+	if alert.Effective.IsZero() {
+		return event + "/" + strings.ToLower(strings.TrimSpace(alert.Headline)) + "/" + strings.ToLower(strings.TrimSpace(alert.Area))
+	}
+	return event + "/" + alert.Effective.UTC().Truncate(time.Minute).Format(time.RFC3339)
+}
+
+// mergeAlerts deduplicates the alerts of the sources, given in source order,
+// and drops the expired ones. The first report of an alert is kept, completed
+// with the fields it lacks and the sources of the others.
+func mergeAlerts(reports [][]provider.Alert, now time.Time) []provider.Alert {
+	merged := make(map[string]*provider.Alert)
+	var keys []string
+	for _, alerts := range reports {
+		for _, alert := range alerts {
+			if alert.Expires != nil && !alert.Expires.After(now) {
+				continue
+			}
+			key := alertKey(alert)
+			first, ok := merged[key]
+			if !ok {
+				sum := sha256.Sum256([]byte(key))
+				alert.ID = hex.EncodeToString(sum[:8])
+				alert.Sources = slices.Clone(alert.Sources)
+				merged[key] = &alert
+				keys = append(keys, key)
+				continue
+			}
+			for _, source := range alert.Sources {
+				if !slices.Contains(first.Sources, source) {
+					first.Sources = append(first.Sources, source)
+				}
+			}
+			first.Headline = cmp.Or(first.Headline, alert.Headline)
+			first.Description = cmp.Or(first.Description, alert.Description)
+			first.Instruction = cmp.Or(first.Instruction, alert.Instruction)
+			first.Area = cmp.Or(first.Area, alert.Area)
+			first.Sender = cmp.Or(first.Sender, alert.Sender)
+			if first.Severity == provider.SeverityUnknown {
+				first.Severity = alert.Severity
+			}
+			if first.Urgency == provider.UrgencyUnknown {
+				first.Urgency = alert.Urgency
+			}
+			if first.Expires == nil {
+				first.Expires = alert.Expires
+			}
+		}
+	}
+
+	result := make([]provider.Alert, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *merged[key])
+	}
+	slices.SortStableFunc(result, func(a, b provider.Alert) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(provider.Severities, a.Severity), slices.Index(provider.Severities, b.Severity)),
+			cmp.Compare(slices.Index(provider.Urgencies, a.Urgency), slices.Index(provider.Urgencies, b.Urgency)),
+			a.Effective.Compare(b.Effective),
+		)
+	})
+	return result
+}
+
+// collectAlerts calls the alert sources covering the location of req
+// concurrently, and returns their outcomes and the merged alerts in effect.
+func collectAlerts(ctx context.Context, req *weatherRequest) ([]ProviderResult, []provider.Alert) {
+	sources := alertSources(req.latf, req.lonf)
+	results := make([]ProviderResult, len(sources))
+	reports := make([][]provider.Alert, len(sources))
+	outcomes := callProviders(ctx, sources, func(ctx context.Context, source provider.AlertSource) ([]provider.Alert, error) {
+		return fetchAlerts(ctx, source, req)
+	})
+	for outcome := range outcomes {
+		results[outcome.index] = outcome.result
+		if outcome.result.Status == ProviderStatusOK {
+			reports[outcome.index] = outcome.data
+		}
+	}
+	return results, mergeAlerts(reports, settings.Clock.Now())
+}
+
+// alertsFailed reports whether every alert source failed, when there are some.
+func alertsFailed(results []ProviderResult) bool {
+	return len(results) > 0 && !slices.ContainsFunc(results, func(result ProviderResult) bool {
+		return result.Status == ProviderStatusOK
+	})
+}
+
+// SevereAlertsHandler serves /alerts, the severe weather alerts of the sources
+// covering the location: the configured agencies and the providers relaying
+// alerts. It answers 502 Bad Gateway, still with the response, when every
+// source failed.
+func SevereAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	params := queryParams(r)
+	req := weatherRequest{query: params.Query}
+	if err := resolvePoint(ctx, params, &req); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	var err error
+	if req.loc, req.place, err = localize(req.latf, req.lonf, req.location, params.Timezone); err != nil {
+		writeRequestError(w, badRequest("Invalid timezone"))
+		return
+	}
+
+	results, alerts := collectAlerts(ctx, &req)
+	response := SevereAlertsResponse{
+		Query:       req.query,
+		Location:    echoLocation(&req),
+		GeneratedAt: settings.Clock.Now().UTC(),
+		Sources:     results,
+		Alerts:      alerts,
+	}
+	writeCollected(w, response, alertsFailed(results))
+}
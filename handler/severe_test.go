@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+// mockAlertSource reports fixed alerts inside its coverage.
+type mockAlertSource struct {
+	name     string
+	alerts   []provider.Alert
+	err      error
+	coverage provider.Coverage
+}
+
+func (m *mockAlertSource) Name() string {
+	return m.name
+}
+
+func (m *mockAlertSource) Covers(lat, lon float64) bool {
+	return m.coverage.Contains(lat, lon)
+}
+
+func (m *mockAlertSource) Alerts(ctx context.Context, lat, lon string) ([]provider.Alert, error) {
+	return m.alerts, m.err
+}
+
+// mockAlertProvider is a forecast provider relaying alerts.
+type mockAlertProvider struct {
+	mockProvider
+	mockAlertSource
+}
+
+func (m *mockAlertProvider) Name() string {
+	return m.mockProvider.Name()
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestSevereAlertsHandler_Deduplicates(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	now := time.Date(2024, 5, 6, 21, 0, 0, 0, time.UTC)
+	useClock(provider.NewFakeClock(now))
+
+	effective := time.Date(2024, 5, 6, 20, 4, 0, 0, time.UTC)
+	settings.alertSources = []provider.AlertSource{&mockAlertSource{name: "agency", alerts: []provider.Alert{
+		{Event: "Tornado Warning", Headline: "Tornado Warning", Severity: provider.SeverityExtreme, Urgency: provider.UrgencyImmediate,
+			Effective: effective, Expires: timePtr(now.Add(time.Hour)), Sources: []string{"agency"}},
+		{Event: "Heat Advisory", Severity: provider.SeverityModerate, Urgency: provider.UrgencyExpected,
+			Effective: effective.Add(-time.Hour), Expires: timePtr(now.Add(-time.Minute)), Sources: []string{"agency"}},
+	}}}
+	settings.Providers = []provider.WeatherProvider{&mockAlertProvider{
+		mockProvider: mockProvider{name: "relay"},
+		mockAlertSource: mockAlertSource{alerts: []provider.Alert{
+			{Event: "Flood Watch", Severity: provider.SeverityModerate, Urgency: provider.UrgencyFuture, Effective: effective, Sources: []string{"relay"}},
+			// the tornado warning again, a few seconds apart and with fewer details
+			{Event: "tornado warning", Severity: provider.SeverityUnknown, Urgency: provider.UrgencyUnknown, Area: "Oklahoma",
+				Effective: effective.Add(20 * time.Second), Sources: []string{"relay"}},
+		}},
+	}}
+
+	w, response := serveJSON[SevereAlertsResponse](t, SevereAlertsHandler, "/alerts?lat=35.47&lon=-97.52")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if len(response.Sources) != 2 || response.Sources[0].Name != "agency" || response.Sources[1].Name != "relay" {
+		t.Errorf("unexpected sources %+v", response.Sources)
+	}
+	if len(response.Alerts) != 2 {
+		t.Fatalf("expected the tornado warning and the flood watch, got %+v", response.Alerts)
+	}
+	tornado := response.Alerts[0]
+	if tornado.Event != "Tornado Warning" || tornado.Severity != provider.SeverityExtreme || tornado.Area != "Oklahoma" {
+		t.Errorf("expected the agency report completed by the relay, got %+v", tornado)
+	}
+	if len(tornado.Sources) != 2 || tornado.ID == "" {
+		t.Errorf("expected both sources and an ID, got %+v", tornado)
+	}
+	if response.Alerts[1].Event != "Flood Watch" {
+		t.Errorf("expected the flood watch second, got %+v", response.Alerts[1])
+	}
+
+	// the same alert keeps its ID
+	_, again := serveJSON[SevereAlertsResponse](t, SevereAlertsHandler, "/alerts?lat=35.47&lon=-97.52")
+	if again.Alerts[0].ID != tornado.ID {
+		t.Errorf("expected a stable ID, got %s and %s", tornado.ID, again.Alerts[0].ID)
+	}
+}
+
+func TestMergeAlerts_WithoutEffective(t *testing.T) {
+	now := time.Date(2024, 5, 6, 21, 0, 0, 0, time.UTC)
+	reports := [][]provider.Alert{
+		{
+			{Event: "Flood Warning", Headline: "Flood Warning for the coast", Area: "Coast", Sources: []string{"a"}},
+			{Event: "Flood Warning", Headline: "Flood Warning for the hills", Area: "Hills", Sources: []string{"a"}},
+		},
+		{{Event: "flood warning", Headline: "Flood Warning for the coast", Area: "Coast", Sources: []string{"b"}}},
+	}
+
+	alerts := mergeAlerts(reports, now)
+
+	if len(alerts) != 2 {
+		t.Fatalf("expected the warnings of both areas, got %+v", alerts)
+	}
+	if alerts[0].Area != "Coast" || len(alerts[0].Sources) != 2 {
+		t.Errorf("expected the coast warning of both sources, got %+v", alerts[0])
+	}
+}
+
+func TestSevereAlertsHandler_Coverage(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	settings.alertSources = []provider.AlertSource{&mockAlertSource{
+		name:     "agency",
+		coverage: provider.Coverage{{BoundingBox: &provider.BoundingBox{MinLat: 24, MinLon: -125, MaxLat: 50, MaxLon: -66}}},
+	}}
+
+	w, response := serveJSON[SevereAlertsResponse](t, SevereAlertsHandler, "/alerts?lat=52.52&lon=13.41")
+
+	if w.Code != http.StatusOK || len(response.Sources) != 0 || len(response.Alerts) != 0 {
+		t.Errorf("expected no source and no alert, got %d %+v", w.Code, response)
+	}
+}
+
+func TestSevereAlertsHandler_AllFailed(t *testing.T) {
+	defer resetSettings()
+	settings.APILimit = 1
+	settings.alertSources = []provider.AlertSource{&mockAlertSource{name: "agency", err: errors.New("boom")}}
+
+	w, response := serveJSON[SevereAlertsResponse](t, SevereAlertsHandler, "/alerts?lat=35.47&lon=-97.52")
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 Bad Gateway, got %d", w.Code)
+	}
+	if response.Sources[0].Status != ProviderStatusError {
+		t.Errorf("unexpected sources %+v", response.Sources)
+	}
+}
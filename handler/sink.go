@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"cycloid/test/provider"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlertSink delivers alert events.
+type AlertSink interface {
+	Send(ctx context.Context, event AlertEvent) error
+}
+
+// SinkConfig configures an alert sink of the config. Type is webhook, log
+// or email; the other fields are those of the type.
+type SinkConfig struct {
+	Type string `yaml:"type"`
+
+	// webhook
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+
+	// email, through an SMTP relay without authentication
+	Host string   `yaml:"host"`
+	Port int      `yaml:"port"`
+	From string   `yaml:"from"`
+	To   []string `yaml:"to"`
+}
+
+func newAlertSink(config SinkConfig) (AlertSink, error) {
+	switch config.Type {
+	case "log":
+		return logSink{}, nil
+	case "webhook":
+		if !strings.HasPrefix(config.URL, "http://") && !strings.HasPrefix(config.URL, "https://") {
+			return nil, fmt.Errorf("webhook sink requires an http or https url")
+		}
+		return webhookSink{url: config.URL, secret: config.Secret, dispatcher: newWebhookDispatcher(true)}, nil
+	case "email":
+		if config.From == "" || len(config.To) == 0 {
+			return nil, fmt.Errorf("email sink requires from and to")
+		}
+		host, port := config.Host, config.Port
+		if host == "" {
+			host = "localhost"
+		}
+		if port == 0 {
+			port = 25
+		}
+		return emailSink{
+			addr: net.JoinHostPort(host, strconv.Itoa(port)),
+			from: config.From,
+			to:   config.To,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", config.Type)
+	}
+}
+
+// alertTitle describes an event in one line.
+func alertTitle(event AlertEvent) string {
+	name := event.RuleName
+	if name == "" {
+		name = event.RuleID
+	}
+	place := event.Location.Name
+	if place == "" {
+		place = fmt.Sprintf("%g, %g", event.Location.Lat, event.Location.Lon)
+	}
+	labels := event.Units.Labels()
+	unit := map[string]string{
+		provider.VariableTemperatureMax: labels.Temperature,
+		provider.VariableTemperatureMin: labels.Temperature,
+		provider.VariableWindSpeed:      labels.WindSpeed,
+		provider.VariablePrecipitation:  labels.Precipitation,
+		provider.VariablePressure:       labels.Pressure,
+	}[event.Variable]
+	return fmt.Sprintf("%s: %s %s %g %s on %s at %s (%d of %d providers)",
+		name, event.Variable, event.Comparator, event.Threshold, unit, event.Date, place, event.Agreement, event.Reporting)
+}
+
+type logSink struct{}
+
+func (logSink) Send(ctx context.Context, event AlertEvent) error {
+	log.Printf("alert %s", alertTitle(event))
+	return nil
+}
+
+// webhookSink posts the event as JSON, signed like subscription webhooks when
+// it has a secret. Its url comes from the config, so it may be private.
+type webhookSink struct {
+	url        string
+	secret     string
+	dispatcher *webhookDispatcher
+}
+
+func (s webhookSink) Send(ctx context.Context, event AlertEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	deliveryID, attempts, err := s.dispatcher.deliver(ctx, s.url, s.secret, payload)
+	if err != nil {
+		return fmt.Errorf("delivery %s failed after %d attempts: %w", deliveryID, attempts, err)
+	}
+	return nil
+}
+
+// emailTimeout bounds the delivery of a mail when the context has no earlier
+// deadline.
+const emailTimeout = 30 * time.Second
+
+// emailSink mails the event through an SMTP relay.
+type emailSink struct {
+	addr string
+	from string
+	to   []string
+}
+
+// sendMail is smtp.SendMail on a connection bound to ctx: it is dialed with
+// ctx and its deadline is that of ctx, or emailTimeout.
+func (s emailSink) sendMail(ctx context.Context, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	// unblock the exchange if ctx is canceled before its deadline
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(s.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s emailSink) Send(ctx context.Context, event AlertEvent) error {
+	body, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return err
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Weather alert "+alertTitle(event)))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(alertTitle(event) + "\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(string(body), "\n", "\r\n") + "\r\n")
+	return s.sendMail(ctx, []byte(msg.String()))
+}
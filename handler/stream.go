@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"cycloid/test/provider"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Events of /weather/stream, in the order they are sent: the request, one per
+// provider as it returns, then the consensus.
+const (
+	eventRequest   = "request"
+	eventProvider  = "provider"
+	eventConsensus = "consensus"
+)
+
+// StreamProviderEvent reports a provider as soon as it returned, with its
+// forecast when it succeeded.
+type StreamProviderEvent struct {
+	ProviderResult
+	Forecast provider.ForecastDay `json:"forecast,omitempty"`
+}
+
+// StreamConsensusEvent ends the stream with the status of every provider and
+// the consensus of the forecasts received.
+type StreamConsensusEvent struct {
+	GeneratedAt time.Time            `json:"generated_at"`
+	Providers   []ProviderResult     `json:"providers"`
+	Consensus   provider.ForecastDay `json:"consensus"`
+}
+
+// writeEvent writes a Server-Sent Event with data encoded as JSON on a single
+// line and flushes it to the client.
+func writeEvent(w http.ResponseWriter, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	flushResponse(w)
+	return nil
+}
+
+// StreamHandler serves /weather/stream, the /v2/weather forecast as
+// Server-Sent Events so clients can render providers as they return. Providers
+// still pending at the APILimit deadline are canceled and reported as failed.
+// Once they all finish, the consensus is recorded in the history like
+// /v2/weather.
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	req, err := resolveWeatherRequest(ctx, queryParams(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	annotate(w, req.loc, req.place)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// keeps reverse proxies from buffering the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent(w, eventRequest, RequestEcho{
+		Query:    req.query,
+		Location: echoLocation(req),
+		Units:    req.units,
+		Labels:   req.units.Labels(),
+		Timezone: req.loc.String(),
+		Days:     provider.ForecastDates(settings.Clock, req.loc),
+	})
+
+	results := make([]ProviderResult, len(req.providers))
+	data := make(provider.ProviderForecast)
+	for outcome := range fetchProviders(ctx, req) {
+		results[outcome.index] = outcome.result
+		event := StreamProviderEvent{ProviderResult: outcome.result}
+		if outcome.result.Status == ProviderStatusOK {
+			data[outcome.result.Name] = outcome.data
+			event.Forecast = req.units.ConvertDays(outcome.data)
+		}
+		if err := writeEvent(w, eventProvider, event); err != nil {
+			// the client is gone, canceling the pending providers
+			return
+		}
+	}
+
+	recordConsensus(req, data)
+
+	writeEvent(w, eventConsensus, StreamConsensusEvent{
+		GeneratedAt: settings.Clock.Now().UTC(),
+		Providers:   results,
+		Consensus:   req.units.ConvertDays(consensus(data)),
+	})
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cycloid/test/provider"
+)
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+func parseEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "event":
+				event.name = value
+			case "data":
+				event.data = value
+			default:
+				t.Fatalf("unexpected line %q", line)
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestStreamHandler_ProvidersInCompletionOrder(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "slow", timeout: 50 * time.Millisecond, data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+		&mockProvider{name: "fast", data: provider.ForecastDay{"2024-08-01": {Temperature: 30.0}}},
+	}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/stream?lat=50&lon=10&units=imperial", nil)
+	w := httptest.NewRecorder()
+
+	StreamHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	events := parseEvents(t, w.Body.String())
+	var names []string
+	for _, event := range events {
+		names = append(names, event.name)
+	}
+	if got := strings.Join(names, ","); got != "request,provider,provider,consensus" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+
+	var first StreamProviderEvent
+	if err := json.Unmarshal([]byte(events[1].data), &first); err != nil {
+		t.Fatalf("invalid provider event: %v", err)
+	}
+	if first.Name != "fast" || first.Status != ProviderStatusOK {
+		t.Errorf("expected the fast provider first, got %+v", first)
+	}
+	if got := first.Forecast["2024-08-01"].Temperature; got != 86.0 {
+		t.Errorf("expected 86 °F, got %.2f", got)
+	}
+
+	var last StreamConsensusEvent
+	if err := json.Unmarshal([]byte(events[3].data), &last); err != nil {
+		t.Fatalf("invalid consensus event: %v", err)
+	}
+	if len(last.Providers) != 2 || last.Providers[0].Name != "slow" {
+		t.Errorf("expected the providers in configuration order, got %+v", last.Providers)
+	}
+	// the median of 20 and 30 °C is 25 °C
+	if got := last.Consensus["2024-08-01"].Temperature; got != 77.0 {
+		t.Errorf("expected consensus 77 °F, got %.2f", got)
+	}
+}
+
+func TestStreamHandler_Deadline(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "good", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+		&mockProvider{name: "hanging", timeout: 10 * time.Second},
+	}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/stream?lat=50&lon=10", nil)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	StreamHandler(w, req)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("expected the stream to end at the deadline, took %v", elapsed)
+	}
+
+	events := parseEvents(t, w.Body.String())
+	last := events[len(events)-1]
+	if last.name != eventConsensus {
+		t.Fatalf("expected the consensus last, got %q", last.name)
+	}
+	var result StreamConsensusEvent
+	if err := json.Unmarshal([]byte(last.data), &result); err != nil {
+		t.Fatalf("invalid consensus event: %v", err)
+	}
+	if result.Providers[1].Status != ProviderStatusError {
+		t.Errorf("expected the hanging provider to fail, got %+v", result.Providers[1])
+	}
+	if got := result.Consensus["2024-08-01"].Temperature; got != 20.0 {
+		t.Errorf("expected consensus 20 °C, got %.2f", got)
+	}
+}
+
+func TestStreamHandler_InvalidRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/weather/stream?lat=50", nil)
+	w := httptest.NewRecorder()
+
+	StreamHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 Bad Request, got %d", w.Code)
+	}
+}
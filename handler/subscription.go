@@ -0,0 +1,458 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"cycloid/test/geocoder"
+	"cycloid/test/provider"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSubscriptionInterval = 10 * time.Minute
+
+	// defaultChangeThreshold is the change of a variable, in the units of the
+	// subscription, that triggers a webhook when none is set for it.
+	defaultChangeThreshold  = 1.0
+	maxSubscriptionBodySize = 1 << 16
+
+	// maxSubscriptions are kept in memory, refreshed every interval.
+	maxSubscriptions = 1000
+)
+
+// forecastVariables reads the variables of a day by name, nil when the day
+// does not have it.
+var forecastVariables = map[string]func(provider.ForecastData) *float64{
+	provider.VariableTemperatureMax: func(day provider.ForecastData) *float64 { return &day.Temperature },
+	provider.VariableTemperatureMin: func(day provider.ForecastData) *float64 { return day.TemperatureMin },
+	provider.VariableWindSpeed:      func(day provider.ForecastData) *float64 { return day.WindSpeed },
+	provider.VariablePrecipitation:  func(day provider.ForecastData) *float64 { return day.Precipitation },
+	provider.VariablePressure:       func(day provider.ForecastData) *float64 { return day.Pressure },
+}
+
+// SubscriptionRequest is the body of POST /subscriptions. The location and
+// options are those of /weather; Variables default to all of them.
+type SubscriptionRequest struct {
+	BatchLocation
+	Units      string             `json:"units,omitempty"`
+	Timezone   string             `json:"tz,omitempty"`
+	Providers  string             `json:"providers,omitempty"`
+	Variables  []string           `json:"variables,omitempty"`
+	Thresholds map[string]float64 `json:"thresholds,omitempty"`
+	WebhookURL string             `json:"webhook_url"`
+}
+
+// Subscription watches the consensus forecast of a location and posts the
+// changes to a webhook. Secret, which signs the webhooks, is only returned
+// when the subscription is created.
+type Subscription struct {
+	ID            string             `json:"id"`
+	Name          string             `json:"name,omitempty"`
+	Location      geocoder.Location  `json:"location"`
+	Units         provider.Units     `json:"units"`
+	Providers     string             `json:"providers,omitempty"`
+	Variables     []string           `json:"variables"`
+	Thresholds    map[string]float64 `json:"thresholds"`
+	WebhookURL    string             `json:"webhook_url"`
+	Secret        string             `json:"secret,omitempty"`
+	CreatedAt     time.Time          `json:"created_at"`
+	LastCheckedAt *time.Time         `json:"last_checked_at,omitempty"`
+	LastPushedAt  *time.Time         `json:"last_pushed_at,omitempty"`
+}
+
+// ForecastChange is a variable of a day that changed by at least its threshold
+// since it was last pushed.
+type ForecastChange struct {
+	Date     string  `json:"date"`
+	Variable string  `json:"variable"`
+	Previous float64 `json:"previous"`
+	Current  float64 `json:"current"`
+}
+
+// WebhookPayload is the body posted to the webhook of a subscription.
+type WebhookPayload struct {
+	Event          string              `json:"event"`
+	SubscriptionID string              `json:"subscription_id"`
+	Name           string              `json:"name,omitempty"`
+	Location       geocoder.Location   `json:"location"`
+	Units          provider.UnitLabels `json:"units"`
+	GeneratedAt    time.Time           `json:"generated_at"`
+	Changes        []ForecastChange    `json:"changes"`
+}
+
+// forecastValues are the values of the subscribed variables by date and variable.
+type forecastValues map[string]map[string]float64
+
+type subscription struct {
+	Subscription
+	secret string
+	params weatherParams
+	// baseline holds the values last pushed, or first seen, for every day
+	baseline    forecastValues
+	deadLetters []DeadLetter
+}
+
+// subscriptionStore keeps the subscriptions in memory.
+type subscriptionStore struct {
+	mu            sync.Mutex
+	subscriptions map[string]*subscription
+}
+
+func newSubscriptionStore() *subscriptionStore {
+	return &subscriptionStore{subscriptions: make(map[string]*subscription)}
+}
+
+// add stores a subscription unless there are maxSubscriptions already.
+func (s *subscriptionStore) add(sub *subscription) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subscriptions) >= maxSubscriptions {
+		return false
+	}
+	s.subscriptions[sub.ID] = sub
+	return true
+}
+
+func (s *subscriptionStore) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.subscriptions[id]
+	delete(s.subscriptions, id)
+	return ok
+}
+
+func (s *subscriptionStore) get(id string) (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return Subscription{}, false
+	}
+	return sub.Subscription, true
+}
+
+// list returns the subscriptions in creation order.
+func (s *subscriptionStore) list() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		result = append(result, sub.Subscription)
+	}
+	slices.SortFunc(result, func(a, b Subscription) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return result
+}
+
+// update records a refresh of a subscription, returning the changes to push
+// and the baseline to commit once they are. Only the values of pushed changes
+// replace their baseline, so slow drifts add up until they pass the
+// threshold. Without changes, the baseline is saved right away for the days
+// first seen.
+func (s *subscriptionStore) update(id string, current forecastValues, now time.Time) ([]ForecastChange, forecastValues, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return nil, nil, false
+	}
+
+	checked := now
+	sub.LastCheckedAt = &checked
+	changes := diffForecast(sub.baseline, current, sub.Thresholds)
+
+	baseline := make(forecastValues, len(current))
+	for date, values := range current {
+		baseline[date] = make(map[string]float64, len(values))
+		for variable, value := range values {
+			previous, ok := sub.baseline[date][variable]
+			if !ok {
+				previous = value
+			}
+			baseline[date][variable] = previous
+		}
+	}
+	for _, change := range changes {
+		baseline[change.Date][change.Variable] = change.Current
+	}
+	if len(changes) == 0 {
+		sub.baseline = baseline
+	}
+	return changes, baseline, true
+}
+
+// commit saves the baseline of changes that were pushed, so that changes whose
+// delivery failed are found again by the next refresh.
+func (s *subscriptionStore) commit(id string, baseline forecastValues, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub, ok := s.subscriptions[id]; ok {
+		pushed := now
+		sub.baseline = baseline
+		sub.LastPushedAt = &pushed
+	}
+}
+
+// snapshot returns what the scheduler needs to refresh the subscriptions.
+func (s *subscriptionStore) snapshot() []subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		result = append(result, subscription{Subscription: sub.Subscription, secret: sub.secret, params: sub.params})
+	}
+	return result
+}
+
+// diffForecast lists, ordered by date and variable, the values of the days
+// in both forecasts that changed by at least their threshold.
+func diffForecast(previous, current forecastValues, thresholds map[string]float64) []ForecastChange {
+	var changes []ForecastChange
+	for _, date := range sortedKeys(current) {
+		for _, variable := range sortedKeys(current[date]) {
+			before, ok := previous[date][variable]
+			if !ok {
+				continue
+			}
+			after := current[date][variable]
+			if math.Abs(after-before) >= thresholds[variable] {
+				changes = append(changes, ForecastChange{Date: date, Variable: variable, Previous: before, Current: after})
+			}
+		}
+	}
+	return changes
+}
+
+// subscribedValues picks the subscribed variables out of a forecast.
+func subscribedValues(forecast provider.ForecastDay, variables []string) forecastValues {
+	values := make(forecastValues, len(forecast))
+	for date, day := range forecast {
+		values[date] = make(map[string]float64, len(variables))
+		for _, variable := range variables {
+			if value := forecastVariables[variable](day); value != nil {
+				values[date][variable] = *value
+			}
+		}
+	}
+	return values
+}
+
+func randomID(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validate checks the webhook and variables of a request, filling in the
+// default variables and thresholds.
+func (r *SubscriptionRequest) validate() error {
+	u, err := url.Parse(r.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return badRequest("Invalid webhook_url")
+	}
+	// hosts are checked again on every delivery, once resolved
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !settings.webhooks.allowPrivate {
+		if err := checkPublicAddress(addr); err != nil {
+			return badRequest("Invalid webhook_url: " + err.Error())
+		}
+	}
+
+	if len(r.Variables) == 0 {
+		r.Variables = sortedKeys(forecastVariables)
+	}
+	for _, variable := range r.Variables {
+		if _, ok := forecastVariables[variable]; !ok {
+			return badRequest("Invalid variable " + variable)
+		}
+	}
+
+	thresholds := make(map[string]float64, len(r.Variables))
+	for _, variable := range r.Variables {
+		thresholds[variable] = defaultChangeThreshold
+	}
+	for variable, threshold := range r.Thresholds {
+		if _, ok := thresholds[variable]; !ok {
+			return badRequest("Threshold of a variable not subscribed to: " + variable)
+		}
+		if threshold <= 0 {
+			return badRequest("Invalid threshold of " + variable)
+		}
+		thresholds[variable] = threshold
+	}
+	r.Thresholds = thresholds
+	return nil
+}
+
+// CreateSubscriptionHandler serves POST /subscriptions. The location is
+// resolved once, so the scheduler does not geocode it again.
+func CreateSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	var body SubscriptionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubscriptionBodySize)).Decode(&body); err != nil {
+		http.Error(w, "Invalid subscription: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := body.validate(); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	params := body.params(BatchRequest{Units: body.Units, Timezone: body.Timezone, Providers: body.Providers})
+	req, err := resolveWeatherRequest(ctx, params)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	// the resolved point and timezone are kept
+	params.Query, params.Lat, params.Lon, params.Timezone = "", req.lat, req.lon, req.loc.String()
+
+	sub := &subscription{
+		Subscription: Subscription{
+			ID:         randomID(8),
+			Name:       body.Name,
+			Location:   echoLocation(req),
+			Units:      req.units,
+			Providers:  body.Providers,
+			Variables:  body.Variables,
+			Thresholds: body.Thresholds,
+			WebhookURL: body.WebhookURL,
+			CreatedAt:  settings.Clock.Now().UTC(),
+		},
+		secret: randomID(32),
+		params: params,
+	}
+	if !settings.subscriptions.add(sub) {
+		http.Error(w, fmt.Sprintf("Too many subscriptions: the limit is %d", maxSubscriptions), http.StatusTooManyRequests)
+		return
+	}
+
+	created := sub.Subscription
+	created.Secret = sub.secret
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/subscriptions/"+created.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// ListSubscriptionsHandler serves GET /subscriptions.
+func ListSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings.subscriptions.list())
+}
+
+// GetSubscriptionHandler serves GET /subscriptions/{id}.
+func GetSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := settings.subscriptions.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
+
+// DeleteSubscriptionHandler serves DELETE /subscriptions/{id}.
+func DeleteSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if !settings.subscriptions.remove(r.PathValue("id")) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshSubscription fetches the forecast of a subscription and pushes the
+// changes since the last successful push. The first refresh only sets the
+// baseline.
+func refreshSubscription(ctx context.Context, sub subscription) error {
+	fetchCtx, cancel := context.WithTimeout(ctx, time.Duration(settings.APILimit)*time.Second)
+	defer cancel()
+
+	req, err := resolveWeatherRequest(fetchCtx, sub.params)
+	if err != nil {
+		return err
+	}
+	req.fresh = true
+	_, data := collectForecast(fetchCtx, req)
+	if len(data) == 0 {
+		return errors.New("no provider returned a forecast")
+	}
+
+	now := settings.Clock.Now().UTC()
+	current := subscribedValues(req.units.ConvertDays(consensus(data)), sub.Variables)
+	changes, baseline, ok := settings.subscriptions.update(sub.ID, current, now)
+	if !ok || len(changes) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(WebhookPayload{
+		Event:          "forecast.changed",
+		SubscriptionID: sub.ID,
+		Name:           sub.Name,
+		Location:       sub.Location,
+		Units:          sub.Units.Labels(),
+		GeneratedAt:    now,
+		Changes:        changes,
+	})
+	if err != nil {
+		return err
+	}
+	deliveryID, attempts, err := settings.webhooks.deliver(ctx, sub.WebhookURL, sub.secret, payload)
+	if err != nil {
+		// kept for the client to replay
+		settings.subscriptions.deadLetter(sub.ID, DeadLetter{
+			DeliveryID: deliveryID,
+			FailedAt:   settings.Clock.Now().UTC(),
+			Attempts:   attempts,
+			Error:      err.Error(),
+			Payload:    payload,
+		})
+		return fmt.Errorf("delivery %s failed after %d attempts: %w", deliveryID, attempts, err)
+	}
+	settings.subscriptions.commit(sub.ID, baseline, settings.Clock.Now().UTC())
+	return nil
+}
+
+// refreshSubscriptions refreshes every subscription, batchConcurrency at a time.
+func refreshSubscriptions(ctx context.Context) {
+	subs := settings.subscriptions.snapshot()
+	for done := range runBatch(ctx, len(subs), func(ctx context.Context, i int) error {
+		return refreshSubscription(ctx, subs[i])
+	}) {
+		if done.value != nil {
+			log.Printf("subscription %s: %v", subs[done.index].ID, done.value)
+		}
+	}
+}
+
+// RunSubscriptions refreshes the subscriptions every interval until ctx is
+// done.
+func RunSubscriptions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		refreshSubscriptions(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
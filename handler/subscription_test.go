@@ -0,0 +1,329 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cycloid/test/provider"
+)
+
+func createSubscription(t *testing.T, body string) (*httptest.ResponseRecorder, Subscription) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	CreateSubscriptionHandler(w, httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(body)))
+	var sub Subscription
+	if w.Code == http.StatusCreated {
+		if err := json.NewDecoder(w.Body).Decode(&sub); err != nil {
+			t.Fatalf("invalid JSON response: %v", err)
+		}
+	}
+	return w, sub
+}
+
+func TestCreateSubscriptionHandler_Limit(t *testing.T) {
+	defer resetSettings()
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "mock"}}
+	settings.APILimit = 1
+
+	for i := 0; i < maxSubscriptions; i++ {
+		settings.subscriptions.add(&subscription{Subscription: Subscription{ID: strconv.Itoa(i)}})
+	}
+
+	w, _ := createSubscription(t, `{"lat": 50, "lon": 10, "webhook_url": "https://example.com/hook"}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 Too Many Requests, got %d", w.Code)
+	}
+	if n := len(settings.subscriptions.list()); n != maxSubscriptions {
+		t.Errorf("expected %d subscriptions, got %d", maxSubscriptions, n)
+	}
+}
+
+func TestCreateSubscriptionHandler_Invalid(t *testing.T) {
+	defer resetSettings()
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "mock"}}
+	settings.APILimit = 1
+
+	for name, body := range map[string]string{
+		"body":      `{`,
+		"webhook":   `{"lat": 50, "lon": 10, "webhook_url": "ftp://example.com"}`,
+		"variable":  `{"lat": 50, "lon": 10, "webhook_url": "http://example.com", "variables": ["humidity"]}`,
+		"threshold": `{"lat": 50, "lon": 10, "webhook_url": "http://example.com", "variables": ["wind_speed"], "thresholds": {"pressure": 2}}`,
+		"location":  `{"lat": 500, "lon": 10, "webhook_url": "http://example.com"}`,
+		"loopback":  `{"lat": 50, "lon": 10, "webhook_url": "http://127.0.0.1:8080/hook"}`,
+		"metadata":  `{"lat": 50, "lon": 10, "webhook_url": "http://169.254.169.254/latest"}`,
+		"ipv6":      `{"lat": 50, "lon": 10, "webhook_url": "http://[::1]/hook"}`,
+	} {
+		if w, _ := createSubscription(t, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestSubscriptionHandlers_Lifecycle(t *testing.T) {
+	defer resetSettings()
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "mock"}}
+	settings.APILimit = 1
+
+	w, created := createSubscription(t, `{"name": "site", "lat": 50, "lon": 10, "units": "imperial", "webhook_url": "https://example.com/hook", "variables": ["temperature_max"], "thresholds": {"temperature_max": 2.5}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("Location") != "/subscriptions/"+created.ID {
+		t.Errorf("unexpected Location %q", w.Header().Get("Location"))
+	}
+	if created.Secret == "" || created.Units != provider.UnitsImperial || created.Thresholds[provider.VariableTemperatureMax] != 2.5 {
+		t.Errorf("unexpected subscription: %+v", created)
+	}
+
+	w = httptest.NewRecorder()
+	ListSubscriptionsHandler(w, httptest.NewRequest(http.MethodGet, "/subscriptions", nil))
+	var list []Subscription
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != created.ID || list[0].Secret != "" {
+		t.Errorf("expected the subscription without its secret, got %+v", list)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/subscriptions/"+created.ID, nil)
+	req.SetPathValue("id", created.ID)
+	w = httptest.NewRecorder()
+	DeleteSubscriptionHandler(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204 No Content, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	GetSubscriptionHandler(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found after delete, got %d", w.Code)
+	}
+}
+
+// webhookRecorder is a webhook that records the payloads it receives and
+// answers with status.
+type webhookRecorder struct {
+	mu         sync.Mutex
+	status     int
+	payloads   []WebhookPayload
+	signatures []string
+	timestamps []string
+	calls      int
+}
+
+func (h *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls++
+	body, _ := io.ReadAll(r.Body)
+	var payload WebhookPayload
+	json.Unmarshal(body, &payload)
+	h.payloads = append(h.payloads, payload)
+	h.signatures = append(h.signatures, r.Header.Get(signatureHeader))
+	h.timestamps = append(h.timestamps, r.Header.Get(timestampHeader))
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+	}
+}
+
+func TestRefreshSubscriptions_PushesChanges(t *testing.T) {
+	defer resetSettings()
+	mock := &mockProvider{name: "mock", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}, "2024-08-02": {Temperature: 22.0}}}
+	settings.Providers = []provider.WeatherProvider{mock}
+	settings.APILimit = 1
+	SetupWebhooks(true)
+
+	hook := &webhookRecorder{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	_, created := createSubscription(t, `{"lat": 50, "lon": 10, "webhook_url": "`+server.URL+`", "variables": ["temperature_max"]}`)
+
+	// the first refresh sets the baseline
+	refreshSubscriptions(context.Background())
+	// below the threshold of 1 °C
+	mock.data = provider.ForecastDay{"2024-08-01": {Temperature: 20.6}, "2024-08-02": {Temperature: 22.0}}
+	refreshSubscriptions(context.Background())
+	if hook.calls != 0 {
+		t.Fatalf("expected no webhook, got %d", hook.calls)
+	}
+
+	// 20.6 adds up with the previous 0.6
+	mock.data = provider.ForecastDay{"2024-08-01": {Temperature: 21.2}, "2024-08-02": {Temperature: 22.0}}
+	refreshSubscriptions(context.Background())
+	if hook.calls != 1 {
+		t.Fatalf("expected a webhook, got %d", hook.calls)
+	}
+
+	payload := hook.payloads[0]
+	if payload.SubscriptionID != created.ID || len(payload.Changes) != 1 {
+		t.Fatalf("unexpected payload: %+v", payload)
+	}
+	change := payload.Changes[0]
+	if change.Date != "2024-08-01" || change.Variable != provider.VariableTemperatureMax || change.Previous != 20.0 || change.Current != 21.2 {
+		t.Errorf("unexpected change: %+v", change)
+	}
+
+	body, _ := json.Marshal(payload)
+	if hook.timestamps[0] != strconv.FormatInt(settings.Clock.Now().Unix(), 10) {
+		t.Errorf("unexpected timestamp %q", hook.timestamps[0])
+	}
+	if hook.signatures[0] != signPayload(created.Secret, hook.timestamps[0], body) {
+		t.Errorf("unexpected signature %q", hook.signatures[0])
+	}
+
+	sub, _ := settings.subscriptions.get(created.ID)
+	if sub.LastCheckedAt == nil || sub.LastPushedAt == nil {
+		t.Errorf("expected the check and push times, got %+v", sub)
+	}
+}
+
+func TestRefreshSubscriptions_DeadLetter(t *testing.T) {
+	defer resetSettings()
+	mock := &mockProvider{name: "mock", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}}
+	settings.Providers = []provider.WeatherProvider{mock}
+	settings.APILimit = 1
+	settings.webhooks = &webhookDispatcher{client: http.DefaultClient, attempts: 3, allowPrivate: true}
+
+	hook := &webhookRecorder{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	_, created := createSubscription(t, `{"lat": 50, "lon": 10, "webhook_url": "`+server.URL+`"}`)
+
+	refreshSubscriptions(context.Background())
+	mock.data = provider.ForecastDay{"2024-08-01": {Temperature: 25.0}}
+	refreshSubscriptions(context.Background())
+
+	if hook.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", hook.calls)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/subscriptions/"+created.ID+"/dead-letters", nil)
+	req.SetPathValue("id", created.ID)
+	w := httptest.NewRecorder()
+	DeadLettersHandler(w, req)
+
+	var letters []DeadLetter
+	if err := json.NewDecoder(w.Body).Decode(&letters); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if len(letters) != 1 || letters[0].Attempts != 3 || !strings.Contains(letters[0].Error, "503") {
+		t.Fatalf("unexpected dead letters: %+v", letters)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(letters[0].Payload, &payload); err != nil || len(payload.Changes) != 1 {
+		t.Errorf("unexpected dead letter payload: %s", letters[0].Payload)
+	}
+
+	sub, _ := settings.subscriptions.get(created.ID)
+	if sub.LastPushedAt != nil {
+		t.Errorf("expected no push, got %v", sub.LastPushedAt)
+	}
+}
+
+func TestRefreshSubscriptions_RedeliversFailedChanges(t *testing.T) {
+	defer resetSettings()
+	mock := &mockProvider{name: "mock", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}}
+	settings.Providers = []provider.WeatherProvider{mock}
+	settings.APILimit = 1
+	settings.webhooks = &webhookDispatcher{client: http.DefaultClient, attempts: 1, allowPrivate: true}
+
+	hook := &webhookRecorder{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	_, created := createSubscription(t, `{"lat": 50, "lon": 10, "webhook_url": "`+server.URL+`", "variables": ["temperature_max"]}`)
+
+	refreshSubscriptions(context.Background())
+	mock.data = provider.ForecastDay{"2024-08-01": {Temperature: 25.0}}
+	refreshSubscriptions(context.Background())
+
+	hook.mu.Lock()
+	hook.status = http.StatusOK
+	hook.mu.Unlock()
+	refreshSubscriptions(context.Background())
+
+	if hook.calls != 2 {
+		t.Fatalf("expected a failed and a successful delivery, got %d", hook.calls)
+	}
+	changes := hook.payloads[1].Changes
+	if len(changes) != 1 || changes[0].Previous != 20.0 || changes[0].Current != 25.0 {
+		t.Errorf("expected the failed change again, got %+v", changes)
+	}
+	if sub, _ := settings.subscriptions.get(created.ID); sub.LastPushedAt == nil {
+		t.Errorf("expected the push time, got %+v", sub)
+	}
+
+	// pushed, the change is not sent again
+	refreshSubscriptions(context.Background())
+	if hook.calls != 2 {
+		t.Errorf("expected no other delivery, got %d", hook.calls)
+	}
+}
+
+func TestCheckPublicAddress(t *testing.T) {
+	for _, address := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.100.100.200",
+		"0.0.0.0", "::1", "::", "fe80::1", "fd00::1", "::ffff:127.0.0.1", "224.0.0.1",
+	} {
+		if err := checkPublicAddress(netip.MustParseAddr(address)); !errors.Is(err, errPrivateAddress) {
+			t.Errorf("%s: expected errPrivateAddress, got %v", address, err)
+		}
+	}
+	for _, address := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"} {
+		if err := checkPublicAddress(netip.MustParseAddr(address)); err != nil {
+			t.Errorf("%s: unexpected error: %v", address, err)
+		}
+	}
+}
+
+func TestWebhookDispatcher_RejectsPrivateAddresses(t *testing.T) {
+	hook := &webhookRecorder{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	// a name resolving to loopback is caught once resolved
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	for _, url := range []string{server.URL, "http://localhost" + port} {
+		dispatcher := newWebhookDispatcher(false)
+		dispatcher.attempts = 1
+		if _, _, err := dispatcher.deliver(context.Background(), url, "secret", []byte(`{}`)); !errors.Is(err, errPrivateAddress) {
+			t.Errorf("%s: expected errPrivateAddress, got %v", url, err)
+		}
+	}
+	if hook.calls != 0 {
+		t.Errorf("expected no delivery, got %d", hook.calls)
+	}
+
+	if _, _, err := newWebhookDispatcher(true).deliver(context.Background(), server.URL, "secret", []byte(`{}`)); err != nil {
+		t.Errorf("expected the delivery to be allowed, got %v", err)
+	}
+}
+
+func TestDiffForecast(t *testing.T) {
+	previous := forecastValues{
+		"2024-08-01": {"temperature_max": 20, "pressure": 1010},
+		"2024-08-02": {"temperature_max": 20},
+	}
+	current := forecastValues{
+		"2024-08-01": {"temperature_max": 19, "pressure": 1012},
+		"2024-08-02": {"temperature_max": 20.5, "wind_speed": 4},
+		"2024-08-03": {"temperature_max": 30},
+	}
+
+	changes := diffForecast(previous, current, map[string]float64{"temperature_max": 1, "pressure": 5, "wind_speed": 1})
+
+	if len(changes) != 1 || changes[0] != (ForecastChange{Date: "2024-08-01", Variable: "temperature_max", Previous: 20, Current: 19}) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+}
@@ -2,53 +2,246 @@ package handler
 
 import (
 	"context"
+	"cycloid/test/geocoder"
 	"cycloid/test/provider"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-func aggregateForecast(ctx context.Context, lat, lon string, providers []provider.WeatherProvider) (provider.ProviderForecast, error) {
+// forecastTTL is how long the forecast of a provider is reused for a location
+// and timezone, by /weather and batches alike.
+const forecastTTL = 10 * time.Minute
+
+// forecastKey keys the cached forecasts by provider, location, timezone and
+// first date, so that forecasts of a previous day are not served.
+func forecastKey(name, lat, lon string, loc *time.Location) string {
+	latf, _ := strconv.ParseFloat(lat, 64)
+	lonf, _ := strconv.ParseFloat(lon, 64)
+	return pointKey(name, latf, lonf) + "/" + loc.String() + "/" + provider.ForecastDates(settings.Clock, loc)[0]
+}
+
+// fetchForecast returns the forecast of a provider from the cache, or
+// refreshes it.
+func fetchForecast(ctx context.Context, p provider.WeatherProvider, lat, lon string, loc *time.Location) (provider.ForecastDay, error) {
+	if data, ok := settings.forecasts.get(forecastKey(p.Name(), lat, lon, loc), settings.Clock.Now()); ok {
+		return data, nil
+	}
+	return refreshForecast(ctx, p, lat, lon, loc)
+}
+
+// refreshForecast calls a provider through its circuit breaker and rate
+// limiter, finishes the call with its outcome, and caches and records the
+// forecast in the history when it has every day, so that a truncated one is
+// not served to later requests.
+func refreshForecast(ctx context.Context, p provider.WeatherProvider, lat, lon string, loc *time.Location) (provider.ForecastDay, error) {
+	if !settings.health.allow(p.Name()) {
+		return nil, fmt.Errorf("%s: %w", p.Name(), errCircuitOpen)
+	}
+	if err := settings.limiters.wait(ctx, p.Name()); err != nil {
+		settings.health.release(p.Name())
+		return nil, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	data, err := p.GetForecast(ctx, lat, lon, loc)
+	settings.health.finish(p.Name(), err)
+	if err == nil && len(data) == provider.FetchDaysCount {
+		settings.forecasts.put(forecastKey(p.Name(), lat, lon, loc), data, settings.Clock.Now())
+		recordForecast(p.Name(), lat, lon, loc, data)
+	}
+	return data, err
+}
+
+// aggregateForecast fetches the forecast of every provider concurrently, each
+// with the whole of ctx, and returns the names of those skipped because their
+// circuit is open. The first failure cancels the other calls, which then do
+// not count against their circuit. It fails with errCircuitOpen when all of
+// them were skipped.
+func aggregateForecast(ctx context.Context, lat, lon string, loc *time.Location, providers []provider.WeatherProvider) (provider.ProviderForecast, []string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	data := make([]provider.ForecastDay, len(providers))
+	errs := make([]error, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data[i], errs[i] = fetchForecast(ctx, p, lat, lon, loc)
+			if errs[i] != nil && !errors.Is(errs[i], errCircuitOpen) {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
 	result := make(provider.ProviderForecast)
-	for _, p := range providers {
-		data, err := p.GetForecast(ctx, lat, lon)
-		if err != nil {
-			return nil, err
+	var skipped []string
+	var failed error
+	for i, p := range providers {
+		switch err := errs[i]; {
+		case errors.Is(err, errCircuitOpen):
+			skipped = append(skipped, p.Name())
+		case err != nil:
+			// report the failure that canceled the others
+			if failed == nil || errors.Is(failed, context.Canceled) {
+				failed = err
+			}
+		default:
+			result[p.Name()] = data[i]
 		}
-		result[p.Name()] = data
 	}
-	return result, nil
+	if failed != nil {
+		return nil, skipped, failed
+	}
+	if len(result) == 0 && len(providers) > 0 {
+		return nil, skipped, fmt.Errorf("all providers: %w", errCircuitOpen)
+	}
+	return result, skipped, nil
 }
 
-func WeatherHandler(w http.ResponseWriter, r *http.Request) {
-	lat := r.URL.Query().Get("lat")
-	if lat == "" {
-		http.Error(w, "Missing latitude", http.StatusBadRequest)
-		return
+// skippedHeader lists the providers skipped by aggregateForecast.
+const skippedHeader = "X-Skipped-Providers"
+
+type LocatedForecast struct {
+	Location *geocoder.Location        `json:"location"`
+	Units    provider.UnitLabels       `json:"units"`
+	Forecast provider.ProviderForecast `json:"forecast"`
+}
+
+// weatherRequest holds the parsed and resolved parameters of a forecast request.
+type weatherRequest struct {
+	query      string
+	lat, lon   string
+	latf, lonf float64
+	location   *geocoder.Location
+	place      *geocoder.Place
+	loc        *time.Location
+	units      provider.Units
+	providers  []provider.WeatherProvider
+	// fresh skips the forecast cache, for the background jobs looking for
+	// changes.
+	fresh bool
+}
+
+// weatherParams are the raw parameters of a forecast request.
+type weatherParams struct {
+	Query     string
+	Lat, Lon  string
+	Timezone  string
+	Units     string
+	Providers string
+}
+
+func queryParams(r *http.Request) weatherParams {
+	query := r.URL.Query()
+	return weatherParams{
+		Query:     query.Get("q"),
+		Lat:       query.Get("lat"),
+		Lon:       query.Get("lon"),
+		Timezone:  query.Get("tz"),
+		Units:     query.Get("units"),
+		Providers: query.Get("providers"),
 	}
-	if latf, err := strconv.ParseFloat(lat, 32); latf < -90 || latf > 90 || err != nil {
-		http.Error(w, "Invalid latitude", http.StatusBadRequest)
+}
+
+// resolvePoint geocodes the place query of a request, or reads its
+// coordinates.
+func resolvePoint(ctx context.Context, params weatherParams, req *weatherRequest) error {
+	var err error
+	if req.query != "" {
+		if params.Lat != "" || params.Lon != "" {
+			return badRequest("Use either q or lat and lon")
+		}
+		if req.location, err = geocode(ctx, req.query); err != nil {
+			return err
+		}
 	}
-	lon := r.URL.Query().Get("lon")
-	if lon == "" {
-		http.Error(w, "Missing longitude", http.StatusBadRequest)
-		return
+
+	req.lat, req.lon, req.latf, req.lonf, err = coordinates(params.Lat, params.Lon, req.location)
+	return err
+}
+
+// resolveWeatherRequest validates the parameters shared by the forecast
+// endpoints, geocoding the place query and selecting the providers.
+func resolveWeatherRequest(ctx context.Context, params weatherParams) (*weatherRequest, error) {
+	req := weatherRequest{query: params.Query}
+	var err error
+
+	req.units, err = provider.ParseUnits(params.Units)
+	if err != nil {
+		return nil, badRequest("Invalid units")
+	}
+
+	if err := resolvePoint(ctx, params, &req); err != nil {
+		return nil, err
+	}
+
+	req.providers, err = selectProviders(settings.Providers, req.latf, req.lonf, params.Providers)
+	if err != nil {
+		return nil, badRequest("Invalid providers: " + err.Error())
+	}
+	if len(req.providers) == 0 {
+		return nil, badRequest("No provider covers the requested location")
 	}
-	if lonf, err := strconv.ParseFloat(lat, 32); lonf < -180 || lonf > 180 || err != nil {
-		http.Error(w, "Invalid longitude", http.StatusBadRequest)
+
+	req.loc, req.place, err = localize(req.latf, req.lonf, req.location, params.Timezone)
+	if err != nil {
+		return nil, badRequest("Invalid timezone")
 	}
+	return &req, nil
+}
 
+func WeatherHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(settings.APILimit)*time.Second)
 	defer cancel()
 
-	data, err := aggregateForecast(ctx, lat, lon, settings.Providers)
+	format, err := negotiateFormat(r)
 	if err != nil {
-		http.Error(w, "Failed to aggregate forecast: "+err.Error(), http.StatusInternalServerError)
+		writeRequestError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	req, err := resolveWeatherRequest(ctx, queryParams(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	data, skipped, err := aggregateForecast(ctx, req.lat, req.lon, req.loc, req.providers)
+	if len(skipped) > 0 {
+		w.Header().Set(skippedHeader, strings.Join(skipped, ", "))
+	}
+	if err != nil {
+		http.Error(w, "Failed to aggregate forecast: "+err.Error(), statusOf(err))
+		return
+	}
+	data = req.units.Convert(data)
+
+	annotate(w, req.loc, req.place)
+	w.Header().Set("X-Units", string(req.units))
 
+	switch format {
+	case formatCSV, formatNDJSON:
+		rows := newRowWriter(w, format, false)
+		rows.write(forecastRows(data))
+		rows.flush()
+		return
+	case formatGeoJSON:
+		w.Header().Set("Content-Type", formatContentTypes[formatGeoJSON])
+		json.NewEncoder(w).Encode(newFeatureCollection(weatherFeature(req, data)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if req.location != nil {
+		json.NewEncoder(w).Encode(LocatedForecast{Location: req.location, Units: req.units.Labels(), Forecast: data})
+		return
+	}
 	json.NewEncoder(w).Encode(data)
 }
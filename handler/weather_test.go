@@ -7,22 +7,33 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 type mockProvider struct {
-	name    string
-	data    provider.ForecastDay
-	err     error
-	timeout time.Duration
+	name     string
+	data     provider.ForecastDay
+	err      error
+	timeout  time.Duration
+	coverage provider.Coverage
+	loc      *time.Location
+	calls    int
+
+	mu sync.Mutex
 }
 
 func (m *mockProvider) Name() string {
 	return m.name
 }
 
-func (m *mockProvider) GetForecast(ctx context.Context, lat, lon string) (provider.ForecastDay, error) {
+func (m *mockProvider) GetForecast(ctx context.Context, lat, lon string, loc *time.Location) (provider.ForecastDay, error) {
+	m.mu.Lock()
+	m.loc = loc
+	m.calls++
+	m.mu.Unlock()
 	if m.timeout > 0 {
 		select {
 		case <-time.After(m.timeout):
@@ -33,16 +44,114 @@ func (m *mockProvider) GetForecast(ctx context.Context, lat, lon string) (provid
 	return m.data, m.err
 }
 
+func (m *mockProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Variables:       []string{provider.VariableTemperatureMax},
+		MaxForecastDays: provider.FetchDaysCount,
+		Coverage:        m.coverage,
+	}
+}
+
 func (m *mockProvider) GetParams(key string) any {
 	return nil
 }
 
 func (m *mockProvider) SetParams(key string, value any) {}
 
+// mockAPIProvider is a mockProvider that also serves current conditions, air
+// quality and an archive, counting its calls in calls. Every day of its
+// archive is 20 °C, except from unpublished on, and the requested ranges are
+// recorded.
+type mockAPIProvider struct {
+	mockProvider
+	current     provider.CurrentConditions
+	air         provider.AirQuality
+	chunkDays   int
+	unpublished string
+	ranges      []string
+}
+
+func (m *mockAPIProvider) called() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	return m.err
+}
+
+func (m *mockAPIProvider) GetCurrent(ctx context.Context, lat, lon string, loc *time.Location) (provider.CurrentConditions, error) {
+	return m.current, m.called()
+}
+
+func (m *mockAPIProvider) GetAirQuality(ctx context.Context, lat, lon string, loc *time.Location) (provider.AirQuality, error) {
+	return m.air, m.called()
+}
+
+func (m *mockAPIProvider) HistoricalChunkDays() int {
+	return m.chunkDays
+}
+
+func (m *mockAPIProvider) GetHistorical(ctx context.Context, lat, lon string, loc *time.Location, start, end string) (provider.ForecastDay, error) {
+	m.mu.Lock()
+	m.ranges = append(m.ranges, start+"/"+end)
+	m.mu.Unlock()
+	if err := m.called(); err != nil {
+		return nil, err
+	}
+	dates, _ := provider.DateRange(start, end)
+	days := make(provider.ForecastDay)
+	for _, date := range dates {
+		if date < m.unpublished || m.unpublished == "" {
+			days[date] = provider.ForecastData{Temperature: 20}
+		}
+	}
+	return days, nil
+}
+
+// serveJSON serves a request to target with handler and decodes the JSON
+// response, which error statuses but 502 Bad Gateway do not have.
+func serveJSON[T any](t *testing.T, handler http.HandlerFunc, target string) (*httptest.ResponseRecorder, T) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+	var response T
+	if w.Code < 400 || w.Code == http.StatusBadGateway {
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("invalid JSON response: %v", err)
+		}
+	}
+	return w, response
+}
+
 var originalSettings = settings
 
 func resetSettings() {
 	settings = originalSettings
+	settings.health = newHealthRegistry(settings.Clock)
+	settings.limiters = newRateLimiters()
+	settings.subscriptions = newSubscriptionStore()
+	settings.alerts = newAlertStore()
+	settings.accuracy = &accuracyState{}
+	settings.forecasts = newTTLCache[provider.ForecastDay](forecastTTL)
+	settings.recordedConsensus = newTTLCache[struct{}](forecastTTL)
+	settings.current = newTTLCache[provider.CurrentConditions](currentTTL)
+	settings.airQuality = newTTLCache[provider.AirQuality](airQualityTTL)
+	settings.historical = newHistoricalCache()
+}
+
+// useClock makes the handlers and the circuit breaker run on clock.
+func useClock(clock provider.Clock) {
+	settings.Clock = clock
+	settings.health = newHealthRegistry(clock)
+}
+
+// forecastWindow returns a forecast at temperature for every day of the window
+// starting today in UTC, as cached and recorded.
+func forecastWindow(temperature float64) provider.ForecastDay {
+	days := make(provider.ForecastDay)
+	for _, date := range provider.ForecastDates(settings.Clock, time.UTC) {
+		days[date] = provider.ForecastData{Temperature: temperature}
+	}
+	return days
 }
 
 func TestAggregateForecast_Success(t *testing.T) {
@@ -62,7 +171,7 @@ func TestAggregateForecast_Success(t *testing.T) {
 	providers := []provider.WeatherProvider{p1, p2}
 	ctx := context.Background()
 
-	result, err := aggregateForecast(ctx, "52.52", "13.41", providers)
+	result, _, err := aggregateForecast(ctx, "52.52", "13.41", time.UTC, providers)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -77,6 +186,147 @@ func TestAggregateForecast_Success(t *testing.T) {
 	}
 }
 
+func TestAggregateForecast_CircuitOpen(t *testing.T) {
+	defer resetSettings()
+
+	p := &mockProvider{name: "flaky", err: errors.New("fetch error")}
+	providers := []provider.WeatherProvider{p}
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		aggregateForecast(context.Background(), "52.52", "13.41", time.UTC, providers)
+	}
+
+	p.err = nil
+	_, _, err := aggregateForecast(context.Background(), "52.52", "13.41", time.UTC, providers)
+	if !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected errCircuitOpen, got %v", err)
+	}
+}
+
+func TestAggregateForecast_SkipsOpenCircuit(t *testing.T) {
+	defer resetSettings()
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		settings.health.record("flaky", errors.New("fetch error"))
+	}
+	providers := []provider.WeatherProvider{
+		&mockProvider{name: "flaky"},
+		&mockProvider{name: "good", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+	}
+
+	result, skipped, err := aggregateForecast(context.Background(), "52.52", "13.41", time.UTC, providers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := result["flaky"]; ok || len(result) != 1 {
+		t.Errorf("expected only the good provider, got %v", result)
+	}
+	if len(skipped) != 1 || skipped[0] != "flaky" {
+		t.Errorf("expected flaky to be reported as skipped, got %v", skipped)
+	}
+}
+
+func TestAggregateForecast_Concurrent(t *testing.T) {
+	defer resetSettings()
+
+	providers := []provider.WeatherProvider{
+		&mockProvider{name: "slow1", timeout: 200 * time.Millisecond},
+		&mockProvider{name: "slow2", timeout: 200 * time.Millisecond},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := aggregateForecast(ctx, "52.52", "13.41", time.UTC, providers); err != nil {
+		t.Fatalf("expected both providers to finish within the deadline, got %v", err)
+	}
+	for _, p := range providers {
+		if health := settings.health.health(p.Name()); health.ConsecutiveFailures != 0 {
+			t.Errorf("%s: expected no failure, got %+v", p.Name(), health)
+		}
+	}
+}
+
+func TestAggregateForecast_FailureCancelsOthers(t *testing.T) {
+	defer resetSettings()
+
+	providers := []provider.WeatherProvider{
+		&mockProvider{name: "slow", timeout: time.Second},
+		&mockProvider{name: "broken", err: errors.New("fetch error")},
+	}
+
+	_, _, err := aggregateForecast(context.Background(), "52.52", "13.41", time.UTC, providers)
+	if err == nil || !strings.Contains(err.Error(), "fetch error") {
+		t.Fatalf("expected the failure of broken, got %v", err)
+	}
+	if health := settings.health.health("slow"); health.ConsecutiveFailures != 0 {
+		t.Errorf("expected the canceled call not to count against slow, got %+v", health)
+	}
+}
+
+func TestWeatherHandler_SkippedHeader(t *testing.T) {
+	defer resetSettings()
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		settings.health.record("flaky", errors.New("fetch error"))
+	}
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{name: "flaky"},
+		&mockProvider{name: "good", data: provider.ForecastDay{"2024-08-01": {Temperature: 20.0}}},
+	}
+	settings.APILimit = 1
+
+	w := httptest.NewRecorder()
+	WeatherHandler(w, httptest.NewRequest(http.MethodGet, "/weather?lat=50&lon=10", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if skipped := w.Header().Get(skippedHeader); skipped != "flaky" {
+		t.Errorf("expected flaky in %s, got %q", skippedHeader, skipped)
+	}
+}
+
+func TestAggregateForecast_CircuitRecovers(t *testing.T) {
+	defer resetSettings()
+
+	clock := provider.NewFakeClock(time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC))
+	useClock(clock)
+
+	p := &mockProvider{name: "flaky", err: errors.New("fetch error")}
+	providers := []provider.WeatherProvider{p}
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		aggregateForecast(context.Background(), "52.52", "13.41", time.UTC, providers)
+	}
+
+	p.err = nil
+	clock.Advance(circuitOpenDuration)
+
+	if _, _, err := aggregateForecast(context.Background(), "52.52", "13.41", time.UTC, providers); err != nil {
+		t.Fatalf("expected the trial call to succeed, got %v", err)
+	}
+	if health := settings.health.health("flaky"); health.Circuit != circuitClosed {
+		t.Errorf("expected circuit to close, got %s", health.Circuit)
+	}
+}
+
+func TestRefreshForecast_TruncatedNotCached(t *testing.T) {
+	defer resetSettings()
+
+	days := forecastWindow(20)
+	delete(days, provider.ForecastDates(settings.Clock, time.UTC)[provider.FetchDaysCount-1])
+	p := &mockProvider{name: "truncated", data: days}
+
+	for i := 0; i < 2; i++ {
+		if _, err := fetchForecast(context.Background(), p, "50", "10", time.UTC); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if p.calls != 2 {
+		t.Errorf("expected the truncated forecast not to be cached, got %d calls", p.calls)
+	}
+}
+
 func TestWeatherHandler_MissingLat(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/weather?lon=10", nil)
 	w := httptest.NewRecorder()
@@ -164,6 +414,62 @@ func TestWeatherHandler_ProviderError(t *testing.T) {
 	}
 }
 
+func TestWeatherHandler_AllCircuitsOpen(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "flaky"}}
+	settings.APILimit = 1
+	for i := 0; i < circuitFailureThreshold; i++ {
+		settings.health.record("flaky", errors.New("fetch error"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=50&lon=10", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 Service Unavailable, got %d", w.Code)
+	}
+}
+
+func TestWeatherHandler_NoProviderCoversLocation(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{
+			name:     "regional",
+			coverage: provider.Coverage{{BoundingBox: &provider.BoundingBox{MinLat: 54, MinLon: 8, MaxLat: 58, MaxLon: 16}}},
+		},
+	}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=-33.9&lon=18.4", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+}
+
+func TestWeatherHandler_UnknownProvider(t *testing.T) {
+	defer resetSettings()
+
+	settings.Providers = []provider.WeatherProvider{&mockProvider{name: "goodProvider"}}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=50&lon=10&providers=nosuch", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+}
+
 func TestWeatherHandler_Success(t *testing.T) {
 	defer resetSettings()
 
@@ -202,3 +508,60 @@ func TestWeatherHandler_Success(t *testing.T) {
 		t.Errorf("unexpected temperature: got %.1f", day.Temperature)
 	}
 }
+
+func TestWeatherHandler_Units(t *testing.T) {
+	defer resetSettings()
+
+	wind := 10.0
+	settings.Providers = []provider.WeatherProvider{
+		&mockProvider{
+			name: "goodProvider",
+			data: provider.ForecastDay{
+				"2024-08-01": {Temperature: 20.0, WindSpeed: &wind},
+			},
+		},
+	}
+	settings.APILimit = 1
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=50&lon=10&units=imperial", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if got := w.Header().Get("X-Units"); got != "imperial" {
+		t.Errorf("expected X-Units imperial, got %q", got)
+	}
+
+	var result provider.ProviderForecast
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+
+	day := result["goodProvider"]["2024-08-01"]
+	if day.Temperature != 68.0 {
+		t.Errorf("expected 68 °F, got %.1f", day.Temperature)
+	}
+	if day.WindSpeed == nil || *day.WindSpeed < 22.36 || *day.WindSpeed > 22.37 {
+		t.Errorf("expected about 22.37 mph, got %v", day.WindSpeed)
+	}
+	// the provider's data is left in canonical units
+	if wind != 10.0 {
+		t.Errorf("expected provider data to be unchanged, got %.1f", wind)
+	}
+}
+
+func TestWeatherHandler_InvalidUnits(t *testing.T) {
+	defer resetSettings()
+
+	req := httptest.NewRequest(http.MethodGet, "/weather?lat=50&lon=10&units=kelvin", nil)
+	w := httptest.NewRecorder()
+
+	WeatherHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %d", w.Code)
+	}
+}
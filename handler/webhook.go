@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// webhookAttempts deliveries are tried, waiting webhookBackoff after the
+	// first failure and doubling it after every other.
+	webhookAttempts = 4
+	webhookBackoff  = time.Second
+	webhookTimeout  = 10 * time.Second
+
+	// maxDeadLetters failed deliveries are kept per subscription, the oldest
+	// dropped first.
+	maxDeadLetters = 50
+
+	signatureHeader  = "X-Webhook-Signature"
+	timestampHeader  = "X-Webhook-Timestamp"
+	deliveryIDHeader = "X-Webhook-Delivery"
+)
+
+// DeadLetter is a webhook delivery that failed every attempt.
+type DeadLetter struct {
+	DeliveryID string          `json:"delivery_id"`
+	FailedAt   time.Time       `json:"failed_at"`
+	Attempts   int             `json:"attempts"`
+	Error      string          `json:"error"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+var errPrivateAddress = errors.New("webhook address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, not covered by
+// netip.Addr.IsPrivate, where some clouds serve their metadata.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// checkPublicAddress rejects the loopback, private, link-local, multicast and
+// unspecified addresses a webhook could use to reach internal services.
+func checkPublicAddress(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, addr)
+	}
+	return nil
+}
+
+// dialPublicOnly is the Control of the dialer of webhooks. It runs on the
+// resolved address of every connection, redirects included, so that a host
+// resolving to a public address when checked cannot rebind to a private one.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	return checkPublicAddress(addrPort.Addr())
+}
+
+// webhookDispatcher posts signed payloads to webhooks, retrying failures.
+type webhookDispatcher struct {
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+	// allowPrivate lets webhooks reach private addresses, for webhooks set by
+	// the operator or local setups.
+	allowPrivate bool
+}
+
+// newWebhookDispatcher returns a dispatcher that only connects to public
+// addresses unless allowPrivate is set. It does not use the proxy of the
+// environment, which would be checked instead of the webhook.
+func newWebhookDispatcher(allowPrivate bool) *webhookDispatcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = dialPublicOnly
+	}
+	transport.DialContext = dialer.DialContext
+	return &webhookDispatcher{
+		client:       &http.Client{Timeout: webhookTimeout, Transport: transport},
+		attempts:     webhookAttempts,
+		backoff:      webhookBackoff,
+		allowPrivate: allowPrivate,
+	}
+}
+
+// SetupWebhooks lets the webhooks of subscriptions reach private addresses.
+func SetupWebhooks(allowPrivate bool) {
+	settings.webhooks = newWebhookDispatcher(allowPrivate)
+}
+
+// signPayload returns the signature header value of a payload sent at
+// timestamp: the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed
+// with the secret of the webhook. Signing the timestamp lets receivers reject
+// replayed deliveries.
+func signPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *webhookDispatcher) post(ctx context.Context, url, secret, deliveryID string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	timestamp := strconv.FormatInt(settings.Clock.Now().Unix(), 10)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, signPayload(secret, timestamp, payload))
+	req.Header.Set(deliveryIDHeader, deliveryID)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// deliver posts a payload to a webhook, retrying with exponential backoff,
+// and returns the delivery ID, the number of attempts and the last error.
+func (d *webhookDispatcher) deliver(ctx context.Context, url, secret string, payload []byte) (string, int, error) {
+	deliveryID := randomID(8)
+	backoff := d.backoff
+
+	var err error
+	attempts := 0
+	for attempts < d.attempts {
+		if attempts > 0 {
+			select {
+			case <-ctx.Done():
+				return deliveryID, attempts, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		attempts++
+		if err = d.post(ctx, url, secret, deliveryID, payload); err == nil {
+			return deliveryID, attempts, nil
+		}
+	}
+	return deliveryID, attempts, err
+}
+
+func (s *subscriptionStore) deadLetter(id string, letter DeadLetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return
+	}
+	sub.deadLetters = append(sub.deadLetters, letter)
+	if len(sub.deadLetters) > maxDeadLetters {
+		sub.deadLetters = sub.deadLetters[len(sub.deadLetters)-maxDeadLetters:]
+	}
+}
+
+func (s *subscriptionStore) deadLetters(id string) ([]DeadLetter, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]DeadLetter{}, sub.deadLetters...), true
+}
+
+// DeadLettersHandler serves GET /subscriptions/{id}/dead-letters, the failed
+// deliveries of a subscription, oldest first.
+func DeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	letters, ok := settings.subscriptions.deadLetters(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letters)
+}
@@ -0,0 +1,546 @@
+// Package history stores the forecasts fetched from the providers, so the
+// forecasts for a day can be compared across the times they were issued.
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cycloid/test/provider"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	forecastsBucket     = []byte("forecasts")
+	observationsBucket  = []byte("observations")
+	verificationsBucket = []byte("verifications")
+	attemptsBucket      = []byte("attempts")
+	metaBucket          = []byte("meta")
+
+	versionKey = []byte("version")
+)
+
+const (
+	// issuedFormat sorts lexically in time order.
+	issuedFormat = "20060102T150405.000000000Z"
+
+	// queueSize batches of records wait to be written before Enqueue drops
+	// them.
+	queueSize = 1024
+
+	// version is that of the keys: since 2, those of a day carry the
+	// timezone of its days.
+	version = "2"
+)
+
+// Record is the forecast of a provider for a day at a location, as it was
+// issued. Values are in canonical units.
+type Record struct {
+	Provider string                `json:"provider"`
+	Lat      float64               `json:"lat"`
+	Lon      float64               `json:"lon"`
+	Timezone string                `json:"timezone"`
+	IssuedAt time.Time             `json:"issued_at"`
+	Date     string                `json:"date"`
+	Values   provider.ForecastData `json:"values"`
+}
+
+// LeadDays is the number of days between the day the record was issued, in
+// its timezone, and the day it forecasts.
+func (r Record) LeadDays() int {
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	issued, _ := time.Parse(time.DateOnly, r.IssuedAt.In(loc).Format(time.DateOnly))
+	date, err := time.Parse(time.DateOnly, r.Date)
+	if err != nil {
+		return 0
+	}
+	return int(date.Sub(issued).Hours() / 24)
+}
+
+// Observation is the weather observed on a day at a location, in canonical
+// units, as reported by Source for the days of Timezone. A Missing
+// observation marks a day Source never reported, which is not observed again.
+type Observation struct {
+	Source   string                `json:"source"`
+	Lat      float64               `json:"lat"`
+	Lon      float64               `json:"lon"`
+	Timezone string                `json:"timezone"`
+	Date     string                `json:"date"`
+	Values   provider.ForecastData `json:"values"`
+	Missing  bool                  `json:"missing,omitempty"`
+}
+
+// Verification is the error of the latest forecast of a provider for a day
+// of Timezone at a location and lead time, against its observation: by
+// variable, the forecast minus the observed value in canonical units.
+type Verification struct {
+	Provider string             `json:"provider"`
+	Lat      float64            `json:"lat"`
+	Lon      float64            `json:"lon"`
+	Timezone string             `json:"timezone"`
+	Date     string             `json:"date"`
+	LeadDays int                `json:"lead_days"`
+	Errors   map[string]float64 `json:"errors"`
+}
+
+// LocationKey groups the records of a location, rounded to about a kilometre.
+func LocationKey(lat, lon float64) string {
+	return fmt.Sprintf("%+.2f%+.2f", lat, lon)
+}
+
+// The keys of a location start with the date and timezone of the day, so that
+// the same date in two timezones are two days.
+func recordKey(r Record) []byte {
+	return []byte(dayKey(r.Date, r.Timezone) + "/" + r.IssuedAt.UTC().Format(issuedFormat) + "/" + r.Provider)
+}
+
+func dayKey(date, timezone string) string {
+	return date + "/" + timezone
+}
+
+func verificationKey(v Verification) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%d", dayKey(v.Date, v.Timezone), v.Provider, v.LeadDays))
+}
+
+// after is the first key past those starting with prefix and "/", as "0"
+// sorts after "/".
+func after(prefix []byte) []byte {
+	return append(append([]byte{}, prefix...), '0')
+}
+
+// queued is a batch of records to write, or a flush request.
+type queued struct {
+	records []Record
+	flushed chan struct{}
+}
+
+// Store is an embedded database of forecast records, kept in a bbolt file
+// with a bucket per location and keys ordered by date, timezone and issue
+// time.
+// Records given to Enqueue are written in the background.
+type Store struct {
+	db *bolt.DB
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan queued
+	done   chan struct{}
+}
+
+// Open opens the store at path, creating it when missing.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{forecastsBucket, observationsBucket, verificationsBucket, attemptsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if string(tx.Bucket(metaBucket).Get(versionKey)) == version {
+			return nil
+		}
+		if err := migrate(tx); err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucket).Put(versionKey, []byte(version))
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	s := &Store{db: db, queue: make(chan queued, queueSize), done: make(chan struct{})}
+	go s.write()
+	return s, nil
+}
+
+// migrate rekeys the days of a store of the first version by their timezone.
+// The verifications take the timezone of the observation of their day, the
+// only one a location had, and the observation attempts start over.
+func migrate(tx *bolt.Tx) error {
+	observations := make(map[string]string)
+	err := rekey(tx.Bucket(observationsBucket), func(location, k, v []byte) ([]byte, []byte, error) {
+		var o Observation
+		if err := json.Unmarshal(v, &o); err != nil {
+			return nil, nil, fmt.Errorf("invalid observation %s: %w", k, err)
+		}
+		observations[string(location)+"/"+o.Date] = o.Timezone
+		return []byte(dayKey(o.Date, o.Timezone)), v, nil
+	})
+	if err != nil {
+		return err
+	}
+	err = rekey(tx.Bucket(forecastsBucket), func(_, k, v []byte) ([]byte, []byte, error) {
+		var r Record
+		if err := json.Unmarshal(v, &r); err != nil {
+			return nil, nil, fmt.Errorf("invalid record %s: %w", k, err)
+		}
+		return recordKey(r), v, nil
+	})
+	if err != nil {
+		return err
+	}
+	err = rekey(tx.Bucket(verificationsBucket), func(location, k, v []byte) ([]byte, []byte, error) {
+		var verification Verification
+		if err := json.Unmarshal(v, &verification); err != nil {
+			return nil, nil, fmt.Errorf("invalid verification %s: %w", k, err)
+		}
+		timezone, ok := observations[string(location)+"/"+verification.Date]
+		if !ok {
+			return nil, nil, nil
+		}
+		verification.Timezone = timezone
+		value, err := json.Marshal(verification)
+		return verificationKey(verification), value, err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.DeleteBucket(attemptsBucket); err != nil {
+		return err
+	}
+	_, err = tx.CreateBucket(attemptsBucket)
+	return err
+}
+
+// rekey replaces every value of the locations of a bucket with the key and
+// value returned by key, deleting those it returns no key for.
+func rekey(buckets *bolt.Bucket, key func(location, k, v []byte) ([]byte, []byte, error)) error {
+	return buckets.ForEachBucket(func(location []byte) error {
+		bucket := buckets.Bucket(location)
+		moved := make(map[string][]byte)
+		var old [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			newKey, value, err := key(location, k, v)
+			if err != nil {
+				return err
+			}
+			old = append(old, append([]byte{}, k...))
+			if newKey != nil {
+				moved[string(newKey)] = append([]byte{}, value...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range old {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		for k, v := range moved {
+			if err := bucket.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close writes the queued records and closes the store.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return s.db.Close()
+}
+
+// write writes the queued records, those queued meanwhile in the same
+// transaction, until the queue is closed.
+func (s *Store) write() {
+	defer close(s.done)
+	for item := range s.queue {
+		var records []Record
+		var flushed []chan struct{}
+		for more := true; more; {
+			records = append(records, item.records...)
+			if item.flushed != nil {
+				flushed = append(flushed, item.flushed)
+			}
+			select {
+			case item, more = <-s.queue:
+			default:
+				more = false
+			}
+		}
+		if len(records) > 0 {
+			if err := s.Add(records); err != nil {
+				log.Printf("history: failed to write %d records: %v", len(records), err)
+			}
+		}
+		for _, ch := range flushed {
+			close(ch)
+		}
+	}
+}
+
+// Enqueue queues records to be written in the background. It returns false,
+// dropping them, when the queue is full or the store closed.
+func (s *Store) Enqueue(records []Record) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.queue <- queued{records: records}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Flush waits until the records queued so far are written.
+func (s *Store) Flush() {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	s.queue <- queued{flushed: flushed}
+	s.mu.RUnlock()
+	<-flushed
+}
+
+// Add stores records. Concurrent calls are written in a single transaction.
+func (s *Store) Add(records []Record) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		forecasts := tx.Bucket(forecastsBucket)
+		for _, r := range records {
+			location, err := forecasts.CreateBucketIfNotExists([]byte(LocationKey(r.Lat, r.Lon)))
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := location.Put(recordKey(r), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Forecasts returns the records for a day at a location, ordered by issue
+// time.
+func (s *Store) Forecasts(lat, lon float64, date string) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		location := tx.Bucket(forecastsBucket).Bucket([]byte(LocationKey(lat, lon)))
+		if location == nil {
+			return nil
+		}
+		prefix := []byte(date + "/")
+		c := location.Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("invalid record %s: %w", k, err)
+			}
+			records = append(records, r)
+		}
+		return nil
+	})
+	// the keys of the day are ordered by timezone first
+	slices.SortStableFunc(records, func(a, b Record) int { return a.IssuedAt.Compare(b.IssuedAt) })
+	return records, err
+}
+
+// AddObservations stores observations, replacing those of the same day,
+// timezone and location, with the verifications of the forecasts of those
+// days.
+func (s *Store) AddObservations(observations []Observation, verifications []Verification) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(observationsBucket)
+		for _, o := range observations {
+			location, err := bucket.CreateBucketIfNotExists([]byte(LocationKey(o.Lat, o.Lon)))
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(o)
+			if err != nil {
+				return err
+			}
+			if err := location.Put([]byte(dayKey(o.Date, o.Timezone)), value); err != nil {
+				return err
+			}
+		}
+		bucket = tx.Bucket(verificationsBucket)
+		for _, v := range verifications {
+			location, err := bucket.CreateBucketIfNotExists([]byte(LocationKey(v.Lat, v.Lon)))
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if err := location.Put(verificationKey(v), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddAttempts counts a failed attempt to observe each of the dates of
+// timezone at a location, and returns the attempts so far by date.
+func (s *Store) AddAttempts(lat, lon float64, timezone string, dates []string) (map[string]int, error) {
+	attempts := make(map[string]int, len(dates))
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		location, err := tx.Bucket(attemptsBucket).CreateBucketIfNotExists([]byte(LocationKey(lat, lon)))
+		if err != nil {
+			return err
+		}
+		for _, date := range dates {
+			key := []byte(dayKey(date, timezone))
+			n, _ := strconv.Atoi(string(location.Get(key)))
+			n++
+			if err := location.Put(key, []byte(strconv.Itoa(n))); err != nil {
+				return err
+			}
+			attempts[date] = n
+		}
+		return nil
+	})
+	return attempts, err
+}
+
+// Locations returns the keys of the locations with forecasts.
+func (s *Store) Locations() ([]string, error) {
+	var keys []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(forecastsBucket).ForEachBucket(func(k []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Unobserved returns the forecasts of a location for the days without an
+// observation, ordered by date, timezone and issue time. The records of
+// observed days are skipped without being read.
+func (s *Store) Unobserved(key string) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(forecastsBucket).Bucket([]byte(key))
+		if bucket == nil {
+			return nil
+		}
+		observed := tx.Bucket(observationsBucket).Bucket([]byte(key))
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil; {
+			if day := observedDay(observed, k); day != nil {
+				k, v = c.Seek(after(day))
+				continue
+			}
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("invalid record %s: %w", k, err)
+			}
+			records = append(records, r)
+			k, v = c.Next()
+		}
+		return nil
+	})
+	return records, err
+}
+
+// observedDay returns the key of the observed day of a record key, nil when
+// its day is not observed. A timezone may contain "/", so the observations of
+// the date are matched against the key rather than parsed out of it.
+func observedDay(observed *bolt.Bucket, recordKey []byte) []byte {
+	if observed == nil {
+		return nil
+	}
+	date, _, _ := bytes.Cut(recordKey, []byte("/"))
+	prefix := append(append([]byte{}, date...), '/')
+	c := observed.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if bytes.HasPrefix(recordKey, append(append([]byte{}, k...), '/')) {
+			return k
+		}
+	}
+	return nil
+}
+
+// Verifications returns the verifications of every location.
+func (s *Store) Verifications() ([]Verification, error) {
+	var verifications []Verification
+	err := s.db.View(func(tx *bolt.Tx) error {
+		buckets := tx.Bucket(verificationsBucket)
+		return buckets.ForEachBucket(func(key []byte) error {
+			return buckets.Bucket(key).ForEach(func(k, v []byte) error {
+				var verification Verification
+				if err := json.Unmarshal(v, &verification); err != nil {
+					return fmt.Errorf("invalid verification %s: %w", k, err)
+				}
+				verifications = append(verifications, verification)
+				return nil
+			})
+		})
+	})
+	return verifications, err
+}
+
+// Prune deletes the forecasts, observations, verifications and observation
+// attempts of the days before date, and the locations left empty. It returns the number of
+// forecasts deleted.
+func (s *Store) Prune(date string) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{forecastsBucket, observationsBucket, verificationsBucket, attemptsBucket} {
+			buckets := tx.Bucket(name)
+			var empty [][]byte
+			err := buckets.ForEachBucket(func(key []byte) error {
+				bucket := buckets.Bucket(key)
+				c := bucket.Cursor()
+				// keys are ordered by date: delete from the first one
+				for k, _ := c.First(); k != nil && bytes.Compare(k, []byte(date)) < 0; k, _ = c.First() {
+					if err := c.Delete(); err != nil {
+						return err
+					}
+					if bytes.Equal(name, forecastsBucket) {
+						deleted++
+					}
+				}
+				if k, _ := c.First(); k == nil {
+					empty = append(empty, append([]byte{}, key...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, key := range empty {
+				if err := buckets.DeleteBucket(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,270 @@
+package history
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cycloid/test/provider"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStore_Forecasts(t *testing.T) {
+	store := openStore(t)
+
+	first := time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)
+	second := first.Add(6 * time.Hour)
+	records := []Record{
+		{Provider: "b", Lat: 52.52, Lon: 13.41, Timezone: "UTC", IssuedAt: second, Date: "2024-08-03", Values: provider.ForecastData{Temperature: 24}},
+		{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "UTC", IssuedAt: first, Date: "2024-08-03", Values: provider.ForecastData{Temperature: 21}},
+		{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "UTC", IssuedAt: first, Date: "2024-08-02", Values: provider.ForecastData{Temperature: 20}},
+		{Provider: "a", Lat: 48.85, Lon: 2.35, Timezone: "UTC", IssuedAt: first, Date: "2024-08-03", Values: provider.ForecastData{Temperature: 30}},
+	}
+	if err := store.Add(records); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// rounded to the same location
+	got, err := store.Forecasts(52.5201, 13.4099, "2024-08-03")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Provider != "a" || got[1].Provider != "b" || got[1].Values.Temperature != 24 {
+		t.Fatalf("expected the 2 records of the day in issue order, got %+v", got)
+	}
+	if !got[0].IssuedAt.Equal(first) {
+		t.Errorf("unexpected issue time %v", got[0].IssuedAt)
+	}
+
+	if got, _ := store.Forecasts(0, 0, "2024-08-03"); len(got) != 0 {
+		t.Errorf("expected no records at an unknown location, got %+v", got)
+	}
+}
+
+func TestRecord_LeadDays(t *testing.T) {
+	r := Record{Timezone: "Asia/Tokyo", IssuedAt: time.Date(2024, 8, 1, 20, 0, 0, 0, time.UTC), Date: "2024-08-03"}
+	// 2024-08-02 05:00 in Tokyo
+	if got := r.LeadDays(); got != 1 {
+		t.Errorf("expected 1 day, got %d", got)
+	}
+}
+
+func TestStore_Unobserved(t *testing.T) {
+	store := openStore(t)
+
+	issued := time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)
+	err := store.Add([]Record{
+		{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "UTC", IssuedAt: issued, Date: "2024-08-02"},
+		{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "UTC", IssuedAt: issued.Add(time.Hour), Date: "2024-08-03"},
+		{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "UTC", IssuedAt: issued, Date: "2024-08-03"},
+		{Provider: "a", Lat: 48.85, Lon: 2.35, Timezone: "UTC", IssuedAt: issued, Date: "2024-08-02"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = store.AddObservations([]Observation{
+		{Source: "archive", Lat: 52.52, Lon: 13.41, Timezone: "UTC", Date: "2024-08-02", Values: provider.ForecastData{Temperature: 23}},
+	}, []Verification{
+		{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "UTC", Date: "2024-08-02", LeadDays: 1, Errors: map[string]float64{"temperature_max": 1}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys, err := store.Locations()
+	if err != nil || len(keys) != 2 || keys[0] != "+48.85+2.35" || keys[1] != "+52.52+13.41" {
+		t.Fatalf("unexpected locations %v: %v", keys, err)
+	}
+
+	records, err := store.Unobserved(LocationKey(52.52, 13.41))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 || records[0].Date != "2024-08-03" || !records[0].IssuedAt.Equal(issued) {
+		t.Errorf("expected the records of the unobserved day in issue order, got %+v", records)
+	}
+
+	verifications, err := store.Verifications()
+	if err != nil || len(verifications) != 1 || verifications[0].Errors["temperature_max"] != 1 {
+		t.Errorf("unexpected verifications %+v: %v", verifications, err)
+	}
+}
+
+func TestStore_Timezones(t *testing.T) {
+	store := openStore(t)
+
+	issued := time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)
+	var records []Record
+	for _, tz := range []string{"Etc/GMT+1", "Etc/GMT+10", "UTC"} {
+		records = append(records, Record{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: tz, IssuedAt: issued, Date: "2024-08-02"})
+		issued = issued.Add(-time.Hour)
+	}
+	if err := store.Add(records); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := store.Forecasts(52.52, 13.41, "2024-08-02")
+	if err != nil || len(got) != 3 || got[0].Timezone != "UTC" || got[2].Timezone != "Etc/GMT+1" {
+		t.Fatalf("expected the day in every timezone in issue order, got %+v: %v", got, err)
+	}
+
+	err = store.AddObservations([]Observation{{Lat: 52.52, Lon: 13.41, Timezone: "Etc/GMT+1", Date: "2024-08-02"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	unobserved, err := store.Unobserved(LocationKey(52.52, 13.41))
+	if err != nil || len(unobserved) != 2 || unobserved[0].Timezone != "Etc/GMT+10" || unobserved[1].Timezone != "UTC" {
+		t.Errorf("expected the day unobserved in the other timezones, got %+v: %v", unobserved, err)
+	}
+
+	if attempts, _ := store.AddAttempts(52.52, 13.41, "UTC", []string{"2024-08-02"}); attempts["2024-08-02"] != 1 {
+		t.Errorf("expected a first attempt in UTC, got %v", attempts)
+	}
+	if attempts, _ := store.AddAttempts(52.52, 13.41, "Etc/GMT+1", []string{"2024-08-02"}); attempts["2024-08-02"] != 1 {
+		t.Errorf("expected a first attempt in Etc/GMT+1, got %v", attempts)
+	}
+}
+
+func TestOpen_MigratesKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// the keys of the first version, without the timezone
+	issued := time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)
+	values := map[string]map[string]any{
+		"forecasts":     {"2024-08-02/" + issued.Format(issuedFormat) + "/a": Record{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "Europe/Berlin", IssuedAt: issued, Date: "2024-08-02"}},
+		"observations":  {"2024-08-02": Observation{Lat: 52.52, Lon: 13.41, Timezone: "Europe/Berlin", Date: "2024-08-02"}},
+		"verifications": {"2024-08-02/a/1": Verification{Provider: "a", Lat: 52.52, Lon: 13.41, Date: "2024-08-02", LeadDays: 1}},
+		"attempts":      {"2024-08-03": 2},
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for name, entries := range values {
+			bucket, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			location, err := bucket.CreateBucket([]byte(LocationKey(52.52, 13.41)))
+			if err != nil {
+				return err
+			}
+			for k, v := range entries {
+				value, _ := json.Marshal(v)
+				if err := location.Put([]byte(k), value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to write the first version: %v", err)
+	}
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	if records, _ := store.Forecasts(52.52, 13.41, "2024-08-02"); len(records) != 1 {
+		t.Errorf("expected the migrated record, got %+v", records)
+	}
+	if records, _ := store.Unobserved(LocationKey(52.52, 13.41)); len(records) != 0 {
+		t.Errorf("expected the migrated observation to cover the record, got %+v", records)
+	}
+	verifications, err := store.Verifications()
+	if err != nil || len(verifications) != 1 || verifications[0].Timezone != "Europe/Berlin" {
+		t.Errorf("expected the verification in the timezone of its observation, got %+v: %v", verifications, err)
+	}
+	if attempts, _ := store.AddAttempts(52.52, 13.41, "Europe/Berlin", []string{"2024-08-03"}); attempts["2024-08-03"] != 1 {
+		t.Errorf("expected the attempts to start over, got %v", attempts)
+	}
+}
+
+func TestStore_AddAttempts(t *testing.T) {
+	store := openStore(t)
+
+	if _, err := store.AddAttempts(52.52, 13.41, "UTC", []string{"2024-08-01", "2024-08-02"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	attempts, err := store.AddAttempts(52.52, 13.41, "UTC", []string{"2024-08-02"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(attempts) != 1 || attempts["2024-08-02"] != 2 {
+		t.Errorf("expected a second attempt of 2024-08-02, got %v", attempts)
+	}
+
+	if _, err := store.Prune("2024-08-03"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts, _ := store.AddAttempts(52.52, 13.41, "UTC", []string{"2024-08-02"}); attempts["2024-08-02"] != 1 {
+		t.Errorf("expected the attempts to be pruned, got %v", attempts)
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	store := openStore(t)
+
+	issued := time.Date(2024, 8, 1, 6, 0, 0, 0, time.UTC)
+	err := store.Add([]Record{
+		{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "UTC", IssuedAt: issued, Date: "2024-08-01"},
+		{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "UTC", IssuedAt: issued, Date: "2024-08-02"},
+		{Provider: "a", Lat: 48.85, Lon: 2.35, Timezone: "UTC", IssuedAt: issued, Date: "2024-08-01"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = store.AddObservations([]Observation{{Lat: 48.85, Lon: 2.35, Timezone: "UTC", Date: "2024-08-01"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deleted, err := store.Prune("2024-08-02")
+	if err != nil || deleted != 2 {
+		t.Fatalf("expected 2 forecasts deleted, got %d: %v", deleted, err)
+	}
+	if keys, _ := store.Locations(); len(keys) != 1 || keys[0] != "+52.52+13.41" {
+		t.Errorf("expected the emptied location to be deleted, got %v", keys)
+	}
+	if records, _ := store.Forecasts(52.52, 13.41, "2024-08-02"); len(records) != 1 {
+		t.Errorf("expected the forecast of 2024-08-02 to be kept, got %+v", records)
+	}
+}
+
+func TestStore_Enqueue(t *testing.T) {
+	store := openStore(t)
+
+	record := Record{Provider: "a", Lat: 52.52, Lon: 13.41, Timezone: "UTC", IssuedAt: time.Now(), Date: "2024-08-02"}
+	for i := 0; i < 3; i++ {
+		record.IssuedAt = record.IssuedAt.Add(time.Second)
+		if !store.Enqueue([]Record{record}) {
+			t.Fatal("expected the records to be queued")
+		}
+	}
+	store.Flush()
+
+	if records, err := store.Forecasts(52.52, 13.41, "2024-08-02"); err != nil || len(records) != 3 {
+		t.Errorf("expected the queued records to be written, got %d: %v", len(records), err)
+	}
+
+	store.Close()
+	if store.Enqueue([]Record{record}) {
+		t.Error("expected a closed store to drop the records")
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"math"
+	"net"
 	"net/http"
 	"os"
+	_ "time/tzdata"
 
 	"cycloid/test/handler"
 
@@ -15,6 +18,42 @@ import (
 
 type Config struct {
 	Providers map[string]map[string]any `yaml:"providers"`
+	Sources   map[string]map[string]any `yaml:"sources"`
+	Geocoder  map[string]any            `yaml:"geocoder"`
+	Alerts    handler.AlertsConfig      `yaml:"alerts"`
+}
+
+// routes maps the served patterns to their handlers. Every route must be
+// described in handler/openapi.json.
+var routes = map[string]http.HandlerFunc{
+	"/weather":                handler.WeatherHandler,
+	"/v2/weather":             handler.WeatherV2Handler,
+	"POST /weather/batch":     handler.BatchHandler,
+	"GET /weather.ics":        handler.CalendarHandler,
+	"GET /weather/stream":     handler.StreamHandler,
+	"GET /weather/current":    handler.CurrentHandler,
+	"GET /weather/historical": handler.HistoricalHandler,
+	"GET /weather/history":    handler.HistoryHandler,
+	"GET /providers":          handler.ProvidersHandler,
+	"GET /sources":            handler.SourcesHandler,
+	"GET /alerts":             handler.SevereAlertsHandler,
+	"GET /airquality":         handler.AirQualityHandler,
+	"GET /accuracy":           handler.AccuracyHandler,
+
+	"POST /subscriptions":                  handler.CreateSubscriptionHandler,
+	"GET /subscriptions":                   handler.ListSubscriptionsHandler,
+	"GET /subscriptions/{id}":              handler.GetSubscriptionHandler,
+	"DELETE /subscriptions/{id}":           handler.DeleteSubscriptionHandler,
+	"GET /subscriptions/{id}/dead-letters": handler.DeadLettersHandler,
+
+	"POST /alert-rules":        handler.CreateAlertRuleHandler,
+	"GET /alert-rules":         handler.ListAlertRulesHandler,
+	"GET /alert-rules/{id}":    handler.GetAlertRuleHandler,
+	"DELETE /alert-rules/{id}": handler.DeleteAlertRuleHandler,
+	"GET /alert-events":        handler.AlertEventsHandler,
+
+	"GET /openapi.json": handler.OpenAPIHandler,
+	"GET /docs":         handler.DocsHandler,
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -32,26 +71,93 @@ func LoadConfig(path string) (*Config, error) {
 
 func main() {
 	port := flag.Int("port", 8080, "Port for the server")
+	grpcPort := flag.Int("grpc-port", 9090, "Port for the gRPC server, 0 to disable it")
 	apiLimit := flag.Int("api-limit", 30, "Limit for api calls in seconds")
+	subscriptionInterval := flag.Duration("subscription-interval", handler.DefaultSubscriptionInterval, "Interval between refreshes of the forecast subscriptions")
+	webhookAllowPrivate := flag.Bool("webhook-allow-private", false, "Let subscription webhooks reach loopback and private addresses")
+	alertInterval := flag.Duration("alert-interval", handler.DefaultAlertInterval, "Interval between evaluations of the alert rules")
+	historyPath := flag.String("history", "history.db", "Path to the forecast history database, empty to disable it")
+	historyRetention := flag.Duration("history-retention", handler.DefaultHistoryRetention, "How long the days of the forecast history are kept, 0 to keep them all")
+	verificationInterval := flag.Duration("verification-interval", handler.DefaultVerificationInterval, "Interval between verifications of the forecast history against observations")
+	weightedConsensus := flag.Bool("weighted-consensus", false, "Weigh the providers of the consensus by their accuracy")
+	batchLimit := flag.Int("batch-limit", handler.DefaultBatchLimit, "Maximum number of locations in a batch request")
+	batchTimeout := flag.Duration("batch-timeout", handler.DefaultBatchTimeout, "Maximum duration of a whole batch request")
 	configPath := flag.String("config", "config.yml", "Path to configuration file")
 	flag.Parse()
 
 	if *port < 0 || *port >= int(math.Pow(2, 16)) {
 		log.Fatal("invalid port number")
 	}
+	if *grpcPort < 0 || *grpcPort >= int(math.Pow(2, 16)) {
+		log.Fatal("invalid gRPC port number")
+	}
 
 	if *apiLimit <= 0 {
 		log.Fatal("invalid API calls limit")
 	}
 
+	if *batchLimit <= 0 {
+		log.Fatal("invalid batch limit")
+	}
+
+	if *batchTimeout <= 0 {
+		log.Fatal("invalid batch timeout")
+	}
+
+	if *subscriptionInterval <= 0 {
+		log.Fatal("invalid subscription interval")
+	}
+
+	if *alertInterval <= 0 {
+		log.Fatal("invalid alert interval")
+	}
+
+	if *verificationInterval <= 0 {
+		log.Fatal("invalid verification interval")
+	}
+
 	config, err := LoadConfig(*configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	handler.Setup(*apiLimit, config.Providers)
+	if err := handler.Setup(*apiLimit, config.Providers); err != nil {
+		log.Fatal(err)
+	}
+	if err := handler.SetupSources(config.Sources); err != nil {
+		log.Fatal(err)
+	}
+	if err := handler.SetupGeocoder(config.Geocoder); err != nil {
+		log.Fatal(err)
+	}
+	handler.SetupBatch(*batchLimit, *batchTimeout)
+	handler.SetupWebhooks(*webhookAllowPrivate)
+	if err := handler.SetupAlerts(config.Alerts); err != nil {
+		log.Fatal(err)
+	}
+	if err := handler.SetupHistory(*historyPath, *historyRetention); err != nil {
+		log.Fatal(err)
+	}
+	handler.SetupVerification(*weightedConsensus)
 
-	http.HandleFunc("/weather", handler.WeatherHandler)
+	if *grpcPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			log.Printf("gRPC server started at :%d", *grpcPort)
+			log.Fatal(handler.NewGRPCServer().Serve(listener))
+		}()
+	}
+
+	go handler.RunSubscriptions(context.Background(), *subscriptionInterval)
+	go handler.RunAlerts(context.Background(), *alertInterval)
+	go handler.RunVerification(context.Background(), *verificationInterval)
+
+	for pattern, handle := range routes {
+		http.HandleFunc(pattern, handle)
+	}
 	log.Printf("Server started at :%d", *port)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), nil))
 }
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+
+	"cycloid/test/handler"
 )
 
 func TestLoadConfig_ValidFile(t *testing.T) {
@@ -40,6 +46,86 @@ providers:
 	}
 }
 
+func TestLoadConfig_Alerts(t *testing.T) {
+	content := `
+providers:
+  openmeteo: {}
+alerts:
+  sinks:
+    ops:
+      type: webhook
+      url: "https://example.com/hook"
+  rules:
+    - id: frost
+      lat: 52.52
+      lon: 13.41
+      variable: temperature_min
+      comparator: lte
+      threshold: 0
+      min_agreement: 2
+      sinks: [ops]
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yml")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("failed to write to temp config file: %v", err)
+	}
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if cfg.Alerts.Sinks["ops"].URL != "https://example.com/hook" {
+		t.Errorf("unexpected sinks: %+v", cfg.Alerts.Sinks)
+	}
+	if len(cfg.Alerts.Rules) != 1 {
+		t.Fatalf("expected a rule, got %+v", cfg.Alerts.Rules)
+	}
+	rule := cfg.Alerts.Rules[0]
+	if rule.ID != "frost" || *rule.Lat != 52.52 || rule.Comparator != "lte" || rule.MinAgreement != 2 || rule.Sinks[0] != "ops" {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+}
+
+func TestLoadConfig_Sources(t *testing.T) {
+	content := `
+providers:
+  openmeteo: {}
+sources:
+  nws:
+    UserAgent: "test (ops@example.com)"
+  openmeteoairquality: {}
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yml")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write([]byte(content)); err != nil {
+		t.Fatalf("failed to write to temp config file: %v", err)
+	}
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if len(cfg.Providers) != 1 || len(cfg.Sources) != 2 {
+		t.Fatalf("unexpected providers %+v and sources %+v", cfg.Providers, cfg.Sources)
+	}
+	if val := cfg.Sources["nws"]["UserAgent"]; val != "test (ops@example.com)" {
+		t.Errorf("expected nws.UserAgent, got %v", val)
+	}
+}
+
 func TestLoadConfig_FileNotFound(t *testing.T) {
 	_, err := LoadConfig("nonexistent.yml")
 	if err == nil {
@@ -65,3 +151,30 @@ func TestLoadConfig_InvalidYAML(t *testing.T) {
 		t.Fatal("expected error for invalid YAML")
 	}
 }
+
+func TestRoutes_DescribedInOpenAPI(t *testing.T) {
+	w := httptest.NewRecorder()
+	handler.OpenAPIHandler(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var document struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&document); err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+
+	paths := make(map[string]bool)
+	for pattern := range routes {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			method, path = "GET", pattern
+		}
+		paths[path] = true
+		if _, ok := document.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("route %q is missing from openapi.json", pattern)
+		}
+	}
+	if len(document.Paths) != len(paths) {
+		t.Errorf("expected %d paths in openapi.json, got %d", len(paths), len(document.Paths))
+	}
+}
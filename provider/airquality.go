@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+	"time"
+)
+
+// US AQI categories, by upper bound of the index.
+const (
+	USCategoryGood                        = "good"
+	USCategoryModerate                    = "moderate"
+	USCategoryUnhealthyForSensitiveGroups = "unhealthy_for_sensitive_groups"
+	USCategoryUnhealthy                   = "unhealthy"
+	USCategoryVeryUnhealthy               = "very_unhealthy"
+	USCategoryHazardous                   = "hazardous"
+)
+
+// European AQI categories, by upper bound of the index.
+const (
+	EuropeanCategoryGood          = "good"
+	EuropeanCategoryFair          = "fair"
+	EuropeanCategoryModerate      = "moderate"
+	EuropeanCategoryPoor          = "poor"
+	EuropeanCategoryVeryPoor      = "very_poor"
+	EuropeanCategoryExtremelyPoor = "extremely_poor"
+)
+
+// AirQuality is the air at a location when it was last measured or modelled.
+// Pollutants are in µg/m³ and pollen in grains/m³, by plant. Providers that
+// do not report an index leave it to be computed from the pollutants with
+// ComputeIndexes.
+type AirQuality struct {
+	ObservedAt       time.Time          `json:"observed_at"`
+	PM25             *float64           `json:"pm2_5,omitempty"`
+	PM10             *float64           `json:"pm10,omitempty"`
+	Ozone            *float64           `json:"ozone,omitempty"`
+	NitrogenDioxide  *float64           `json:"nitrogen_dioxide,omitempty"`
+	USAQI            *float64           `json:"us_aqi,omitempty"`
+	USCategory       string             `json:"us_category,omitempty"`
+	EuropeanAQI      *float64           `json:"european_aqi,omitempty"`
+	EuropeanCategory string             `json:"european_category,omitempty"`
+	Pollen           map[string]float64 `json:"pollen,omitempty"`
+}
+
+// AirQualityProvider returns the air quality at a location. It is separate
+// from WeatherProvider: a provider may serve either or both, and those
+// serving only air quality are configured as air quality sources.
+type AirQualityProvider interface {
+	Name() string
+	GetAirQuality(ctx context.Context, lat, lon string, loc *time.Location) (AirQuality, error)
+}
+
+// breakpoints map concentrations to an index by linear interpolation, beyond
+// the last one with the slope of the last segment.
+type breakpoints struct {
+	concentrations []float64
+	indexes        []float64
+}
+
+func (b breakpoints) index(concentration float64) float64 {
+	last := len(b.concentrations) - 1
+	i := 1
+	for i < last && concentration > b.concentrations[i] {
+		i++
+	}
+	c0, c1 := b.concentrations[i-1], b.concentrations[i]
+	i0, i1 := b.indexes[i-1], b.indexes[i]
+	return i0 + (concentration-c0)*(i1-i0)/(c1-c0)
+}
+
+const (
+	// ozone and nitrogen dioxide in µg/m³ per ppb, at 25 °C
+	ozonePerPPB           = 1.96
+	nitrogenDioxidePerPPB = 1.88
+)
+
+// US EPA breakpoints, ozone and nitrogen dioxide in ppb.
+var (
+	usPM25            = breakpoints{[]float64{0, 9, 35.4, 55.4, 125.4, 225.4, 325.4}, []float64{0, 50, 100, 150, 200, 300, 500}}
+	usPM10            = breakpoints{[]float64{0, 54, 154, 254, 354, 424, 604}, []float64{0, 50, 100, 150, 200, 300, 500}}
+	usOzone           = breakpoints{[]float64{0, 54, 70, 85, 105, 200}, []float64{0, 50, 100, 150, 200, 300}}
+	usNitrogenDioxide = breakpoints{[]float64{0, 53, 100, 360, 649, 1249, 2049}, []float64{0, 50, 100, 150, 200, 300, 500}}
+)
+
+// European Environment Agency bands, spread over 20 points of index each.
+var (
+	europeanPM25            = breakpoints{[]float64{0, 10, 20, 25, 50, 75}, []float64{0, 20, 40, 60, 80, 100}}
+	europeanPM10            = breakpoints{[]float64{0, 20, 40, 50, 100, 150}, []float64{0, 20, 40, 60, 80, 100}}
+	europeanOzone           = breakpoints{[]float64{0, 50, 100, 130, 240, 380}, []float64{0, 20, 40, 60, 80, 100}}
+	europeanNitrogenDioxide = breakpoints{[]float64{0, 40, 90, 120, 230, 340}, []float64{0, 20, 40, 60, 80, 100}}
+)
+
+// maxIndex returns the highest index of the reported pollutants, nil when
+// none is reported.
+func maxIndex(pollutants []*float64, scales []breakpoints, perUnit []float64) *float64 {
+	var result *float64
+	for i, concentration := range pollutants {
+		if concentration == nil {
+			continue
+		}
+		index := scales[i].index(*concentration / perUnit[i])
+		if result == nil || index > *result {
+			result = &index
+		}
+	}
+	return result
+}
+
+// ComputeIndexes fills the indexes missing from the pollutants, the highest
+// index of any pollutant as with the official indexes, then the categories of
+// both indexes. The US index is approximated from instant concentrations
+// instead of the averages of the EPA.
+func (a *AirQuality) ComputeIndexes() {
+	pollutants := []*float64{a.PM25, a.PM10, a.Ozone, a.NitrogenDioxide}
+	if a.USAQI == nil {
+		a.USAQI = maxIndex(pollutants, []breakpoints{usPM25, usPM10, usOzone, usNitrogenDioxide}, []float64{1, 1, ozonePerPPB, nitrogenDioxidePerPPB})
+	}
+	if a.EuropeanAQI == nil {
+		a.EuropeanAQI = maxIndex(pollutants, []breakpoints{europeanPM25, europeanPM10, europeanOzone, europeanNitrogenDioxide}, []float64{1, 1, 1, 1})
+	}
+	a.USCategory, a.EuropeanCategory = "", ""
+	if a.USAQI != nil {
+		a.USCategory = category(*a.USAQI, []float64{50, 100, 150, 200, 300}, []string{
+			USCategoryGood, USCategoryModerate, USCategoryUnhealthyForSensitiveGroups,
+			USCategoryUnhealthy, USCategoryVeryUnhealthy, USCategoryHazardous,
+		})
+	}
+	if a.EuropeanAQI != nil {
+		a.EuropeanCategory = category(*a.EuropeanAQI, []float64{20, 40, 60, 80, 100}, []string{
+			EuropeanCategoryGood, EuropeanCategoryFair, EuropeanCategoryModerate,
+			EuropeanCategoryPoor, EuropeanCategoryVeryPoor, EuropeanCategoryExtremelyPoor,
+		})
+	}
+}
+
+// category returns the name of the first band whose upper bound is at least
+// index, the last name above all bounds.
+func category(index float64, bounds []float64, names []string) string {
+	for i, bound := range bounds {
+		if index <= bound {
+			return names[i]
+		}
+	}
+	return names[len(names)-1]
+}
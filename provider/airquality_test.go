@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"math"
+	"testing"
+)
+
+func floatValue(v float64) *float64 {
+	return &v
+}
+
+func TestAirQuality_ComputeIndexes(t *testing.T) {
+	air := AirQuality{PM25: floatValue(35.4), PM10: floatValue(20), NitrogenDioxide: floatValue(18.8)}
+
+	air.ComputeIndexes()
+
+	// PM2.5 dominates both indexes
+	if air.USAQI == nil || math.Abs(*air.USAQI-100) > 1e-9 || air.USCategory != USCategoryModerate {
+		t.Errorf("expected US AQI 100 moderate, got %v %s", air.USAQI, air.USCategory)
+	}
+	// 35.4 is in the 25-50 band, 60 to 80
+	if air.EuropeanAQI == nil || math.Abs(*air.EuropeanAQI-68.32) > 1e-9 || air.EuropeanCategory != EuropeanCategoryPoor {
+		t.Errorf("expected European AQI 68.32 poor, got %v %s", air.EuropeanAQI, air.EuropeanCategory)
+	}
+}
+
+func TestAirQuality_ComputeIndexesKeepsReported(t *testing.T) {
+	air := AirQuality{PM25: floatValue(5), USAQI: floatValue(160), EuropeanAQI: floatValue(120)}
+
+	air.ComputeIndexes()
+
+	if *air.USAQI != 160 || air.USCategory != USCategoryUnhealthy {
+		t.Errorf("expected the reported US AQI, got %v %s", *air.USAQI, air.USCategory)
+	}
+	if *air.EuropeanAQI != 120 || air.EuropeanCategory != EuropeanCategoryExtremelyPoor {
+		t.Errorf("expected the reported European AQI, got %v %s", *air.EuropeanAQI, air.EuropeanCategory)
+	}
+}
+
+func TestAirQuality_ComputeIndexesWithoutPollutants(t *testing.T) {
+	var air AirQuality
+
+	air.ComputeIndexes()
+
+	if air.USAQI != nil || air.EuropeanAQI != nil || air.USCategory != "" || air.EuropeanCategory != "" {
+		t.Errorf("expected no index, got %+v", air)
+	}
+}
+
+func TestBreakpoints_Extrapolate(t *testing.T) {
+	// beyond 325.4, with the 100 per 100 µg/m³ slope of the last segment
+	if got := usPM25.index(425.4); math.Abs(got-700) > 1e-9 {
+		t.Errorf("expected 700, got %v", got)
+	}
+	if got := usPM25.index(0); got != 0 {
+		t.Errorf("expected 0, got %v", got)
+	}
+}
@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CAP severities of alerts, most severe first.
+const (
+	SeverityExtreme  = "extreme"
+	SeveritySevere   = "severe"
+	SeverityModerate = "moderate"
+	SeverityMinor    = "minor"
+	SeverityUnknown  = "unknown"
+)
+
+// CAP urgencies of alerts, most urgent first.
+const (
+	UrgencyImmediate = "immediate"
+	UrgencyExpected  = "expected"
+	UrgencyFuture    = "future"
+	UrgencyPast      = "past"
+	UrgencyUnknown   = "unknown"
+)
+
+// Severities and Urgencies are the normalized CAP values, most severe and
+// urgent first.
+var (
+	Severities = []string{SeverityExtreme, SeveritySevere, SeverityModerate, SeverityMinor, SeverityUnknown}
+	Urgencies  = []string{UrgencyImmediate, UrgencyExpected, UrgencyFuture, UrgencyPast, UrgencyUnknown}
+)
+
+// Alert is a severe weather alert issued by a government agency, in the terms
+// of the Common Alerting Protocol. ID identifies the alert across the sources
+// reporting it.
+type Alert struct {
+	ID          string     `json:"id"`
+	Event       string     `json:"event"`
+	Headline    string     `json:"headline"`
+	Description string     `json:"description,omitempty"`
+	Instruction string     `json:"instruction,omitempty"`
+	Severity    string     `json:"severity"`
+	Urgency     string     `json:"urgency"`
+	Area        string     `json:"area"`
+	Sender      string     `json:"sender,omitempty"`
+	Effective   time.Time  `json:"effective"`
+	Expires     *time.Time `json:"expires,omitempty"`
+	Sources     []string   `json:"sources"`
+}
+
+// AlertSource returns the alerts in effect at a location. Sources serving a
+// part of the world only report it through Covers.
+type AlertSource interface {
+	Name() string
+	Covers(lat, lon float64) bool
+	Alerts(ctx context.Context, lat, lon string) ([]Alert, error)
+}
+
+// normalizeCAP returns the value among allowed ignoring case, the last
+// allowed one, unknown, otherwise.
+func normalizeCAP(value string, allowed []string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if slices.Contains(allowed, value) {
+		return value
+	}
+	return allowed[len(allowed)-1]
+}
+
+// parseAlertTime reads an RFC 3339 time, nil when it is missing or invalid.
+func parseAlertTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const openMeteoArchiveURI = "https://archive-api.open-meteo.com/v1/archive?latitude=%s&longitude=%s&start_date=%s&end_date=%s&daily=temperature_2m_max,temperature_2m_min,wind_speed_10m_max,precipitation_sum,pressure_msl_mean&wind_speed_unit=ms&timezone=%s"
+
+// ObservationSource returns the weather observed on past days, from start to
+// end included, in canonical units. Days not observed yet are left out.
+type ObservationSource interface {
+	Name() string
+	Observations(ctx context.Context, lat, lon string, loc *time.Location, start, end string) (ForecastDay, error)
+}
+
+// OpenMeteoArchive observes through the Open-Meteo historical weather API,
+// a reanalysis published with a delay of a few days.
+type OpenMeteoArchive struct{}
+
+func NewOpenMeteoArchive() *OpenMeteoArchive {
+	return &OpenMeteoArchive{}
+}
+
+func (o *OpenMeteoArchive) Name() string {
+	return "OpenMeteoArchive"
+}
+
+type openMeteoArchiveResponse struct {
+	Daily struct {
+		Time           []string   `json:"time"`
+		Temperature    []*float64 `json:"temperature_2m_max"`
+		TemperatureMin []*float64 `json:"temperature_2m_min"`
+		WindSpeed      []*float64 `json:"wind_speed_10m_max"`
+		Precipitation  []*float64 `json:"precipitation_sum"`
+		Pressure       []*float64 `json:"pressure_msl_mean"`
+	} `json:"daily"`
+}
+
+func (o *OpenMeteoArchive) Observations(ctx context.Context, lat, lon string, loc *time.Location, start, end string) (ForecastDay, error) {
+	var data openMeteoArchiveResponse
+	err := fetchJSON(ctx, fmt.Sprintf(openMeteoArchiveURI, lat, lon, start, end, url.QueryEscape(loc.String())), nil, &data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.Daily.Temperature) != len(data.Daily.Time) {
+		return nil, fmt.Errorf("%w: %d dates for %d temperatures", ErrInvalidResponse, len(data.Daily.Time), len(data.Daily.Temperature))
+	}
+
+	result := make(ForecastDay, len(data.Daily.Time))
+	for i, date := range data.Daily.Time {
+		// the days not published yet are null
+		if data.Daily.Temperature[i] == nil {
+			continue
+		}
+		result[date] = ForecastData{
+			Temperature:    *data.Daily.Temperature[i],
+			TemperatureMin: valueAt(data.Daily.TemperatureMin, i),
+			WindSpeed:      valueAt(data.Daily.WindSpeed, i),
+			Precipitation:  valueAt(data.Daily.Precipitation, i),
+			Pressure:       valueAt(data.Daily.Pressure, i),
+		}
+	}
+	return result, nil
+}
+
+// valueAt returns the i-th element of an optional daily series, nil when the
+// series is too short or the value is null.
+func valueAt(values []*float64, i int) *float64 {
+	if i >= len(values) {
+		return nil
+	}
+	return values[i]
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenMeteoArchive_Observations(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	var requested string
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			requested = req.URL.String()
+			return mockHTTPResponse(200, `{
+				"daily": {
+					"time": ["2025-08-01", "2025-08-02"],
+					"temperature_2m_max": [27.5, null],
+					"temperature_2m_min": [15.0, null],
+					"wind_speed_10m_max": [4.2, null],
+					"precipitation_sum": [0.4, null],
+					"pressure_msl_mean": [1013.2, null]
+				}
+			}`), nil
+		},
+	}
+
+	loc, _ := time.LoadLocation("Europe/Berlin")
+	days, err := NewOpenMeteoArchive().Observations(context.Background(), "52.52", "13.41", loc, "2025-08-01", "2025-08-02")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(requested, "start_date=2025-08-01&end_date=2025-08-02") || !strings.Contains(requested, "timezone=Europe%2FBerlin") {
+		t.Errorf("unexpected request %s", requested)
+	}
+	if len(days) != 1 {
+		t.Fatalf("expected the unpublished day to be left out, got %+v", days)
+	}
+	day := days["2025-08-01"]
+	if day.Temperature != 27.5 || *day.TemperatureMin != 15.0 || *day.Precipitation != 0.4 {
+		t.Errorf("unexpected observation: %+v", day)
+	}
+}
+
+func TestOpenMeteoArchive_MismatchedSeries(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return mockHTTPResponse(200, `{"daily": {"time": ["2025-08-01"], "temperature_2m_max": []}}`), nil
+		},
+	}
+
+	_, err := NewOpenMeteoArchive().Observations(context.Background(), "52.52", "13.41", time.UTC, "2025-08-01", "2025-08-01")
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse, got %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package provider
+
+const (
+	VariableTemperatureMax = "temperature_max"
+	VariableTemperatureMin = "temperature_min"
+	VariableWindSpeed      = "wind_speed"
+	VariablePrecipitation  = "precipitation"
+	VariablePressure       = "pressure"
+)
+
+// BoundingBox is a rectangular area in degrees. Boxes crossing the antimeridian
+// are declared as two boxes.
+type BoundingBox struct {
+	MinLat float64 `json:"min_lat"`
+	MinLon float64 `json:"min_lon"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLon float64 `json:"max_lon"`
+}
+
+// Capabilities describes what a provider supports. An empty Coverage means worldwide.
+// Current providers implement CurrentProvider, historical ones
+// HistoricalProvider and air quality ones AirQualityProvider.
+type Capabilities struct {
+	Variables       []string `json:"variables"`
+	MaxForecastDays int      `json:"max_forecast_days"`
+	Hourly          bool     `json:"hourly"`
+	Current         bool     `json:"current"`
+	Historical      bool     `json:"historical"`
+	AirQuality      bool     `json:"air_quality"`
+	Coverage        Coverage `json:"coverage,omitempty"`
+	RequiresAPIKey  bool     `json:"requires_api_key"`
+	Attribution     string   `json:"attribution"`
+	License         string   `json:"license"`
+}
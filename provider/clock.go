@@ -0,0 +1,25 @@
+package provider
+
+import "time"
+
+// Clock tells the current time. Providers, the aggregator and the caches take
+// one so tests can freeze and advance time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock
+	}
+	return clock
+}
@@ -0,0 +1,152 @@
+package provider
+
+import (
+	"fmt"
+)
+
+// Point is a coordinate in degrees.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Area is either a bounding box or a polygon.
+type Area struct {
+	BoundingBox *BoundingBox `json:"bbox,omitempty"`
+	Polygon     []Point      `json:"polygon,omitempty"`
+}
+
+// Coverage is the list of areas a provider serves. An empty Coverage means worldwide.
+type Coverage []Area
+
+func (b BoundingBox) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+func (a Area) Contains(lat, lon float64) bool {
+	if a.BoundingBox != nil {
+		return a.BoundingBox.Contains(lat, lon)
+	}
+
+	// ray casting along the latitude of the point
+	inside := false
+	for i, j := 0, len(a.Polygon)-1; i < len(a.Polygon); j, i = i, i+1 {
+		pi, pj := a.Polygon[i], a.Polygon[j]
+		if (pi.Lat > lat) != (pj.Lat > lat) &&
+			lon < (pj.Lon-pi.Lon)*(lat-pi.Lat)/(pj.Lat-pi.Lat)+pi.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func (c Coverage) Contains(lat, lon float64) bool {
+	if len(c) == 0 {
+		return true
+	}
+	for _, area := range c {
+		if area.Contains(lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCoverage reads the Coverage provider parameter as decoded from config.yml:
+//
+//	Coverage:
+//	  - BoundingBox: [54.5, 8.0, 57.8, 15.2] # min lat, min lon, max lat, max lon
+//	  - Polygon: [[54.5, 8.0], [57.8, 8.0], [57.8, 15.2]]
+//
+// A nil value yields worldwide coverage.
+func ParseCoverage(value any) (Coverage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if coverage, ok := value.(Coverage); ok {
+		return coverage, nil
+	}
+
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("coverage must be a list of areas")
+	}
+
+	coverage := make(Coverage, 0, len(list))
+	for _, item := range list {
+		fields := stringKeyMap(item)
+		if fields == nil {
+			return nil, fmt.Errorf("coverage area must be a map")
+		}
+
+		switch {
+		case fields["BoundingBox"] != nil:
+			values, err := floatList(fields["BoundingBox"])
+			if err != nil || len(values) != 4 {
+				return nil, fmt.Errorf("coverage bounding box must be [min lat, min lon, max lat, max lon]")
+			}
+			box := BoundingBox{MinLat: values[0], MinLon: values[1], MaxLat: values[2], MaxLon: values[3]}
+			if box.MinLat > box.MaxLat || box.MinLon > box.MaxLon {
+				return nil, fmt.Errorf("coverage bounding box has min greater than max")
+			}
+			coverage = append(coverage, Area{BoundingBox: &box})
+		case fields["Polygon"] != nil:
+			vertices, ok := fields["Polygon"].([]any)
+			if !ok || len(vertices) < 3 {
+				return nil, fmt.Errorf("coverage polygon must have at least 3 points")
+			}
+			polygon := make([]Point, 0, len(vertices))
+			for _, vertex := range vertices {
+				values, err := floatList(vertex)
+				if err != nil || len(values) != 2 {
+					return nil, fmt.Errorf("coverage polygon points must be [lat, lon]")
+				}
+				polygon = append(polygon, Point{Lat: values[0], Lon: values[1]})
+			}
+			coverage = append(coverage, Area{Polygon: polygon})
+		default:
+			return nil, fmt.Errorf("coverage area must have a BoundingBox or a Polygon")
+		}
+	}
+	return coverage, nil
+}
+
+func stringKeyMap(value any) map[string]any {
+	switch m := value.(type) {
+	case map[string]any:
+		return m
+	case map[any]any:
+		result := make(map[string]any, len(m))
+		for k, v := range m {
+			result[fmt.Sprint(k)] = v
+		}
+		return result
+	}
+	return nil
+}
+
+func floatList(value any) ([]float64, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of numbers")
+	}
+	result := make([]float64, 0, len(list))
+	for _, item := range list {
+		switch v := item.(type) {
+		case float64:
+			result = append(result, v)
+		case int:
+			result = append(result, float64(v))
+		default:
+			return nil, fmt.Errorf("expected a number, got %v", item)
+		}
+	}
+	return result, nil
+}
+
+// coverageParam parses the Coverage parameter, treating invalid values as
+// worldwide; they are rejected when the providers are set up.
+func coverageParam(value any) Coverage {
+	coverage, _ := ParseCoverage(value)
+	return coverage
+}
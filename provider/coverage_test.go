@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseCoverage(t *testing.T) {
+	var params map[string]any
+	err := yaml.Unmarshal([]byte(`
+Coverage:
+  - BoundingBox: [54.5, 8, 57.8, 15.2]
+  - Polygon: [[-10, -10], [-10, 10], [10, 0]]
+`), &params)
+	if err != nil {
+		t.Fatalf("invalid YAML: %v", err)
+	}
+
+	coverage, err := ParseCoverage(params["Coverage"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(coverage) != 2 {
+		t.Fatalf("expected 2 areas, got %d", len(coverage))
+	}
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		expected bool
+	}{
+		{"inside box", 55.68, 12.57, true},
+		{"inside polygon", 0, 2, true},
+		{"outside polygon", 0, -9, false},
+		{"outside both", 52.52, 13.41, false},
+	}
+	for _, tt := range tests {
+		if got := coverage.Contains(tt.lat, tt.lon); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestParseCoverage_Worldwide(t *testing.T) {
+	coverage, err := ParseCoverage(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !coverage.Contains(-89, 179) {
+		t.Error("expected empty coverage to contain every point")
+	}
+}
+
+func TestParseCoverage_Invalid(t *testing.T) {
+	invalid := []any{
+		"everywhere",
+		[]any{map[any]any{"BoundingBox": []any{1, 2, 3}}},
+		[]any{map[any]any{"BoundingBox": []any{10, 0, 5, 1}}},
+		[]any{map[any]any{"Polygon": []any{[]any{0, 0}, []any{1, 1}}}},
+		[]any{map[any]any{"Circle": 5}},
+	}
+	for _, value := range invalid {
+		if _, err := ParseCoverage(value); err == nil {
+			t.Errorf("expected an error for %v", value)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"time"
+)
+
+// Normalized weather conditions, shared by every provider so the conditions
+// of several providers can be compared.
+const (
+	ConditionClear        = "clear"
+	ConditionPartlyCloudy = "partly_cloudy"
+	ConditionCloudy       = "cloudy"
+	ConditionFog          = "fog"
+	ConditionDrizzle      = "drizzle"
+	ConditionRain         = "rain"
+	ConditionSleet        = "sleet"
+	ConditionSnow         = "snow"
+	ConditionThunderstorm = "thunderstorm"
+)
+
+// CurrentConditions are the conditions at a location when they were last
+// observed or analysed, in canonical units with humidity in percent.
+// Description is the provider's own wording of Condition, when it has one.
+type CurrentConditions struct {
+	ObservedAt  time.Time `json:"observed_at"`
+	Temperature float64   `json:"temperature"`
+	FeelsLike   *float64  `json:"feels_like,omitempty"`
+	WindSpeed   *float64  `json:"wind_speed,omitempty"`
+	Humidity    *float64  `json:"humidity,omitempty"`
+	Pressure    *float64  `json:"pressure,omitempty"`
+	Condition   string    `json:"condition,omitempty"`
+	Description string    `json:"description,omitempty"`
+}
+
+// CurrentProvider is a WeatherProvider that also reports current conditions.
+type CurrentProvider interface {
+	WeatherProvider
+	GetCurrent(ctx context.Context, lat, lon string, loc *time.Location) (CurrentConditions, error)
+}
+
+// wmoConditions normalizes the WMO weather interpretation codes of Open-Meteo.
+var wmoConditions = map[int]string{
+	0: ConditionClear, 1: ConditionClear, 2: ConditionPartlyCloudy, 3: ConditionCloudy,
+	45: ConditionFog, 48: ConditionFog,
+	51: ConditionDrizzle, 53: ConditionDrizzle, 55: ConditionDrizzle,
+	56: ConditionSleet, 57: ConditionSleet, 66: ConditionSleet, 67: ConditionSleet,
+	61: ConditionRain, 63: ConditionRain, 65: ConditionRain,
+	80: ConditionRain, 81: ConditionRain, 82: ConditionRain,
+	71: ConditionSnow, 73: ConditionSnow, 75: ConditionSnow, 77: ConditionSnow,
+	85: ConditionSnow, 86: ConditionSnow,
+	95: ConditionThunderstorm, 96: ConditionThunderstorm, 99: ConditionThunderstorm,
+}
+
+// weatherAPIConditions normalizes the condition codes of WeatherAPI.
+var weatherAPIConditions = map[int]string{
+	1000: ConditionClear, 1003: ConditionPartlyCloudy, 1006: ConditionCloudy, 1009: ConditionCloudy,
+	1030: ConditionFog, 1135: ConditionFog, 1147: ConditionFog,
+	1150: ConditionDrizzle, 1153: ConditionDrizzle,
+	1063: ConditionRain, 1180: ConditionRain, 1183: ConditionRain, 1186: ConditionRain,
+	1189: ConditionRain, 1192: ConditionRain, 1195: ConditionRain,
+	1240: ConditionRain, 1243: ConditionRain, 1246: ConditionRain,
+	1069: ConditionSleet, 1072: ConditionSleet, 1168: ConditionSleet, 1171: ConditionSleet,
+	1198: ConditionSleet, 1201: ConditionSleet, 1204: ConditionSleet, 1207: ConditionSleet,
+	1237: ConditionSleet, 1249: ConditionSleet, 1252: ConditionSleet,
+	1261: ConditionSleet, 1264: ConditionSleet,
+	1066: ConditionSnow, 1114: ConditionSnow, 1117: ConditionSnow,
+	1210: ConditionSnow, 1213: ConditionSnow, 1216: ConditionSnow, 1219: ConditionSnow,
+	1222: ConditionSnow, 1225: ConditionSnow, 1255: ConditionSnow, 1258: ConditionSnow,
+	1087: ConditionThunderstorm, 1273: ConditionThunderstorm, 1276: ConditionThunderstorm,
+	1279: ConditionThunderstorm, 1282: ConditionThunderstorm,
+}
@@ -0,0 +1,12 @@
+package provider
+
+import "errors"
+
+var (
+	// ErrMissingParam is returned when a required provider parameter is not configured.
+	ErrMissingParam = errors.New("missing provider parameter")
+	// ErrUpstreamStatus is returned when the upstream API answers with a non-200 status.
+	ErrUpstreamStatus = errors.New("unexpected upstream status")
+	// ErrInvalidResponse is returned when the upstream body cannot be decoded or lacks forecast data.
+	ErrInvalidResponse = errors.New("invalid upstream response")
+)
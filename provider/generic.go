@@ -0,0 +1,359 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Generic is a provider declared entirely in config.yml. Its parameters are:
+//   - URL: request URL template, may contain {lat}, {lon}, {start_date}, {end_date}, {days} and {timezone}
+//   - Query: optional map of extra query parameters, values may use the same placeholders
+//   - AuthHeader, AuthValue: optional header sent with every request
+//   - DatePath, TemperaturePath: required paths to the date and daily max temperature arrays
+//   - TemperatureMinPath: optional path to the daily min temperature array
+//   - WindSpeedPath, PrecipitationPath, PressurePath: optional paths to the daily max wind
+//     speed, precipitation sum and mean pressure arrays
+//   - TemperatureUnit (celsius, fahrenheit, kelvin), WindSpeedUnit (ms, kmh, mph, kn),
+//     PrecipitationUnit (mm, inch), PressureUnit (hpa, pa, inhg): optional native units
+//     of the values, converted to °C, m/s, mm and hPa
+//   - MaxForecastDays, Attribution, License: optional values reported in Capabilities
+//
+// Paths are dot separated, e.g. "daily.time" or "forecast.forecastday[*].day.maxtemp_c",
+// with an optional leading "$." as in JSONPath.
+type Generic struct {
+	name     string
+	params   map[string]any
+	coverage Coverage
+	clock    Clock
+}
+
+func NewGeneric(name string, clock Clock) *Generic {
+	return &Generic{
+		name:   name,
+		params: make(map[string]any),
+		clock:  clock,
+	}
+}
+
+func (g *Generic) Name() string {
+	return g.name
+}
+
+func (g *Generic) Capabilities() Capabilities {
+	capabilities := Capabilities{
+		Variables:       []string{VariableTemperatureMax},
+		MaxForecastDays: FetchDaysCount,
+		Coverage:        g.coverage,
+		RequiresAPIKey:  g.stringParam("AuthHeader") != "",
+		Attribution:     g.stringParam("Attribution"),
+		License:         g.stringParam("License"),
+	}
+	for _, series := range genericOptionalSeries {
+		if g.stringParam(series.path) != "" {
+			capabilities.Variables = append(capabilities.Variables, series.variable)
+		}
+	}
+	if days, ok := g.params["MaxForecastDays"].(int); ok && days > 0 {
+		capabilities.MaxForecastDays = days
+	}
+	return capabilities
+}
+
+func (g *Generic) GetParams(name string) any {
+	return g.params[name]
+}
+
+func (g *Generic) SetParams(name string, value any) {
+	g.params[name] = value
+	if name == "Coverage" {
+		g.coverage = coverageParam(value)
+	}
+}
+
+func (g *Generic) stringParam(name string) string {
+	value, _ := g.params[name].(string)
+	return value
+}
+
+// Validate reports missing required parameters, so a broken declaration fails at startup.
+func (g *Generic) Validate() error {
+	for _, name := range []string{"URL", "DatePath", "TemperaturePath"} {
+		if g.stringParam(name) == "" {
+			return fmt.Errorf("%w: %s %s", ErrMissingParam, g.name, name)
+		}
+	}
+	if (g.stringParam("AuthHeader") == "") != (g.stringParam("AuthValue") == "") {
+		return fmt.Errorf("%w: %s AuthHeader and AuthValue must be set together", ErrMissingParam, g.name)
+	}
+	if _, err := url.Parse(g.stringParam("URL")); err != nil {
+		return fmt.Errorf("%s: invalid URL: %w", g.name, err)
+	}
+	for param := range nativeUnits {
+		if _, err := g.converter(param); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// converter returns the function normalizing values of the unit parameter
+// param, the identity when it is unset.
+func (g *Generic) converter(param string) (func(float64) float64, error) {
+	unit := strings.ToLower(g.stringParam(param))
+	if unit == "" {
+		return func(v float64) float64 { return v }, nil
+	}
+	convert, ok := nativeUnits[param][unit]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown %s %q", g.name, param, unit)
+	}
+	return convert, nil
+}
+
+// requestURL fills the placeholders of the URL template, path escaped in its
+// path and raw in its query, which is encoded as a whole.
+func (g *Generic) requestURL(lat, lon string, loc *time.Location) (string, error) {
+	dates := ForecastDates(g.clock, loc)
+	values := map[string]string{
+		"{lat}":        lat,
+		"{lon}":        lon,
+		"{start_date}": dates[0],
+		"{end_date}":   dates[len(dates)-1],
+		"{days}":       strconv.Itoa(FetchDaysCount),
+		"{timezone}":   loc.String(),
+	}
+	var raw, escaped []string
+	for placeholder, value := range values {
+		raw = append(raw, placeholder, value)
+		escaped = append(escaped, placeholder, url.PathEscape(value))
+	}
+	replacer := strings.NewReplacer(raw...)
+
+	base, rawQuery, _ := strings.Cut(g.stringParam("URL"), "?")
+	u, err := url.Parse(strings.NewReplacer(escaped...).Replace(base))
+	if err != nil {
+		return "", err
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", err
+	}
+	for name, values := range query {
+		for i, value := range values {
+			values[i] = replacer.Replace(value)
+		}
+		query[name] = values
+	}
+	for name, value := range stringMap(g.params["Query"]) {
+		query.Set(name, replacer.Replace(value))
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func (g *Generic) GetForecast(ctx context.Context, lat, lon string, loc *time.Location) (ForecastDay, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	url, err := g.requestURL(lat, lon, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+	if name := g.stringParam("AuthHeader"); name != "" {
+		header.Set(name, g.stringParam("AuthValue"))
+	}
+
+	var data any
+
+	err = fetchJSON(ctx, url, header, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	forecast, err := g.extractForecast(data)
+	if err != nil {
+		return nil, err
+	}
+	trimToWindow(forecast, g.clock, loc)
+	return forecast, nil
+}
+
+// genericOptionalSeries lists the optional daily series of a Generic
+// provider with the path and unit parameters that describe them.
+var genericOptionalSeries = []struct {
+	path     string
+	unit     string
+	variable string
+	field    func(*ForecastData) **float64
+}{
+	{"TemperatureMinPath", "TemperatureUnit", VariableTemperatureMin, func(d *ForecastData) **float64 { return &d.TemperatureMin }},
+	{"WindSpeedPath", "WindSpeedUnit", VariableWindSpeed, func(d *ForecastData) **float64 { return &d.WindSpeed }},
+	{"PrecipitationPath", "PrecipitationUnit", VariablePrecipitation, func(d *ForecastData) **float64 { return &d.Precipitation }},
+	{"PressurePath", "PressureUnit", VariablePressure, func(d *ForecastData) **float64 { return &d.Pressure }},
+}
+
+func (g *Generic) extractForecast(data any) (ForecastDay, error) {
+	dates, err := extractPath(data, g.stringParam("DatePath"))
+	if err != nil {
+		return nil, err
+	}
+	temps, err := extractPath(data, g.stringParam("TemperaturePath"))
+	if err != nil {
+		return nil, err
+	}
+	if len(dates) == 0 || len(dates) != len(temps) {
+		return nil, fmt.Errorf("%w: %d dates for %d temperatures", ErrInvalidResponse, len(dates), len(temps))
+	}
+	celsius, err := g.converter("TemperatureUnit")
+	if err != nil {
+		return nil, err
+	}
+
+	forecast := make(ForecastDay)
+	for i := range dates {
+		date, ok := dates[i].(string)
+		if !ok || len(date) < len("2006-01-02") {
+			return nil, fmt.Errorf("%w: unexpected date %v", ErrInvalidResponse, dates[i])
+		}
+		date = date[:len("2006-01-02")]
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("%w: unexpected date %v", ErrInvalidResponse, dates[i])
+		}
+
+		temp, ok := temps[i].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected temperature %v", ErrInvalidResponse, temps[i])
+		}
+		forecast[date] = ForecastData{Temperature: celsius(temp)}
+	}
+
+	for _, series := range genericOptionalSeries {
+		path := g.stringParam(series.path)
+		if path == "" {
+			continue
+		}
+		values, err := extractPath(data, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != len(dates) {
+			return nil, fmt.Errorf("%w: %d dates for %d values of %s", ErrInvalidResponse, len(dates), len(values), series.path)
+		}
+		convert, err := g.converter(series.unit)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, value := range values {
+			// null values are left unset
+			if value == nil {
+				continue
+			}
+			v, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%w: unexpected value %v for %s", ErrInvalidResponse, value, series.path)
+			}
+			date := dates[i].(string)[:len("2006-01-02")]
+			day := forecast[date]
+			v = convert(v)
+			*series.field(&day) = &v
+			forecast[date] = day
+		}
+	}
+
+	return forecast, nil
+}
+
+// extractPath walks a decoded JSON document along a dot separated path.
+// A segment may carry an index ("list[0]") or a wildcard ("list[*]" or "*")
+// that fans out over every element of an array. A path ending on an array
+// returns its elements.
+func extractPath(data any, path string) ([]any, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+
+	values := []any{data}
+	for _, segment := range strings.Split(path, ".") {
+		if segment == "" {
+			return nil, fmt.Errorf("%w: invalid path %q", ErrInvalidResponse, path)
+		}
+
+		key, index := segment, ""
+		if open := strings.Index(segment, "["); open >= 0 && strings.HasSuffix(segment, "]") {
+			key, index = segment[:open], segment[open+1:len(segment)-1]
+		}
+		if key == "*" {
+			key, index = "", "*"
+		}
+
+		next := make([]any, 0, len(values))
+		for _, value := range values {
+			if key != "" {
+				object, ok := value.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("%w: %q is not an object", ErrInvalidResponse, key)
+				}
+				value, ok = object[key]
+				if !ok {
+					return nil, fmt.Errorf("%w: missing field %q", ErrInvalidResponse, key)
+				}
+			}
+
+			if index == "" {
+				next = append(next, value)
+				continue
+			}
+
+			array, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%w: %q is not an array", ErrInvalidResponse, segment)
+			}
+			if index == "*" {
+				next = append(next, array...)
+				continue
+			}
+			i, err := strconv.Atoi(index)
+			if err != nil || i < 0 || i >= len(array) {
+				return nil, fmt.Errorf("%w: invalid index in %q", ErrInvalidResponse, segment)
+			}
+			next = append(next, array[i])
+		}
+		values = next
+	}
+
+	if len(values) == 1 {
+		if array, ok := values[0].([]any); ok {
+			return array, nil
+		}
+	}
+	return values, nil
+}
+
+// stringMap converts a map decoded from YAML into map[string]string.
+func stringMap(value any) map[string]string {
+	result := make(map[string]string)
+	switch m := value.(type) {
+	case map[string]any:
+		for k, v := range m {
+			result[k] = fmt.Sprint(v)
+		}
+	case map[any]any:
+		for k, v := range m {
+			result[fmt.Sprint(k)] = fmt.Sprint(v)
+		}
+	case map[string]string:
+		for k, v := range m {
+			result[k] = v
+		}
+	}
+	return result
+}
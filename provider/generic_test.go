@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newTestGeneric() *Generic {
+	g := NewGeneric("mysource", testClock)
+	g.SetParams("URL", "https://example.com/forecast?lat={lat}&lon={lon}")
+	g.SetParams("Query", map[any]any{"days": "{days}", "units": "metric"})
+	g.SetParams("AuthHeader", "X-API-Key")
+	g.SetParams("AuthValue", "secret")
+	g.SetParams("DatePath", "$.daily.time")
+	g.SetParams("TemperaturePath", "daily.temperature_2m_max")
+	g.SetParams("TemperatureMinPath", "daily.temperature_2m_min")
+	return g
+}
+
+func TestGenericGetForecast_Success(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if got := req.Header.Get("X-API-Key"); got != "secret" {
+				t.Errorf("expected auth header, got %q", got)
+			}
+			query := req.URL.Query()
+			if query.Get("lat") != "52.52" || query.Get("lon") != "13.41" || query.Get("days") != "5" || query.Get("units") != "metric" {
+				t.Errorf("unexpected query: %s", req.URL.RawQuery)
+			}
+			return mockHTTPResponse(200, `{
+				"daily": {
+					"time": ["2025-08-01", "2025-08-02"],
+					"temperature_2m_max": [27.5, 25.0],
+					"temperature_2m_min": [15.0, 14.5]
+				}
+			}`), nil
+		},
+	}
+
+	forecast, err := newTestGeneric().GetForecast(context.Background(), "52.52", "13.41", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	day, ok := forecast["2025-08-02"]
+	if !ok {
+		t.Fatal("expected 2025-08-02 in forecast")
+	}
+	if day.Temperature != 25.0 || day.TemperatureMin == nil || *day.TemperatureMin != 14.5 {
+		t.Errorf("unexpected day: %+v", day)
+	}
+}
+
+func TestGenericRequestURL_Timezone(t *testing.T) {
+	loc, err := time.LoadLocation("America/Argentina/Buenos_Aires")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGeneric("mysource", testClock)
+	g.SetParams("URL", "https://example.com/forecast/{timezone}/{lat},{lon}?tz={timezone}")
+	g.SetParams("Query", map[any]any{"zone": "{timezone}"})
+
+	u, err := g.requestURL("-34.6", "-58.38", loc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", u, err)
+	}
+	if path := parsed.EscapedPath(); path != "/forecast/America%2FArgentina%2FBuenos_Aires/-34.6,-58.38" {
+		t.Errorf("expected the timezone escaped as one path segment, got %s", path)
+	}
+	query := parsed.Query()
+	if query.Get("tz") != loc.String() || query.Get("zone") != loc.String() {
+		t.Errorf("expected the raw timezone in the query, got %s", parsed.RawQuery)
+	}
+}
+
+func TestGenericGetForecast_BadStatus(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return mockHTTPResponse(503, `unavailable`), nil
+		},
+	}
+
+	_, err := newTestGeneric().GetForecast(context.Background(), "52.52", "13.41", nil)
+	if !errors.Is(err, ErrUpstreamStatus) {
+		t.Fatalf("expected ErrUpstreamStatus, got %v", err)
+	}
+}
+
+func TestGenericGetForecast_MismatchedArrays(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return mockHTTPResponse(200, `{
+				"daily": {
+					"time": ["2025-08-01", "2025-08-02"],
+					"temperature_2m_max": [27.5],
+					"temperature_2m_min": [15.0]
+				}
+			}`), nil
+		},
+	}
+
+	_, err := newTestGeneric().GetForecast(context.Background(), "52.52", "13.41", nil)
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("expected ErrInvalidResponse, got %v", err)
+	}
+}
+
+func TestGenericValidate_MissingParams(t *testing.T) {
+	g := NewGeneric("broken", testClock)
+	g.SetParams("URL", "https://example.com")
+
+	if err := g.Validate(); !errors.Is(err, ErrMissingParam) {
+		t.Fatalf("expected ErrMissingParam, got %v", err)
+	}
+}
+
+func TestGenericExtractForecast_NativeUnits(t *testing.T) {
+	g := newTestGeneric()
+	g.SetParams("WindSpeedPath", "daily.wind")
+	g.SetParams("PressurePath", "daily.pressure")
+	g.SetParams("TemperatureUnit", "fahrenheit")
+	g.SetParams("WindSpeedUnit", "kmh")
+	g.SetParams("PressureUnit", "inhg")
+
+	var data any
+	json.Unmarshal([]byte(`{
+		"daily": {
+			"time": ["2025-08-01"],
+			"temperature_2m_max": [86],
+			"temperature_2m_min": [50],
+			"wind": [36],
+			"pressure": [null]
+		}
+	}`), &data)
+
+	forecast, err := g.extractForecast(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	day := forecast["2025-08-01"]
+	if day.Temperature != 30 || *day.TemperatureMin != 10 || *day.WindSpeed != 10 {
+		t.Errorf("expected 30 °C, 10 °C and 10 m/s, got %+v", day)
+	}
+	if day.Pressure != nil {
+		t.Errorf("expected null pressure to be omitted, got %v", *day.Pressure)
+	}
+}
+
+func TestGenericValidate_UnknownUnit(t *testing.T) {
+	g := newTestGeneric()
+	g.SetParams("WindSpeedUnit", "beaufort")
+
+	if err := g.Validate(); err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+}
+
+func TestExtractPath_Wildcard(t *testing.T) {
+	var data any
+	err := json.Unmarshal([]byte(`{
+		"forecast": {
+			"forecastday": [
+				{"date": "2025-08-01", "day": {"maxtemp_c": 29.1}},
+				{"date": "2025-08-02", "day": {"maxtemp_c": 30.2}}
+			]
+		}
+	}`), &data)
+	if err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	temps, err := extractPath(data, "forecast.forecastday[*].day.maxtemp_c")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(temps) != 2 || temps[1] != 30.2 {
+		t.Errorf("unexpected values: %v", temps)
+	}
+
+	first, err := extractPath(data, "forecast.forecastday[0].date")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first) != 1 || first[0] != "2025-08-01" {
+		t.Errorf("unexpected values: %v", first)
+	}
+
+	if _, err := extractPath(data, "forecast.missing"); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HistoricalProvider is a WeatherProvider that also returns the weather of
+// past days from an archive.
+type HistoricalProvider interface {
+	WeatherProvider
+	// HistoricalChunkDays is the longest range GetHistorical is called with.
+	HistoricalChunkDays() int
+	// GetHistorical returns the days from start to end included, keyed by
+	// dates of the calendar days in loc. Days the archive has no data for yet
+	// are left out.
+	GetHistorical(ctx context.Context, lat, lon string, loc *time.Location, start, end string) (ForecastDay, error)
+}
+
+// DateRange returns the dates from start to end included.
+func DateRange(start, end string) ([]string, error) {
+	first, err := time.Parse(time.DateOnly, start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date %q", start)
+	}
+	last, err := time.Parse(time.DateOnly, end)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date %q", end)
+	}
+	var dates []string
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format(time.DateOnly))
+	}
+	return dates, nil
+}
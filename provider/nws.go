@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const (
+	nwsAlertsURI = "https://api.weather.gov/alerts/active?point=%s,%s"
+
+	defaultNWSUserAgent = "weather-aggregator"
+)
+
+// nwsCoverage is the United States and their territories.
+var nwsCoverage = Coverage{
+	{BoundingBox: &BoundingBox{MinLat: 24.4, MinLon: -125.0, MaxLat: 49.4, MaxLon: -66.9}},
+	{BoundingBox: &BoundingBox{MinLat: 51.2, MinLon: -180.0, MaxLat: 71.5, MaxLon: -129.9}},
+	{BoundingBox: &BoundingBox{MinLat: 51.2, MinLon: 172.0, MaxLat: 53.1, MaxLon: 180.0}},
+	{BoundingBox: &BoundingBox{MinLat: 18.9, MinLon: -160.3, MaxLat: 22.3, MaxLon: -154.8}},
+	{BoundingBox: &BoundingBox{MinLat: 17.6, MinLon: -67.3, MaxLat: 18.6, MaxLon: -64.5}},
+	{BoundingBox: &BoundingBox{MinLat: 13.2, MinLon: 144.6, MaxLat: 20.6, MaxLon: 146.1}},
+	{BoundingBox: &BoundingBox{MinLat: -14.6, MinLon: -171.1, MaxLat: -11.0, MaxLon: -168.1}},
+}
+
+// NWS is the alert source of the US National Weather Service, which publishes
+// CAP alerts. Its parameters are:
+//   - UserAgent: optional User-Agent of the requests, which the NWS asks to
+//     identify the application and a contact
+//   - Coverage: optional coverage replacing the United States
+type NWS struct {
+	params   map[string]any
+	coverage Coverage
+}
+
+func NewNWS() *NWS {
+	return &NWS{params: make(map[string]any)}
+}
+
+func (n *NWS) Name() string {
+	return "NWS"
+}
+
+func (n *NWS) GetParams(name string) any {
+	return n.params[name]
+}
+
+func (n *NWS) SetParams(name string, value any) {
+	n.params[name] = value
+	if name == "Coverage" {
+		n.coverage = coverageParam(value)
+	}
+}
+
+func (n *NWS) Covers(lat, lon float64) bool {
+	if coverage := n.coverage; coverage != nil {
+		return coverage.Contains(lat, lon)
+	}
+	return nwsCoverage.Contains(lat, lon)
+}
+
+type nwsAlertsResponse struct {
+	Features []struct {
+		Properties struct {
+			AreaDesc    string `json:"areaDesc"`
+			Effective   string `json:"effective"`
+			Expires     string `json:"expires"`
+			Severity    string `json:"severity"`
+			Urgency     string `json:"urgency"`
+			Event       string `json:"event"`
+			Headline    string `json:"headline"`
+			Description string `json:"description"`
+			Instruction string `json:"instruction"`
+			SenderName  string `json:"senderName"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+func (n *NWS) Alerts(ctx context.Context, lat, lon string) ([]Alert, error) {
+	userAgent, _ := n.GetParams("UserAgent").(string)
+	if userAgent == "" {
+		userAgent = defaultNWSUserAgent
+	}
+	header := http.Header{"User-Agent": {userAgent}, "Accept": {"application/geo+json"}}
+
+	var data nwsAlertsResponse
+	if err := fetchJSON(ctx, fmt.Sprintf(nwsAlertsURI, lat, lon), header, &data); err != nil {
+		return nil, err
+	}
+
+	alerts := make([]Alert, 0, len(data.Features))
+	for _, feature := range data.Features {
+		p := feature.Properties
+		alert := Alert{
+			Event:       p.Event,
+			Headline:    p.Headline,
+			Description: p.Description,
+			Instruction: p.Instruction,
+			Severity:    normalizeCAP(p.Severity, Severities),
+			Urgency:     normalizeCAP(p.Urgency, Urgencies),
+			Area:        p.AreaDesc,
+			Sender:      p.SenderName,
+			Expires:     parseAlertTime(p.Expires),
+			Sources:     []string{n.Name()},
+		}
+		if effective := parseAlertTime(p.Effective); effective != nil {
+			alert.Effective = *effective
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNWSAlerts(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Query().Get("point") != "35.47,-97.52" {
+				t.Errorf("unexpected request %s", req.URL)
+			}
+			if ua := req.Header.Get("User-Agent"); ua != "test (ops@example.com)" {
+				t.Errorf("unexpected User-Agent %q", ua)
+			}
+			return mockHTTPResponse(200, `{
+				"features": [{
+					"properties": {
+						"areaDesc": "Oklahoma, OK",
+						"effective": "2024-05-06T15:04:00-05:00",
+						"expires": "2024-05-06T22:00:00-05:00",
+						"severity": "Extreme",
+						"urgency": "Immediate",
+						"event": "Tornado Warning",
+						"headline": "Tornado Warning issued May 6",
+						"description": "At 304 PM CDT...",
+						"instruction": "TAKE COVER NOW!",
+						"senderName": "NWS Norman OK"
+					}
+				}, {
+					"properties": {"event": "Special Weather Statement", "severity": "Bogus", "urgency": "", "effective": "2024-05-06T15:00:00-05:00", "expires": null}
+				}]
+			}`), nil
+		},
+	}
+
+	nws := NewNWS()
+	nws.SetParams("UserAgent", "test (ops@example.com)")
+	alerts, err := nws.Alerts(context.Background(), "35.47", "-97.52")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(alerts))
+	}
+
+	tornado := alerts[0]
+	if tornado.Severity != SeverityExtreme || tornado.Urgency != UrgencyImmediate || tornado.Sender != "NWS Norman OK" || tornado.Area != "Oklahoma, OK" {
+		t.Errorf("unexpected alert: %+v", tornado)
+	}
+	if !tornado.Effective.Equal(time.Date(2024, 5, 6, 20, 4, 0, 0, time.UTC)) || tornado.Expires == nil || tornado.Expires.Hour() != 3 {
+		t.Errorf("unexpected times %v to %v", tornado.Effective, tornado.Expires)
+	}
+	if len(tornado.Sources) != 1 || tornado.Sources[0] != "NWS" {
+		t.Errorf("unexpected sources %v", tornado.Sources)
+	}
+
+	statement := alerts[1]
+	if statement.Severity != SeverityUnknown || statement.Urgency != UrgencyUnknown || statement.Expires != nil {
+		t.Errorf("expected unknown severity and urgency without expiry, got %+v", statement)
+	}
+}
+
+func TestNWSCovers(t *testing.T) {
+	nws := NewNWS()
+	for _, tt := range []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"Oklahoma City", 35.47, -97.52, true},
+		{"Anchorage", 61.22, -149.9, true},
+		{"Honolulu", 21.31, -157.86, true},
+		{"San Juan", 18.47, -66.11, true},
+		{"Berlin", 52.52, 13.41, false},
+	} {
+		if got := nws.Covers(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	nws.SetParams("Coverage", Coverage{{BoundingBox: &BoundingBox{MinLat: 50, MinLon: 10, MaxLat: 55, MaxLon: 15}}})
+	if !nws.Covers(52.52, 13.41) || nws.Covers(35.47, -97.52) {
+		t.Error("expected the Coverage parameter to replace the United States")
+	}
+}
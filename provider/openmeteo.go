@@ -2,46 +2,78 @@ package provider
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"net/url"
 	"sync"
 	"time"
 )
 
-const openMeteoURI = "https://api.open-meteo.com/v1/forecast?latitude=%s&longitude=%s&start_date=%s&end_date=%s&daily=temperature_2m_max&timezone=UTC"
+const openMeteoCurrentURI = "https://api.open-meteo.com/v1/forecast?latitude=%s&longitude=%s&current=temperature_2m,apparent_temperature,relative_humidity_2m,wind_speed_10m,pressure_msl,weather_code&wind_speed_unit=ms&timeformat=unixtime&timezone=%s"
 
-type OpenMeteo struct{}
+const openMeteoAirQualityURI = "https://air-quality-api.open-meteo.com/v1/air-quality?latitude=%s&longitude=%s&current=pm2_5,pm10,ozone,nitrogen_dioxide,us_aqi,european_aqi,alder_pollen,birch_pollen,grass_pollen,mugwort_pollen,olive_pollen,ragweed_pollen&timeformat=unixtime&timezone=%s"
+
+const openMeteoURI = "https://api.open-meteo.com/v1/forecast?latitude=%s&longitude=%s&start_date=%s&end_date=%s&daily=temperature_2m_max,temperature_2m_min,wind_speed_10m_max,precipitation_sum,pressure_msl_mean&wind_speed_unit=ms&timezone=%s"
+
+type OpenMeteo struct {
+	params   map[string]any
+	coverage Coverage
+	clock    Clock
+}
 
 type openMeteoResponceType struct {
 	Dates []string  `json:"daily.time"`
 	Temps []float64 `json:"daily.temperature_2m_max"`
 	Daily struct {
-		Time        []string  `json:"time"`
-		Temperature []float64 `json:"temperature_2m_max"`
+		Time           []string   `json:"time"`
+		Temperature    []float64  `json:"temperature_2m_max"`
+		TemperatureMin []*float64 `json:"temperature_2m_min"`
+		WindSpeed      []*float64 `json:"wind_speed_10m_max"`
+		Precipitation  []*float64 `json:"precipitation_sum"`
+		Pressure       []*float64 `json:"pressure_msl_mean"`
 	} `json:"daily"`
 }
 
-func NewOpenMeteo() *OpenMeteo {
-	return &OpenMeteo{}
+func NewOpenMeteo(clock Clock) *OpenMeteo {
+	return &OpenMeteo{
+		params: make(map[string]any),
+		clock:  clock,
+	}
 }
 
 func (o *OpenMeteo) Name() string {
 	return "OpenMeteo"
 }
 
-func (o *OpenMeteo) GetParams(string) any {
-	return nil
+func (o *OpenMeteo) Capabilities() Capabilities {
+	return Capabilities{
+		Variables:       []string{VariableTemperatureMax, VariableTemperatureMin, VariableWindSpeed, VariablePrecipitation, VariablePressure},
+		MaxForecastDays: 16,
+		Hourly:          true,
+		Current:         true,
+		Historical:      true,
+		AirQuality:      true,
+		Coverage:        o.coverage,
+		Attribution:     "Weather data by Open-Meteo.com",
+		License:         "CC BY 4.0",
+	}
+}
+
+func (o *OpenMeteo) GetParams(name string) any {
+	return o.params[name]
 }
 
-func (o *OpenMeteo) SetParams(string, any) {
+func (o *OpenMeteo) SetParams(name string, value any) {
+	o.params[name] = value
+	if name == "Coverage" {
+		o.coverage = coverageParam(value)
+	}
 }
 
-func (o *OpenMeteo) GetForecast(ctx context.Context, lat, lon string) (ForecastDay, error) {
-	return BuildForecastGetter(ctx, lat, lon, o, openMeteoRequest)(ctx, lat, lon)
+func (o *OpenMeteo) GetForecast(ctx context.Context, lat, lon string, loc *time.Location) (ForecastDay, error) {
+	return BuildForecastGetter(ctx, lat, lon, loc, o.clock, o, openMeteoRequest)(ctx, lat, lon)
 }
 
-func openMeteoRequest(ctx context.Context, wg *sync.WaitGroup, lat, lon string, res *sync.Map, i int, o WeatherProvider) {
+func openMeteoRequest(ctx context.Context, wg *sync.WaitGroup, lat, lon string, loc *time.Location, res *sync.Map, currentDate string, o WeatherProvider) {
 	defer wg.Done()
 	select {
 	case <-ctx.Done():
@@ -49,24 +81,176 @@ func openMeteoRequest(ctx context.Context, wg *sync.WaitGroup, lat, lon string,
 	default:
 	}
 
-	currentDate := time.Now().AddDate(0, 0, i).Format("2006-01-02")
-	url := fmt.Sprintf(openMeteoURI, lat, lon, currentDate, currentDate)
+	url := fmt.Sprintf(openMeteoURI, lat, lon, currentDate, currentDate, url.QueryEscape(loc.String()))
+
+	var data openMeteoResponceType
 
-	resp, err := http.Get(url)
+	err := fetchJSON(ctx, url, nil, &data)
 	if err != nil {
 		res.Store(currentDate, err)
 		return
 	}
-	defer resp.Body.Close()
 
-	var data openMeteoResponceType
+	if len(data.Daily.Temperature) == 0 {
+		res.Store(currentDate, fmt.Errorf("%w: no temperature for %s", ErrInvalidResponse, currentDate))
+		return
+	}
 
-	err = json.NewDecoder(resp.Body).Decode(&data)
+	res.Store(currentDate, ForecastData{
+		Temperature:    data.Daily.Temperature[0],
+		TemperatureMin: firstValue(data.Daily.TemperatureMin),
+		WindSpeed:      firstValue(data.Daily.WindSpeed),
+		Precipitation:  firstValue(data.Daily.Precipitation),
+		Pressure:       firstValue(data.Daily.Pressure),
+	})
+}
 
+// firstValue returns the first element of an optional daily series, nil when
+// the series is missing or the value is null.
+func firstValue(values []*float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+type openMeteoCurrentResponse struct {
+	Current *struct {
+		Time        int64    `json:"time"`
+		Temperature *float64 `json:"temperature_2m"`
+		FeelsLike   *float64 `json:"apparent_temperature"`
+		Humidity    *float64 `json:"relative_humidity_2m"`
+		WindSpeed   *float64 `json:"wind_speed_10m"`
+		Pressure    *float64 `json:"pressure_msl"`
+		WeatherCode *int     `json:"weather_code"`
+	} `json:"current"`
+}
+
+func (o *OpenMeteo) GetCurrent(ctx context.Context, lat, lon string, loc *time.Location) (CurrentConditions, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	var data openMeteoCurrentResponse
+	err := fetchJSON(ctx, fmt.Sprintf(openMeteoCurrentURI, lat, lon, url.QueryEscape(loc.String())), nil, &data)
 	if err != nil {
-		res.Store(currentDate, err)
-		return
+		return CurrentConditions{}, err
+	}
+	if data.Current == nil || data.Current.Temperature == nil {
+		return CurrentConditions{}, fmt.Errorf("%w: no current temperature", ErrInvalidResponse)
+	}
+
+	current := CurrentConditions{
+		ObservedAt:  time.Unix(data.Current.Time, 0).UTC(),
+		Temperature: *data.Current.Temperature,
+		FeelsLike:   data.Current.FeelsLike,
+		WindSpeed:   data.Current.WindSpeed,
+		Humidity:    data.Current.Humidity,
+		Pressure:    data.Current.Pressure,
+	}
+	if data.Current.WeatherCode != nil {
+		current.Condition = wmoConditions[*data.Current.WeatherCode]
+	}
+	return current, nil
+}
+
+// HistoricalChunkDays is a year, the archive answering long ranges at once.
+func (o *OpenMeteo) HistoricalChunkDays() int {
+	return 366
+}
+
+// GetHistorical reads the Open-Meteo archive, the one accuracy verification
+// observes with.
+func (o *OpenMeteo) GetHistorical(ctx context.Context, lat, lon string, loc *time.Location, start, end string) (ForecastDay, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return NewOpenMeteoArchive().Observations(ctx, lat, lon, loc, start, end)
+}
+
+type openMeteoAirQualityResponse struct {
+	Current *struct {
+		Time            int64    `json:"time"`
+		PM25            *float64 `json:"pm2_5"`
+		PM10            *float64 `json:"pm10"`
+		Ozone           *float64 `json:"ozone"`
+		NitrogenDioxide *float64 `json:"nitrogen_dioxide"`
+		USAQI           *float64 `json:"us_aqi"`
+		EuropeanAQI     *float64 `json:"european_aqi"`
+		Alder           *float64 `json:"alder_pollen"`
+		Birch           *float64 `json:"birch_pollen"`
+		Grass           *float64 `json:"grass_pollen"`
+		Mugwort         *float64 `json:"mugwort_pollen"`
+		Olive           *float64 `json:"olive_pollen"`
+		Ragweed         *float64 `json:"ragweed_pollen"`
+	} `json:"current"`
+}
+
+func (o *OpenMeteo) GetAirQuality(ctx context.Context, lat, lon string, loc *time.Location) (AirQuality, error) {
+	return openMeteoAirQuality(ctx, lat, lon, loc)
+}
+
+// openMeteoAirQuality reads the Open-Meteo air quality API. Pollen is only
+// forecast in Europe during the pollen season.
+func openMeteoAirQuality(ctx context.Context, lat, lon string, loc *time.Location) (AirQuality, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	var data openMeteoAirQualityResponse
+	err := fetchJSON(ctx, fmt.Sprintf(openMeteoAirQualityURI, lat, lon, url.QueryEscape(loc.String())), nil, &data)
+	if err != nil {
+		return AirQuality{}, err
+	}
+	if data.Current == nil {
+		return AirQuality{}, fmt.Errorf("%w: no current air quality", ErrInvalidResponse)
 	}
 
-	res.Store(currentDate, data.Daily.Temperature[0])
+	c := data.Current
+	air := AirQuality{
+		ObservedAt:      time.Unix(c.Time, 0).UTC(),
+		PM25:            c.PM25,
+		PM10:            c.PM10,
+		Ozone:           c.Ozone,
+		NitrogenDioxide: c.NitrogenDioxide,
+		USAQI:           c.USAQI,
+		EuropeanAQI:     c.EuropeanAQI,
+	}
+	pollen := map[string]*float64{
+		"alder": c.Alder, "birch": c.Birch, "grass": c.Grass,
+		"mugwort": c.Mugwort, "olive": c.Olive, "ragweed": c.Ragweed,
+	}
+	for plant, value := range pollen {
+		if value == nil {
+			continue
+		}
+		if air.Pollen == nil {
+			air.Pollen = make(map[string]float64)
+		}
+		air.Pollen[plant] = *value
+	}
+	air.ComputeIndexes()
+	return air, nil
+}
+
+// OpenMeteoAirQuality serves the Open-Meteo air quality API alone, for
+// deployments without the Open-Meteo forecasts.
+type OpenMeteoAirQuality struct{}
+
+func NewOpenMeteoAirQuality() *OpenMeteoAirQuality {
+	return &OpenMeteoAirQuality{}
+}
+
+func (o *OpenMeteoAirQuality) Name() string {
+	return "OpenMeteoAirQuality"
+}
+
+func (o *OpenMeteoAirQuality) Capabilities() Capabilities {
+	return Capabilities{
+		AirQuality:  true,
+		Attribution: "Air quality data by Open-Meteo.com",
+		License:     "CC BY 4.0",
+	}
+}
+
+func (o *OpenMeteoAirQuality) GetAirQuality(ctx context.Context, lat, lon string, loc *time.Location) (AirQuality, error) {
+	return openMeteoAirQuality(ctx, lat, lon, loc)
 }
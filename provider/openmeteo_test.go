@@ -2,7 +2,9 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -17,7 +19,11 @@ func TestOpenMeteoRequest_Success(t *testing.T) {
 			return mockHTTPResponse(200, `{
 				"daily": {
 					"time": ["2025-08-01"],
-					"temperature_2m_max": [27.5]
+					"temperature_2m_max": [27.5],
+					"temperature_2m_min": [15.0],
+					"wind_speed_10m_max": [4.2],
+					"precipitation_sum": [null],
+					"pressure_msl_mean": [1013.2]
 				}
 			}`), nil
 		},
@@ -28,22 +34,33 @@ func TestOpenMeteoRequest_Success(t *testing.T) {
 	res := &sync.Map{}
 	ctx := context.Background()
 
-	openMeteoRequest(ctx, wg, "52.52", "13.41", res, 0, &OpenMeteo{})
+	openMeteoRequest(ctx, wg, "52.52", "13.41", time.UTC, res, testDate, &OpenMeteo{})
 	wg.Wait()
 
-	today := time.Now().Format("2006-01-02")
-	val, ok := res.Load(today)
+	val, ok := res.Load(testDate)
 	if !ok {
-		t.Fatalf("expected result for %s not found", today)
+		t.Fatalf("expected result for %s not found", testDate)
 	}
 
-	temp, ok := val.(float64)
+	day, ok := val.(ForecastData)
 	if !ok {
-		t.Fatalf("expected float64, got %T", val)
+		t.Fatalf("expected ForecastData, got %T", val)
 	}
 
-	if temp != 27.5 {
-		t.Errorf("expected temperature 27.5, got %.2f", temp)
+	if day.Temperature != 27.5 {
+		t.Errorf("expected temperature 27.5, got %.2f", day.Temperature)
+	}
+	if day.TemperatureMin == nil || *day.TemperatureMin != 15.0 {
+		t.Errorf("expected min temperature 15.0, got %v", day.TemperatureMin)
+	}
+	if day.WindSpeed == nil || *day.WindSpeed != 4.2 {
+		t.Errorf("expected wind speed 4.2, got %v", day.WindSpeed)
+	}
+	if day.Precipitation != nil {
+		t.Errorf("expected null precipitation to be omitted, got %v", *day.Precipitation)
+	}
+	if day.Pressure == nil || *day.Pressure != 1013.2 {
+		t.Errorf("expected pressure 1013.2, got %v", day.Pressure)
 	}
 }
 
@@ -62,13 +79,12 @@ func TestOpenMeteoRequest_InvalidJSON(t *testing.T) {
 	res := &sync.Map{}
 	ctx := context.Background()
 
-	openMeteoRequest(ctx, wg, "52.52", "13.41", res, 0, &OpenMeteo{})
+	openMeteoRequest(ctx, wg, "52.52", "13.41", time.UTC, res, testDate, &OpenMeteo{})
 	wg.Wait()
 
-	today := time.Now().Format("2006-01-02")
-	val, ok := res.Load(today)
+	val, ok := res.Load(testDate)
 	if !ok {
-		t.Fatalf("expected error result for %s not found", today)
+		t.Fatalf("expected error result for %s not found", testDate)
 	}
 
 	if _, ok := val.(error); !ok {
@@ -83,12 +99,195 @@ func TestOpenMeteoRequest_ContextCancelled(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // cancel before call
 
-	openMeteoRequest(ctx, wg, "52.52", "13.41", res, 0, &OpenMeteo{})
+	openMeteoRequest(ctx, wg, "52.52", "13.41", time.UTC, res, testDate, &OpenMeteo{})
 	wg.Wait()
 
-	today := time.Now().Format("2006-01-02")
-	_, ok := res.Load(today)
+	_, ok := res.Load(testDate)
 	if ok {
 		t.Errorf("expected no result due to cancelled context, but got value")
 	}
 }
+
+func TestOpenMeteoRequest_EmptyResponse(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return mockHTTPResponse(200, `{"daily": {"time": [], "temperature_2m_max": []}}`), nil
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	res := &sync.Map{}
+
+	openMeteoRequest(context.Background(), wg, "52.52", "13.41", time.UTC, res, testDate, &OpenMeteo{})
+	wg.Wait()
+
+	val, _ := res.Load(testDate)
+	if err, ok := val.(error); !ok || !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse, got %v", val)
+	}
+}
+
+func TestOpenMeteoRequest_Timezone(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	loc, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	today := ForecastDates(testClock, loc)[0]
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if !strings.Contains(req.URL.RawQuery, "timezone=Pacific%2FKiritimati") {
+				t.Errorf("expected timezone in query, got %s", req.URL.RawQuery)
+			}
+			if !strings.Contains(req.URL.RawQuery, "start_date="+today) {
+				t.Errorf("expected start date %s in query, got %s", today, req.URL.RawQuery)
+			}
+			return mockHTTPResponse(200, `{"daily": {"time": ["`+today+`"], "temperature_2m_max": [30.5]}}`), nil
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	res := &sync.Map{}
+
+	openMeteoRequest(context.Background(), wg, "1.87", "-157.4", loc, res, today, &OpenMeteo{})
+	wg.Wait()
+
+	if _, ok := res.Load(today); !ok {
+		t.Errorf("expected result keyed by local date %s", today)
+	}
+}
+
+func TestOpenMeteoGetCurrent(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	var requested string
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			requested = req.URL.String()
+			return mockHTTPResponse(200, `{
+				"current": {
+					"time": 1722510000,
+					"temperature_2m": 24.3,
+					"apparent_temperature": 25.1,
+					"relative_humidity_2m": 61,
+					"wind_speed_10m": 3.4,
+					"pressure_msl": null,
+					"weather_code": 63
+				}
+			}`), nil
+		},
+	}
+
+	current, err := NewOpenMeteo(nil).GetCurrent(context.Background(), "52.52", "13.41", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(requested, "current=temperature_2m") || !strings.Contains(requested, "timezone=UTC") {
+		t.Errorf("unexpected request %s", requested)
+	}
+	if !current.ObservedAt.Equal(time.Unix(1722510000, 0)) || current.Temperature != 24.3 {
+		t.Errorf("unexpected conditions: %+v", current)
+	}
+	if current.FeelsLike == nil || *current.FeelsLike != 25.1 || current.Humidity == nil || *current.Humidity != 61 {
+		t.Errorf("unexpected feels-like or humidity: %+v", current)
+	}
+	if current.Pressure != nil {
+		t.Errorf("expected no pressure, got %v", *current.Pressure)
+	}
+	if current.Condition != ConditionRain {
+		t.Errorf("expected %s, got %q", ConditionRain, current.Condition)
+	}
+}
+
+func TestOpenMeteoGetCurrent_MissingTemperature(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return mockHTTPResponse(200, `{"current": {"time": 1722510000}}`), nil
+		},
+	}
+
+	_, err := NewOpenMeteo(nil).GetCurrent(context.Background(), "52.52", "13.41", time.UTC)
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse, got %v", err)
+	}
+}
+
+func TestOpenMeteoGetHistorical(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	var requested string
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			requested = req.URL.String()
+			return mockHTTPResponse(200, `{"daily": {"time": ["2024-07-01"], "temperature_2m_max": [21.0]}}`), nil
+		},
+	}
+
+	days, err := NewOpenMeteo(nil).GetHistorical(context.Background(), "52.52", "13.41", nil, "2024-07-01", "2024-07-01")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(requested, "https://archive-api.open-meteo.com/") || !strings.Contains(requested, "timezone=UTC") {
+		t.Errorf("expected the archive in UTC, got %s", requested)
+	}
+	if days["2024-07-01"].Temperature != 21 {
+		t.Errorf("unexpected days: %v", days)
+	}
+}
+
+func TestOpenMeteoGetAirQuality(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host != "air-quality-api.open-meteo.com" {
+				t.Errorf("unexpected request %s", req.URL)
+			}
+			return mockHTTPResponse(200, `{
+				"current": {
+					"time": 1722510000,
+					"pm2_5": 8.2,
+					"pm10": 14.0,
+					"ozone": 96.0,
+					"nitrogen_dioxide": 12.5,
+					"us_aqi": 47,
+					"european_aqi": 38,
+					"alder_pollen": null,
+					"birch_pollen": 0.0,
+					"grass_pollen": 12.4,
+					"mugwort_pollen": null,
+					"olive_pollen": null,
+					"ragweed_pollen": null
+				}
+			}`), nil
+		},
+	}
+
+	air, err := NewOpenMeteo(nil).GetAirQuality(context.Background(), "52.52", "13.41", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if air.USAQI == nil || *air.USAQI != 47 || air.USCategory != USCategoryGood {
+		t.Errorf("expected the reported US AQI, got %v %s", air.USAQI, air.USCategory)
+	}
+	if air.EuropeanAQI == nil || *air.EuropeanAQI != 38 || air.EuropeanCategory != EuropeanCategoryFair {
+		t.Errorf("expected the reported European AQI, got %v %s", air.EuropeanAQI, air.EuropeanCategory)
+	}
+	if len(air.Pollen) != 2 || air.Pollen["grass"] != 12.4 {
+		t.Errorf("expected the reported pollen only, got %v", air.Pollen)
+	}
+}
@@ -0,0 +1,152 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const openWeatherMapURI = "https://api.openweathermap.org/data/2.5/forecast?lat=%s&lon=%s&appid=%s&units=metric"
+
+type OpenWeatherMap struct {
+	params   map[string]any
+	coverage Coverage
+	clock    Clock
+}
+
+type openWeatherMapResponceType struct {
+	List []struct {
+		Dt   int64 `json:"dt"`
+		Main struct {
+			TempMin  float64 `json:"temp_min"`
+			TempMax  float64 `json:"temp_max"`
+			Pressure float64 `json:"pressure"`
+		} `json:"main"`
+		Wind struct {
+			Speed float64 `json:"speed"`
+		} `json:"wind"`
+		Rain struct {
+			ThreeHours float64 `json:"3h"`
+		} `json:"rain"`
+	} `json:"list"`
+}
+
+func NewOpenWeatherMap(clock Clock) *OpenWeatherMap {
+	return &OpenWeatherMap{
+		params: make(map[string]any),
+		clock:  clock,
+	}
+}
+
+func (o *OpenWeatherMap) Name() string {
+	return "OpenWeatherMap"
+}
+
+func (o *OpenWeatherMap) Capabilities() Capabilities {
+	return Capabilities{
+		Variables:       []string{VariableTemperatureMax, VariableTemperatureMin, VariableWindSpeed, VariablePrecipitation, VariablePressure},
+		MaxForecastDays: 5,
+		Hourly:          false,
+		Coverage:        o.coverage,
+		RequiresAPIKey:  true,
+		Attribution:     "Weather data provided by OpenWeather",
+		License:         "CC BY-SA 4.0",
+	}
+}
+
+func (o *OpenWeatherMap) GetParams(name string) any {
+	return o.params[name]
+}
+
+func (o *OpenWeatherMap) SetParams(name string, value any) {
+	o.params[name] = value
+	if name == "Coverage" {
+		o.coverage = coverageParam(value)
+	}
+}
+
+// location returns the timezone used to split the 3-hour steps into days:
+// the requested one, else the Timezone parameter, else UTC.
+func (o *OpenWeatherMap) location(loc *time.Location) (*time.Location, error) {
+	if loc != nil {
+		return loc, nil
+	}
+	name, _ := o.GetParams("Timezone").(string)
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+func (o *OpenWeatherMap) GetForecast(ctx context.Context, lat, lon string, requestLoc *time.Location) (ForecastDay, error) {
+	apiKey, ok := o.GetParams("APIKey").(string)
+	if !ok || apiKey == "" {
+		return nil, fmt.Errorf("%w: openweathermap APIKey", ErrMissingParam)
+	}
+
+	loc, err := o.location(requestLoc)
+	if err != nil {
+		return nil, fmt.Errorf("openweathermap: %w", err)
+	}
+
+	url := fmt.Sprintf(openWeatherMapURI, lat, lon, apiKey)
+
+	var data openWeatherMapResponceType
+
+	err = fetchJSON(ctx, url, nil, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data.List) == 0 {
+		return nil, fmt.Errorf("%w: no forecast steps", ErrInvalidResponse)
+	}
+
+	forecast := groupOpenWeatherMapSteps(data, loc)
+	trimToWindow(forecast, o.clock, loc)
+	return forecast, nil
+}
+
+// groupOpenWeatherMapSteps folds the 3-hour steps into calendar days of loc,
+// keeping the daily max and min temperature, the max wind speed, the summed
+// rain and the mean pressure. The first and last days are usually partial;
+// GetForecast keeps today's and drops the days beyond FetchDaysCount.
+func groupOpenWeatherMapSteps(data openWeatherMapResponceType, loc *time.Location) ForecastDay {
+	forecast := make(ForecastDay)
+	steps := make(map[string]int)
+	for _, step := range data.List {
+		date := time.Unix(step.Dt, 0).In(loc).Format("2006-01-02")
+		steps[date]++
+
+		day, ok := forecast[date]
+		if !ok {
+			tmin, wind, rain, pressure := step.Main.TempMin, step.Wind.Speed, step.Rain.ThreeHours, step.Main.Pressure
+			forecast[date] = ForecastData{
+				Temperature:    step.Main.TempMax,
+				TemperatureMin: &tmin,
+				WindSpeed:      &wind,
+				Precipitation:  &rain,
+				Pressure:       &pressure,
+			}
+			continue
+		}
+		if step.Main.TempMax > day.Temperature {
+			day.Temperature = step.Main.TempMax
+		}
+		if step.Main.TempMin < *day.TemperatureMin {
+			*day.TemperatureMin = step.Main.TempMin
+		}
+		if step.Wind.Speed > *day.WindSpeed {
+			*day.WindSpeed = step.Wind.Speed
+		}
+		*day.Precipitation += step.Rain.ThreeHours
+		*day.Pressure += step.Main.Pressure
+		forecast[date] = day
+	}
+
+	for date, day := range forecast {
+		*day.Pressure /= float64(steps[date])
+	}
+
+	return forecast
+}
@@ -0,0 +1,187 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadOpenWeatherMapFixture(t *testing.T) string {
+	t.Helper()
+	body, err := os.ReadFile("testdata/openweathermap_forecast.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return string(body)
+}
+
+func TestGroupOpenWeatherMapSteps_UTC(t *testing.T) {
+	var data openWeatherMapResponceType
+	if err := json.Unmarshal([]byte(loadOpenWeatherMapFixture(t)), &data); err != nil {
+		t.Fatalf("invalid fixture: %v", err)
+	}
+
+	forecast := groupOpenWeatherMapSteps(data, time.UTC)
+
+	if len(forecast) != 6 {
+		t.Fatalf("expected 6 calendar days, got %d", len(forecast))
+	}
+
+	// the fixture starts at 18:00 UTC, so the first day only has two steps
+	first, ok := forecast["2025-08-01"]
+	if !ok {
+		t.Fatal("expected partial first day 2025-08-01")
+	}
+	if first.Temperature != 10.5 || *first.TemperatureMin != 8.0 {
+		t.Errorf("unexpected first day: max %.1f, min %.1f", first.Temperature, *first.TemperatureMin)
+	}
+
+	full := forecast["2025-08-02"]
+	if full.Temperature != 14.5 || *full.TemperatureMin != 9.0 {
+		t.Errorf("unexpected full day: max %.1f, min %.1f", full.Temperature, *full.TemperatureMin)
+	}
+	// steps 2 to 9: wind is the max, rain the sum and pressure the mean
+	if *full.WindSpeed != 8 || *full.Precipitation != 1.0 || *full.Pressure != 1005.5 {
+		t.Errorf("unexpected full day: wind %.1f, rain %.1f, pressure %.1f", *full.WindSpeed, *full.Precipitation, *full.Pressure)
+	}
+
+	// the fixture ends at 15:00 UTC, so the last day only has six steps
+	last := forecast["2025-08-06"]
+	if last.Temperature != 29.5 || *last.TemperatureMin != 25.0 {
+		t.Errorf("unexpected last day: max %.1f, min %.1f", last.Temperature, *last.TemperatureMin)
+	}
+}
+
+func TestGroupOpenWeatherMapSteps_Timezone(t *testing.T) {
+	var data openWeatherMapResponceType
+	if err := json.Unmarshal([]byte(loadOpenWeatherMapFixture(t)), &data); err != nil {
+		t.Fatalf("invalid fixture: %v", err)
+	}
+
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	forecast := groupOpenWeatherMapSteps(data, loc)
+
+	// 00:00 and 03:00 UTC are still the previous evening in New York
+	first := forecast["2025-08-01"]
+	if first.Temperature != 11.5 || *first.TemperatureMin != 8.0 {
+		t.Errorf("unexpected first day: max %.1f, min %.1f", first.Temperature, *first.TemperatureMin)
+	}
+
+	second := forecast["2025-08-02"]
+	if second.Temperature != 15.5 || *second.TemperatureMin != 10.0 {
+		t.Errorf("unexpected second day: max %.1f, min %.1f", second.Temperature, *second.TemperatureMin)
+	}
+}
+
+func TestOpenWeatherMapGetForecast_Success(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	fixture := loadOpenWeatherMapFixture(t)
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if !strings.Contains(req.URL.RawQuery, "appid=testkey") {
+				t.Errorf("expected API key in query, got %s", req.URL.RawQuery)
+			}
+			return mockHTTPResponse(200, fixture), nil
+		},
+	}
+
+	owm := NewOpenWeatherMap(NewFakeClock(time.Date(2025, 8, 1, 16, 0, 0, 0, time.UTC)))
+	owm.SetParams("APIKey", "testkey")
+	owm.SetParams("Timezone", "UTC")
+
+	forecast, err := owm.GetForecast(context.Background(), "52.52", "13.41", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(forecast) != FetchDaysCount {
+		t.Errorf("expected %d days, got %d", FetchDaysCount, len(forecast))
+	}
+	if _, ok := forecast["2025-08-01"]; !ok {
+		t.Error("expected partial first day 2025-08-01 to be kept")
+	}
+	if _, ok := forecast["2025-08-06"]; ok {
+		t.Error("expected trailing partial day 2025-08-06 to be dropped")
+	}
+}
+
+func TestOpenWeatherMapGetForecast_AfterLocalMidnight(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	fixture := loadOpenWeatherMapFixture(t)
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return mockHTTPResponse(200, fixture), nil
+		},
+	}
+
+	loc, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	// 00:30 on 2025-08-02 in Oslo, still 2025-08-01 in UTC
+	owm := NewOpenWeatherMap(NewFakeClock(time.Date(2025, 8, 1, 22, 30, 0, 0, time.UTC)))
+	owm.SetParams("APIKey", "testkey")
+
+	forecast, err := owm.GetForecast(context.Background(), "59.91", "10.75", loc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, date := range []string{"2025-08-02", "2025-08-03", "2025-08-04", "2025-08-05", "2025-08-06"} {
+		if _, ok := forecast[date]; !ok {
+			t.Errorf("expected %s in forecast", date)
+		}
+	}
+	if _, ok := forecast["2025-08-01"]; ok {
+		t.Error("expected yesterday in Oslo to be dropped")
+	}
+}
+
+func TestOpenWeatherMapGetForecast_BadStatus(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			return mockHTTPResponse(401, `{"cod": 401, "message": "Invalid API key"}`), nil
+		},
+	}
+
+	owm := NewOpenWeatherMap(testClock)
+	owm.SetParams("APIKey", "badkey")
+
+	if _, err := owm.GetForecast(context.Background(), "52.52", "13.41", nil); !errors.Is(err, ErrUpstreamStatus) {
+		t.Fatalf("expected ErrUpstreamStatus, got %v", err)
+	}
+}
+
+func TestOpenWeatherMapGetForecast_MissingAPIKey(t *testing.T) {
+	owm := NewOpenWeatherMap(testClock)
+
+	if _, err := owm.GetForecast(context.Background(), "52.52", "13.41", nil); !errors.Is(err, ErrMissingParam) {
+		t.Fatalf("expected ErrMissingParam, got %v", err)
+	}
+}
+
+func TestOpenWeatherMapGetForecast_InvalidTimezone(t *testing.T) {
+	owm := NewOpenWeatherMap(testClock)
+	owm.SetParams("APIKey", "testkey")
+	owm.SetParams("Timezone", "Not/AZone")
+
+	if _, err := owm.GetForecast(context.Background(), "52.52", "13.41", nil); err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+}
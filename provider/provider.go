@@ -4,10 +4,18 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 )
 
+// ForecastData holds one day: max and min temperature, max wind speed,
+// precipitation sum and mean sea level pressure. Variables a provider does
+// not report are nil.
 type ForecastData struct {
-	Temperature float64 `json:"temperature"`
+	Temperature    float64  `json:"temperature"`
+	TemperatureMin *float64 `json:"temperature_min,omitempty"`
+	WindSpeed      *float64 `json:"wind_speed,omitempty"`
+	Precipitation  *float64 `json:"precipitation,omitempty"`
+	Pressure       *float64 `json:"pressure,omitempty"`
 }
 
 type ForecastDay map[string]ForecastData
@@ -16,23 +24,57 @@ type ProviderForecast map[string]ForecastDay
 
 const FetchDaysCount = 5
 
+// ForecastDates returns the FetchDaysCount dates starting today in loc,
+// reading the clock once so they all start from the same day.
+func ForecastDates(clock Clock, loc *time.Location) []string {
+	today := clockOrSystem(clock).Now().In(loc)
+	dates := make([]string, FetchDaysCount)
+	for i := range dates {
+		dates[i] = today.AddDate(0, 0, i).Format("2006-01-02")
+	}
+	return dates
+}
+
+// trimToWindow drops the days outside the FetchDaysCount days starting today
+// in loc, so providers returning whole ranges share the keys of the others.
+func trimToWindow(forecast ForecastDay, clock Clock, loc *time.Location) {
+	dates := ForecastDates(clock, loc)
+	first, last := dates[0], dates[len(dates)-1]
+	for date := range forecast {
+		if date < first || date > last {
+			delete(forecast, date)
+		}
+	}
+}
+
 type WeatherProvider interface {
 	GetParams(string) any
 	SetParams(string, any)
 	Name() string
-	GetForecast(ctx context.Context, lat, lon string) (ForecastDay, error)
+	Capabilities() Capabilities
+	// GetForecast returns the forecast keyed by dates of the calendar days in loc.
+	GetForecast(ctx context.Context, lat, lon string, loc *time.Location) (ForecastDay, error)
 }
 
-type RequestFunc func(context.Context, *sync.WaitGroup, string, string, *sync.Map, int, WeatherProvider)
+// RequestFunc fetches a single day, given as a date in the given location.
+type RequestFunc func(context.Context, *sync.WaitGroup, string, string, *time.Location, *sync.Map, string, WeatherProvider)
 
-func BuildForecastGetter(ctx context.Context, lat, lon string, wp WeatherProvider, requestFunc RequestFunc) func(ctx context.Context, lat, lon string) (ForecastDay, error) {
+// BuildForecastGetter fetches the FetchDaysCount days starting today according
+// to clock in loc, one requestFunc call per day. The dates are computed once so
+// every day of a forecast refers to the same start even across midnight. A
+// forecast missing days because ctx ended fails with the error of ctx.
+func BuildForecastGetter(ctx context.Context, lat, lon string, loc *time.Location, clock Clock, wp WeatherProvider, requestFunc RequestFunc) func(ctx context.Context, lat, lon string) (ForecastDay, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
 	return func(ctx context.Context, lat, lon string) (ForecastDay, error) {
 		res := sync.Map{}
 
 		wg := sync.WaitGroup{}
-		wg.Add(FetchDaysCount)
-		for i := range FetchDaysCount {
-			go requestFunc(ctx, &wg, lat, lon, &res, i, wp)
+		dates := ForecastDates(clock, loc)
+		wg.Add(len(dates))
+		for _, date := range dates {
+			go requestFunc(ctx, &wg, lat, lon, loc, &res, date, wp)
 		}
 		wg.Wait()
 
@@ -52,6 +94,8 @@ func BuildForecastGetter(ctx context.Context, lat, lon string, wp WeatherProvide
 				forecast[k] = ForecastData{
 					Temperature: v,
 				}
+			case ForecastData:
+				forecast[k] = v
 			case error:
 				resErr = v
 				return false
@@ -64,6 +108,14 @@ func BuildForecastGetter(ctx context.Context, lat, lon string, wp WeatherProvide
 		if resErr != nil {
 			return nil, resErr
 		}
+		for _, date := range dates {
+			if _, ok := forecast[date]; !ok {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				return nil, fmt.Errorf("%w: no forecast for %s", ErrInvalidResponse, date)
+			}
+		}
 		return forecast, nil
 	}
 }
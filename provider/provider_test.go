@@ -4,29 +4,38 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 )
 
+const testDate = "2025-08-01"
+
+var testClock = NewFakeClock(time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC))
+
 type mockProvider struct{}
 
 func (m *mockProvider) GetParams(key string) any        { return nil }
 func (m *mockProvider) SetParams(key string, value any) {}
 func (m *mockProvider) Name() string                    { return "mock" }
-func (m *mockProvider) GetForecast(ctx context.Context, lat, lon string) (ForecastDay, error) {
+func (m *mockProvider) Capabilities() Capabilities      { return Capabilities{} }
+func (m *mockProvider) GetForecast(ctx context.Context, lat, lon string, loc *time.Location) (ForecastDay, error) {
 	return nil, nil
 }
 
 func TestBuildGetter_Success(t *testing.T) {
-	mockReqFunc := func(ctx context.Context, wg *sync.WaitGroup, lat, lon string, res *sync.Map, i int, wp WeatherProvider) {
+	mockReqFunc := func(ctx context.Context, wg *sync.WaitGroup, lat, lon string, loc *time.Location, res *sync.Map, date string, wp WeatherProvider) {
 		defer wg.Done()
 		// simulate delay
 		time.Sleep(10 * time.Millisecond)
-		res.Store(fmt.Sprintf("day%d", i), float64(i+10)) // predictable data
+		var day int
+		fmt.Sscanf(date, "2025-08-%d", &day)
+		res.Store(date, float64(day+10)) // predictable data
 	}
 
-	getter := BuildForecastGetter(context.Background(), "52.52", "13.41", &mockProvider{}, mockReqFunc)
+	getter := BuildForecastGetter(context.Background(), "52.52", "13.41", time.UTC, testClock, &mockProvider{}, mockReqFunc)
 
 	result, err := getter(context.Background(), "52.52", "13.41")
 	if err != nil {
@@ -37,8 +46,8 @@ func TestBuildGetter_Success(t *testing.T) {
 		t.Fatalf("expected %d days, got %d", FetchDaysCount, len(result))
 	}
 
-	for i := 0; i < FetchDaysCount; i++ {
-		day := fmt.Sprintf("day%d", i)
+	for i := 1; i <= FetchDaysCount; i++ {
+		day := fmt.Sprintf("2025-08-%02d", i)
 		data, ok := result[day]
 		if !ok {
 			t.Errorf("missing day: %s", day)
@@ -53,16 +62,16 @@ func TestBuildGetter_Success(t *testing.T) {
 
 func TestBuildGetter_ErrorFromRequest(t *testing.T) {
 	mockErr := errors.New("mock error")
-	mockReqFunc := func(ctx context.Context, wg *sync.WaitGroup, lat, lon string, res *sync.Map, i int, wp WeatherProvider) {
+	mockReqFunc := func(ctx context.Context, wg *sync.WaitGroup, lat, lon string, loc *time.Location, res *sync.Map, date string, wp WeatherProvider) {
 		defer wg.Done()
-		if i == 2 {
-			res.Store("day2", mockErr)
+		if date == "2025-08-03" {
+			res.Store(date, mockErr)
 		} else {
-			res.Store(fmt.Sprintf("day%d", i), float64(i))
+			res.Store(date, float64(20))
 		}
 	}
 
-	getter := BuildForecastGetter(context.Background(), "44.0", "10.0", &mockProvider{}, mockReqFunc)
+	getter := BuildForecastGetter(context.Background(), "44.0", "10.0", time.UTC, testClock, &mockProvider{}, mockReqFunc)
 
 	_, err := getter(context.Background(), "44.0", "10.0")
 	if err == nil {
@@ -75,12 +84,12 @@ func TestBuildGetter_ErrorFromRequest(t *testing.T) {
 }
 
 func TestBuildGetter_InvalidResultType(t *testing.T) {
-	mockReqFunc := func(ctx context.Context, wg *sync.WaitGroup, lat, lon string, res *sync.Map, i int, wp WeatherProvider) {
+	mockReqFunc := func(ctx context.Context, wg *sync.WaitGroup, lat, lon string, loc *time.Location, res *sync.Map, date string, wp WeatherProvider) {
 		defer wg.Done()
-		res.Store("day0", struct{}{}) // invalid type
+		res.Store(date, struct{}{}) // invalid type
 	}
 
-	getter := BuildForecastGetter(context.Background(), "44.0", "10.0", &mockProvider{}, mockReqFunc)
+	getter := BuildForecastGetter(context.Background(), "44.0", "10.0", time.UTC, testClock, &mockProvider{}, mockReqFunc)
 
 	_, err := getter(context.Background(), "44.0", "10.0")
 	if err == nil {
@@ -91,3 +100,142 @@ func TestBuildGetter_InvalidResultType(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+func TestBuildGetter_CanceledPartway(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := ForecastDates(testClock, time.UTC)[0]
+	mockReqFunc := func(ctx context.Context, wg *sync.WaitGroup, lat, lon string, loc *time.Location, res *sync.Map, date string, wp WeatherProvider) {
+		defer wg.Done()
+		if date == first {
+			res.Store(date, float64(20))
+			cancel()
+			return
+		}
+		<-ctx.Done()
+	}
+
+	getter := BuildForecastGetter(ctx, "44.0", "10.0", time.UTC, testClock, &mockProvider{}, mockReqFunc)
+
+	result, err := getter(ctx, "44.0", "10.0")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v with %v", err, result)
+	}
+}
+
+func TestForecastDate_LocalMidnight(t *testing.T) {
+	clock := NewFakeClock(time.Date(2025, 8, 1, 22, 30, 0, 0, time.UTC))
+
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	if got := ForecastDates(clock, time.UTC)[0]; got != "2025-08-01" {
+		t.Errorf("expected 2025-08-01 in UTC, got %s", got)
+	}
+	if got := ForecastDates(clock, oslo)[0]; got != "2025-08-02" {
+		t.Errorf("expected 2025-08-02 in Oslo, got %s", got)
+	}
+	if got := ForecastDates(clock, newYork)[FetchDaysCount-1]; got != "2025-08-05" {
+		t.Errorf("expected 2025-08-05 as last day in New York, got %s", got)
+	}
+}
+
+func TestBuildGetter_SameDaysAcrossProviders(t *testing.T) {
+	clock := NewFakeClock(time.Date(2025, 8, 1, 22, 30, 0, 0, time.UTC))
+
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host == "api.open-meteo.com" {
+				return mockHTTPResponse(200, `{"daily": {"time": ["x"], "temperature_2m_max": [20]}}`), nil
+			}
+			return mockHTTPResponse(200, `{"forecast": {"forecastday": [{"day": {"maxtemp_c": 21}}]}}`), nil
+		},
+	}
+
+	weatherAPI := NewWeatherAPI(clock)
+	weatherAPI.SetParams("APIKey", "testkey")
+
+	for _, wp := range []WeatherProvider{NewOpenMeteo(clock), weatherAPI} {
+		forecast, err := wp.GetForecast(context.Background(), "59.91", "10.75", oslo)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", wp.Name(), err)
+		}
+		for i, date := range []string{"2025-08-02", "2025-08-03", "2025-08-04", "2025-08-05", "2025-08-06"} {
+			if _, ok := forecast[date]; !ok {
+				t.Errorf("%s: expected day %d to be %s, got %v", wp.Name(), i, date, forecast)
+			}
+		}
+	}
+}
+
+func TestBuildGetter_MidnightRollover(t *testing.T) {
+	clock := NewFakeClock(time.Date(2025, 8, 1, 23, 59, 59, 0, time.UTC))
+
+	var mu sync.Mutex
+	var dates []string
+	mockReqFunc := func(ctx context.Context, wg *sync.WaitGroup, lat, lon string, loc *time.Location, res *sync.Map, date string, wp WeatherProvider) {
+		defer wg.Done()
+		mu.Lock()
+		dates = append(dates, date)
+		mu.Unlock()
+		res.Store(date, float64(20))
+	}
+
+	getter := BuildForecastGetter(context.Background(), "44.0", "10.0", time.UTC, clock, &mockProvider{}, mockReqFunc)
+
+	before, err := getter(context.Background(), "44.0", "10.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := before["2025-08-01"]; !ok {
+		t.Errorf("expected 2025-08-01 before midnight, got %v", before)
+	}
+
+	clock.Advance(2 * time.Second)
+
+	after, err := getter(context.Background(), "44.0", "10.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := after["2025-08-01"]; ok {
+		t.Errorf("expected 2025-08-01 to roll over after midnight, got %v", after)
+	}
+	if _, ok := after["2025-08-06"]; !ok {
+		t.Errorf("expected 2025-08-06 after midnight, got %v", after)
+	}
+	if len(dates) != 2*FetchDaysCount {
+		t.Errorf("expected %d requests, got %d", 2*FetchDaysCount, len(dates))
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	dates, err := DateRange("2024-02-28", "2024-03-01")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(dates, ","); got != "2024-02-28,2024-02-29,2024-03-01" {
+		t.Errorf("unexpected dates %s", got)
+	}
+
+	if dates, _ := DateRange("2024-03-02", "2024-03-01"); len(dates) != 0 {
+		t.Errorf("expected no dates, got %v", dates)
+	}
+	if _, err := DateRange("2024-03-01", "March 2"); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+}
@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"fmt"
+)
+
+// Units selects the unit system of a response. Providers always return the
+// canonical units: °C, m/s, mm and hPa.
+type Units string
+
+const (
+	UnitsMetric   Units = "metric"
+	UnitsImperial Units = "imperial"
+	UnitsSI       Units = "si"
+)
+
+// UnitLabels names the unit of every variable in a response.
+type UnitLabels struct {
+	Temperature   string `json:"temperature"`
+	WindSpeed     string `json:"wind_speed"`
+	Precipitation string `json:"precipitation"`
+	Pressure      string `json:"pressure"`
+}
+
+// ParseUnits reads the units query parameter, metric by default.
+func ParseUnits(value string) (Units, error) {
+	switch Units(value) {
+	case "":
+		return UnitsMetric, nil
+	case UnitsMetric, UnitsImperial, UnitsSI:
+		return Units(value), nil
+	}
+	return "", fmt.Errorf("unknown units %q", value)
+}
+
+func (u Units) Labels() UnitLabels {
+	switch u {
+	case UnitsImperial:
+		return UnitLabels{Temperature: "°F", WindSpeed: "mph", Precipitation: "in", Pressure: "inHg"}
+	case UnitsSI:
+		return UnitLabels{Temperature: "K", WindSpeed: "m/s", Precipitation: "mm", Pressure: "Pa"}
+	default:
+		return UnitLabels{Temperature: "°C", WindSpeed: "km/h", Precipitation: "mm", Pressure: "hPa"}
+	}
+}
+
+func (u Units) temperature(celsius float64) float64 {
+	switch u {
+	case UnitsImperial:
+		return celsius*9/5 + 32
+	case UnitsSI:
+		return celsius + 273.15
+	}
+	return celsius
+}
+
+func (u Units) windSpeed(ms float64) float64 {
+	switch u {
+	case UnitsImperial:
+		return ms / metersPerSecondPerMph
+	case UnitsSI:
+		return ms
+	}
+	return ms * 3.6
+}
+
+func (u Units) precipitation(mm float64) float64 {
+	if u == UnitsImperial {
+		return mm / millimetersPerInch
+	}
+	return mm
+}
+
+func (u Units) pressure(hpa float64) float64 {
+	switch u {
+	case UnitsImperial:
+		return hpa / hectopascalsPerInHg
+	case UnitsSI:
+		return hpa * 100
+	}
+	return hpa
+}
+
+func convertOptional(value *float64, convert func(float64) float64) *float64 {
+	if value == nil {
+		return nil
+	}
+	converted := convert(*value)
+	return &converted
+}
+
+// Convert returns a copy of the forecast in the units u.
+func (u Units) Convert(forecast ProviderForecast) ProviderForecast {
+	result := make(ProviderForecast, len(forecast))
+	for name, days := range forecast {
+		result[name] = u.ConvertDays(days)
+	}
+	return result
+}
+
+// ConvertDays returns a copy of the days in the units u.
+func (u Units) ConvertDays(days ForecastDay) ForecastDay {
+	converted := make(ForecastDay, len(days))
+	for date, day := range days {
+		converted[date] = ForecastData{
+			Temperature:    u.temperature(day.Temperature),
+			TemperatureMin: convertOptional(day.TemperatureMin, u.temperature),
+			WindSpeed:      convertOptional(day.WindSpeed, u.windSpeed),
+			Precipitation:  convertOptional(day.Precipitation, u.precipitation),
+			Pressure:       convertOptional(day.Pressure, u.pressure),
+		}
+	}
+	return converted
+}
+
+// ConvertCurrent returns a copy of the current conditions in the units u.
+func (u Units) ConvertCurrent(current CurrentConditions) CurrentConditions {
+	current.Temperature = u.temperature(current.Temperature)
+	current.FeelsLike = convertOptional(current.FeelsLike, u.temperature)
+	current.WindSpeed = convertOptional(current.WindSpeed, u.windSpeed)
+	current.Pressure = convertOptional(current.Pressure, u.pressure)
+	return current
+}
+
+const (
+	metersPerSecondPerMph  = 0.44704
+	metersPerSecondPerKnot = 1852.0 / 3600
+	millimetersPerInch     = 25.4
+	hectopascalsPerInHg    = 33.8638866667
+)
+
+// nativeUnits normalize values in the units a Generic provider declares into
+// the canonical ones, keyed by unit parameter and unit name. An unset
+// parameter means the canonical unit.
+var nativeUnits = map[string]map[string]func(float64) float64{
+	"TemperatureUnit": {
+		"celsius":    func(v float64) float64 { return v },
+		"fahrenheit": func(v float64) float64 { return (v - 32) * 5 / 9 },
+		"kelvin":     func(v float64) float64 { return v - 273.15 },
+	},
+	"WindSpeedUnit": {
+		"ms":  func(v float64) float64 { return v },
+		"kmh": kmhToMs,
+		"mph": func(v float64) float64 { return v * metersPerSecondPerMph },
+		"kn":  func(v float64) float64 { return v * metersPerSecondPerKnot },
+	},
+	"PrecipitationUnit": {
+		"mm":   func(v float64) float64 { return v },
+		"inch": func(v float64) float64 { return v * millimetersPerInch },
+	},
+	"PressureUnit": {
+		"hpa":  func(v float64) float64 { return v },
+		"pa":   func(v float64) float64 { return v / 100 },
+		"inhg": func(v float64) float64 { return v * hectopascalsPerInHg },
+	},
+}
+
+func kmhToMs(kmh float64) float64 {
+	return kmh / 3.6
+}
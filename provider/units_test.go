@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseUnits(t *testing.T) {
+	if units, err := ParseUnits(""); err != nil || units != UnitsMetric {
+		t.Errorf("expected metric by default, got %q, %v", units, err)
+	}
+	if units, err := ParseUnits("imperial"); err != nil || units != UnitsImperial {
+		t.Errorf("expected imperial, got %q, %v", units, err)
+	}
+	if _, err := ParseUnits("kelvin"); err == nil {
+		t.Error("expected an error for unknown units")
+	}
+}
+
+func TestUnitsConvert(t *testing.T) {
+	tmin, wind, rain, pressure := 10.0, 10.0, 25.4, 1013.25
+	forecast := ProviderForecast{
+		"mock": ForecastDay{
+			testDate: {Temperature: 20, TemperatureMin: &tmin, WindSpeed: &wind, Precipitation: &rain, Pressure: &pressure},
+		},
+	}
+
+	tests := []struct {
+		units                                  Units
+		temperature, min, wind, rain, pressure float64
+	}{
+		{UnitsMetric, 20, 10, 36, 25.4, 1013.25},
+		{UnitsImperial, 68, 50, 22.3694, 1, 29.9213},
+		{UnitsSI, 293.15, 283.15, 10, 25.4, 101325},
+	}
+
+	for _, tt := range tests {
+		day := tt.units.Convert(forecast)["mock"][testDate]
+		got := []float64{day.Temperature, *day.TemperatureMin, *day.WindSpeed, *day.Precipitation, *day.Pressure}
+		want := []float64{tt.temperature, tt.min, tt.wind, tt.rain, tt.pressure}
+		for i := range got {
+			if math.Abs(got[i]-want[i]) > 0.001 {
+				t.Errorf("%s: expected %v, got %v", tt.units, want, got)
+				break
+			}
+		}
+	}
+
+	// the original forecast is left in canonical units
+	if tmin != 10 || forecast["mock"][testDate].Temperature != 20 {
+		t.Error("expected Convert not to modify its input")
+	}
+}
+
+func TestUnitsConvert_MissingVariables(t *testing.T) {
+	forecast := ProviderForecast{"mock": ForecastDay{testDate: {Temperature: 0}}}
+
+	day := UnitsImperial.Convert(forecast)["mock"][testDate]
+	if day.Temperature != 32 || day.WindSpeed != nil || day.Pressure != nil {
+		t.Errorf("unexpected day: %+v", day)
+	}
+}
@@ -2,20 +2,21 @@ package provider
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"sync"
 	"time"
 )
 
 type WeatherAPI struct {
-	params map[string]any
+	params   map[string]any
+	coverage Coverage
+	clock    Clock
 }
 
-func NewWeatherAPI() *WeatherAPI {
+func NewWeatherAPI(clock Clock) *WeatherAPI {
 	return &WeatherAPI{
 		params: make(map[string]any),
+		clock:  clock,
 	}
 }
 
@@ -23,54 +24,408 @@ func (w *WeatherAPI) Name() string {
 	return "WeatherAPI"
 }
 
+func (w *WeatherAPI) Capabilities() Capabilities {
+	return Capabilities{
+		Variables:       []string{VariableTemperatureMax, VariableTemperatureMin, VariableWindSpeed, VariablePrecipitation, VariablePressure},
+		MaxForecastDays: 14,
+		Hourly:          true,
+		Current:         true,
+		Historical:      true,
+		AirQuality:      true,
+		Coverage:        w.coverage,
+		RequiresAPIKey:  true,
+		Attribution:     "Powered by WeatherAPI.com",
+		License:         "WeatherAPI.com Terms of Service",
+	}
+}
+
 func (w *WeatherAPI) GetParams(name string) any {
 	return w.params[name]
 }
 
 func (w *WeatherAPI) SetParams(name string, value any) {
 	w.params[name] = value
+	if name == "Coverage" {
+		w.coverage = coverageParam(value)
+	}
 }
 
-func (w *WeatherAPI) GetForecast(ctx context.Context, lat, lon string) (ForecastDay, error) {
-	return BuildForecastGetter(ctx, lat, lon, w, weatherAPIRrequest)(ctx, lat, lon)
+func (w *WeatherAPI) GetForecast(ctx context.Context, lat, lon string, loc *time.Location) (ForecastDay, error) {
+	return BuildForecastGetter(ctx, lat, lon, loc, w.clock, w, weatherAPIRrequest)(ctx, lat, lon)
 }
 
 const weatherAPIURI = "https://api.weatherapi.com/v1/forecast.json?key=%s&q=%s,%s&dt=%s"
 
+type weatherAPIForecastDay struct {
+	Date string `json:"date"`
+	Day  struct {
+		MaxTempC      float64  `json:"maxtemp_c"`
+		MinTempC      *float64 `json:"mintemp_c"`
+		MaxWindKph    *float64 `json:"maxwind_kph"`
+		TotalPrecipMm *float64 `json:"totalprecip_mm"`
+	} `json:"day"`
+	Hour []weatherAPIHour `json:"hour"`
+}
+
+type weatherAPIHour struct {
+	TimeEpoch  int64    `json:"time_epoch"`
+	TempC      *float64 `json:"temp_c"`
+	WindKph    *float64 `json:"wind_kph"`
+	PrecipMm   *float64 `json:"precip_mm"`
+	PressureMb float64  `json:"pressure_mb"`
+}
+
 type weatherAPIResponceType struct {
+	Location struct {
+		TzID string `json:"tz_id"`
+	} `json:"location"`
 	Forecast struct {
-		Forecastday []struct {
-			Date string `json:"date"`
-			Day  struct {
-				MaxTempC float64 `json:"maxtemp_c"`
-			} `json:"day"`
-		} `json:"forecastday"`
+		Forecastday []weatherAPIForecastDay `json:"forecastday"`
 	} `json:"forecast"`
+	// only with alerts=yes
+	Alerts struct {
+		Alert []weatherAPIAlert `json:"alert"`
+	} `json:"alerts"`
+}
+
+type weatherAPIAlert struct {
+	Headline    string `json:"headline"`
+	Severity    string `json:"severity"`
+	Urgency     string `json:"urgency"`
+	Areas       string `json:"areas"`
+	Event       string `json:"event"`
+	Effective   string `json:"effective"`
+	Expires     string `json:"expires"`
+	Desc        string `json:"desc"`
+	Instruction string `json:"instruction"`
 }
 
-func weatherAPIRrequest(ctx context.Context, wg *sync.WaitGroup, lat, lon string, res *sync.Map, i int, wp WeatherProvider) {
+func weatherAPIRrequest(ctx context.Context, wg *sync.WaitGroup, lat, lon string, loc *time.Location, res *sync.Map, currentDate string, wp WeatherProvider) {
 	defer wg.Done()
 	select {
 	case <-ctx.Done():
 		return
 	default:
 	}
-	currentDate := time.Now().AddDate(0, 0, i).Format("2006-01-02")
-	url := fmt.Sprintf(weatherAPIURI, wp.GetParams("APIKey").(string), lat, lon, currentDate)
 
-	resp, err := http.Get(url)
+	apiKey, ok := wp.GetParams("APIKey").(string)
+	if !ok || apiKey == "" {
+		res.Store(currentDate, fmt.Errorf("%w: weatherapi APIKey", ErrMissingParam))
+		return
+	}
+	url := fmt.Sprintf(weatherAPIURI, apiKey, lat, lon, currentDate)
+
+	var data weatherAPIResponceType
+
+	err := fetchJSON(ctx, url, nil, &data)
 	if err != nil {
 		res.Store(currentDate, err)
 		return
 	}
-	defer resp.Body.Close()
 
-	var data weatherAPIResponceType
+	if len(data.Forecast.Forecastday) == 0 {
+		res.Store(currentDate, fmt.Errorf("%w: no forecast for %s", ErrInvalidResponse, currentDate))
+		return
+	}
+	if data.Location.TzID == "" || data.Location.TzID == loc.String() {
+		res.Store(currentDate, weatherAPIDay(data.Forecast.Forecastday[0]))
+		return
+	}
 
-	err = json.NewDecoder(resp.Body).Decode(&data)
+	var clock Clock
+	if w, ok := wp.(*WeatherAPI); ok {
+		clock = w.clock
+	}
+	day, err := weatherAPIZonedDay(ctx, apiKey, lat, lon, data.Location.TzID, loc, currentDate, data.Forecast.Forecastday[0], clock)
 	if err != nil {
 		res.Store(currentDate, err)
 		return
 	}
-	res.Store(currentDate, data.Forecast.Forecastday[0].Day.MaxTempC)
+	res.Store(currentDate, day)
+}
+
+// weatherAPIZonedDay rebuilds the day date of loc from the hours of the days
+// of the location, in the timezone tz, it spans. fetched is the day of the
+// location already fetched; the others are fetched from the forecast, or
+// from the history for the days before today at the location.
+func weatherAPIZonedDay(ctx context.Context, apiKey, lat, lon, tz string, loc *time.Location, date string, fetched weatherAPIForecastDay, clock Clock) (ForecastData, error) {
+	zone, err := time.LoadLocation(tz)
+	if err != nil {
+		return ForecastData{}, fmt.Errorf("%w: timezone %s: %v", ErrInvalidResponse, tz, err)
+	}
+	midnight, err := time.ParseInLocation(time.DateOnly, date, loc)
+	if err != nil {
+		return ForecastData{}, err
+	}
+	dates, _ := DateRange(midnight.In(zone).Format(time.DateOnly), midnight.AddDate(0, 0, 1).Add(-time.Second).In(zone).Format(time.DateOnly))
+	today := clockOrSystem(clock).Now().In(zone).Format(time.DateOnly)
+
+	forecastDays := []weatherAPIForecastDay{fetched}
+	for _, zoneDate := range dates {
+		if zoneDate == fetched.Date {
+			continue
+		}
+		url := fmt.Sprintf(weatherAPIURI, apiKey, lat, lon, zoneDate)
+		if zoneDate < today {
+			url = fmt.Sprintf(weatherAPIHistoryURI, apiKey, lat, lon, zoneDate, zoneDate)
+		}
+		var data weatherAPIResponceType
+		if err := fetchJSON(ctx, url, nil, &data); err != nil {
+			return ForecastData{}, err
+		}
+		forecastDays = append(forecastDays, data.Forecast.Forecastday...)
+	}
+
+	day, ok := weatherAPIHourlyDays(forecastDays, loc, date, date)[date]
+	if !ok {
+		return ForecastData{}, fmt.Errorf("%w: not every hour of %s in %s", ErrInvalidResponse, date, loc)
+	}
+	return day, nil
+}
+
+// weatherAPIDay converts a day of the forecast and history APIs.
+func weatherAPIDay(forecastDay weatherAPIForecastDay) ForecastData {
+	day := ForecastData{
+		Temperature:    forecastDay.Day.MaxTempC,
+		TemperatureMin: forecastDay.Day.MinTempC,
+		Precipitation:  forecastDay.Day.TotalPrecipMm,
+		WindSpeed:      convertOptional(forecastDay.Day.MaxWindKph, kmhToMs),
+	}
+	// the daily summary has no pressure, average the hourly values instead
+	if len(forecastDay.Hour) > 0 {
+		var pressure float64
+		for _, hour := range forecastDay.Hour {
+			pressure += hour.PressureMb
+		}
+		pressure /= float64(len(forecastDay.Hour))
+		day.Pressure = &pressure
+	}
+	return day
+}
+
+const weatherAPICurrentURI = "https://api.weatherapi.com/v1/current.json?key=%s&q=%s,%s"
+
+type weatherAPICurrentResponse struct {
+	Current *struct {
+		LastUpdatedEpoch int64    `json:"last_updated_epoch"`
+		TempC            float64  `json:"temp_c"`
+		FeelsLikeC       *float64 `json:"feelslike_c"`
+		WindKph          *float64 `json:"wind_kph"`
+		Humidity         *float64 `json:"humidity"`
+		PressureMb       *float64 `json:"pressure_mb"`
+		Condition        struct {
+			Text string `json:"text"`
+			Code int    `json:"code"`
+		} `json:"condition"`
+		// only with aqi=yes
+		AirQuality *struct {
+			PM25            *float64 `json:"pm2_5"`
+			PM10            *float64 `json:"pm10"`
+			Ozone           *float64 `json:"o3"`
+			NitrogenDioxide *float64 `json:"no2"`
+		} `json:"air_quality"`
+	} `json:"current"`
+}
+
+func (w *WeatherAPI) GetCurrent(ctx context.Context, lat, lon string, loc *time.Location) (CurrentConditions, error) {
+	apiKey, ok := w.GetParams("APIKey").(string)
+	if !ok || apiKey == "" {
+		return CurrentConditions{}, fmt.Errorf("%w: weatherapi APIKey", ErrMissingParam)
+	}
+
+	var data weatherAPICurrentResponse
+	err := fetchJSON(ctx, fmt.Sprintf(weatherAPICurrentURI, apiKey, lat, lon), nil, &data)
+	if err != nil {
+		return CurrentConditions{}, err
+	}
+	if data.Current == nil {
+		return CurrentConditions{}, fmt.Errorf("%w: no current conditions", ErrInvalidResponse)
+	}
+
+	return CurrentConditions{
+		ObservedAt:  time.Unix(data.Current.LastUpdatedEpoch, 0).UTC(),
+		Temperature: data.Current.TempC,
+		FeelsLike:   data.Current.FeelsLikeC,
+		WindSpeed:   convertOptional(data.Current.WindKph, kmhToMs),
+		Humidity:    data.Current.Humidity,
+		Pressure:    data.Current.PressureMb,
+		Condition:   weatherAPIConditions[data.Current.Condition.Code],
+		Description: data.Current.Condition.Text,
+	}, nil
+}
+
+const weatherAPIHistoryURI = "https://api.weatherapi.com/v1/history.json?key=%s&q=%s,%s&dt=%s&end_dt=%s"
+
+// HistoricalChunkDays is the longest range of the history API, 30 days, less
+// the day added on each side when the days are not those of the location.
+func (w *WeatherAPI) HistoricalChunkDays() int {
+	return 28
+}
+
+// GetHistorical returns the days of the history API. Its days are those of
+// the timezone of the location, which is only known once fetched, so the
+// range is fetched with a day more on each side: for another loc, the days
+// are aggregated from the hours of the days around them.
+func (w *WeatherAPI) GetHistorical(ctx context.Context, lat, lon string, loc *time.Location, start, end string) (ForecastDay, error) {
+	apiKey, ok := w.GetParams("APIKey").(string)
+	if !ok || apiKey == "" {
+		return nil, fmt.Errorf("%w: weatherapi APIKey", ErrMissingParam)
+	}
+	first, err := time.Parse(time.DateOnly, start)
+	if err != nil {
+		return nil, err
+	}
+	last, err := time.Parse(time.DateOnly, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var data weatherAPIResponceType
+	url := fmt.Sprintf(weatherAPIHistoryURI, apiKey, lat, lon, first.AddDate(0, 0, -1).Format(time.DateOnly), last.AddDate(0, 0, 1).Format(time.DateOnly))
+	if err := fetchJSON(ctx, url, nil, &data); err != nil {
+		return nil, err
+	}
+
+	if data.Location.TzID != "" && data.Location.TzID != loc.String() {
+		return weatherAPIHourlyDays(data.Forecast.Forecastday, loc, start, end), nil
+	}
+
+	result := make(ForecastDay, len(data.Forecast.Forecastday))
+	for _, forecastDay := range data.Forecast.Forecastday {
+		if forecastDay.Date >= start && forecastDay.Date <= end {
+			result[forecastDay.Date] = weatherAPIDay(forecastDay)
+		}
+	}
+	return result, nil
+}
+
+// weatherAPIHourlyDays aggregates the hours of the history into the days of
+// loc from start to end, leaving out the days it does not have every hour of.
+func weatherAPIHourlyDays(forecastDays []weatherAPIForecastDay, loc *time.Location, start, end string) ForecastDay {
+	hours := make(map[string][]weatherAPIHour)
+	for _, forecastDay := range forecastDays {
+		for _, hour := range forecastDay.Hour {
+			date := time.Unix(hour.TimeEpoch, 0).In(loc).Format(time.DateOnly)
+			if date >= start && date <= end {
+				hours[date] = append(hours[date], hour)
+			}
+		}
+	}
+
+	result := make(ForecastDay, len(hours))
+	for date, dayHours := range hours {
+		midnight, _ := time.ParseInLocation(time.DateOnly, date, loc)
+		if len(dayHours) < int(midnight.AddDate(0, 0, 1).Sub(midnight).Hours()) {
+			continue
+		}
+		var day ForecastData
+		var temperatureMin, wind, precipitation, pressure float64
+		var temperatures, winds, precipitations int
+		for _, hour := range dayHours {
+			if hour.TempC != nil {
+				if temperatures == 0 || *hour.TempC > day.Temperature {
+					day.Temperature = *hour.TempC
+				}
+				if temperatures == 0 || *hour.TempC < temperatureMin {
+					temperatureMin = *hour.TempC
+				}
+				temperatures++
+			}
+			if hour.WindKph != nil {
+				wind = max(wind, *hour.WindKph)
+				winds++
+			}
+			if hour.PrecipMm != nil {
+				precipitation += *hour.PrecipMm
+				precipitations++
+			}
+			pressure += hour.PressureMb
+		}
+		if temperatures == 0 {
+			continue
+		}
+		pressure /= float64(len(dayHours))
+		day.TemperatureMin = &temperatureMin
+		day.Pressure = &pressure
+		if winds > 0 {
+			wind = kmhToMs(wind)
+			day.WindSpeed = &wind
+		}
+		if precipitations > 0 {
+			day.Precipitation = &precipitation
+		}
+		result[date] = day
+	}
+	return result
+}
+
+const weatherAPIAlertsURI = "https://api.weatherapi.com/v1/forecast.json?key=%s&q=%s,%s&days=1&alerts=yes"
+
+func (w *WeatherAPI) Covers(lat, lon float64) bool {
+	return w.Capabilities().Coverage.Contains(lat, lon)
+}
+
+// Alerts returns the government alerts WeatherAPI relays with its forecast.
+func (w *WeatherAPI) Alerts(ctx context.Context, lat, lon string) ([]Alert, error) {
+	apiKey, ok := w.GetParams("APIKey").(string)
+	if !ok || apiKey == "" {
+		return nil, fmt.Errorf("%w: weatherapi APIKey", ErrMissingParam)
+	}
+
+	var data weatherAPIResponceType
+	if err := fetchJSON(ctx, fmt.Sprintf(weatherAPIAlertsURI, apiKey, lat, lon), nil, &data); err != nil {
+		return nil, err
+	}
+
+	alerts := make([]Alert, 0, len(data.Alerts.Alert))
+	for _, a := range data.Alerts.Alert {
+		alert := Alert{
+			Event:       a.Event,
+			Headline:    a.Headline,
+			Description: a.Desc,
+			Instruction: a.Instruction,
+			Severity:    normalizeCAP(a.Severity, Severities),
+			Urgency:     normalizeCAP(a.Urgency, Urgencies),
+			Area:        a.Areas,
+			Expires:     parseAlertTime(a.Expires),
+			Sources:     []string{w.Name()},
+		}
+		if effective := parseAlertTime(a.Effective); effective != nil {
+			alert.Effective = *effective
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+const weatherAPIAirQualityURI = "https://api.weatherapi.com/v1/current.json?key=%s&q=%s,%s&aqi=yes"
+
+// GetAirQuality returns the pollutants WeatherAPI reports with the current
+// conditions. Its indexes are categories only, so both are computed from
+// the pollutants.
+func (w *WeatherAPI) GetAirQuality(ctx context.Context, lat, lon string, loc *time.Location) (AirQuality, error) {
+	apiKey, ok := w.GetParams("APIKey").(string)
+	if !ok || apiKey == "" {
+		return AirQuality{}, fmt.Errorf("%w: weatherapi APIKey", ErrMissingParam)
+	}
+
+	var data weatherAPICurrentResponse
+	err := fetchJSON(ctx, fmt.Sprintf(weatherAPIAirQualityURI, apiKey, lat, lon), nil, &data)
+	if err != nil {
+		return AirQuality{}, err
+	}
+	if data.Current == nil || data.Current.AirQuality == nil {
+		return AirQuality{}, fmt.Errorf("%w: no air quality", ErrInvalidResponse)
+	}
+
+	a := data.Current.AirQuality
+	air := AirQuality{
+		ObservedAt:      time.Unix(data.Current.LastUpdatedEpoch, 0).UTC(),
+		PM25:            a.PM25,
+		PM10:            a.PM10,
+		Ozone:           a.Ozone,
+		NitrogenDioxide: a.NitrogenDioxide,
+	}
+	air.ComputeIndexes()
+	return air, nil
 }
@@ -2,7 +2,10 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -19,7 +22,8 @@ func TestWeatherAPIRequest_Success(t *testing.T) {
 					"forecastday": [
 						{
 							"date": "2025-08-01",
-							"day": { "maxtemp_c": 29.1 }
+							"day": { "maxtemp_c": 29.1, "mintemp_c": 17.3, "maxwind_kph": 36.0, "totalprecip_mm": 1.2 },
+							"hour": [{ "pressure_mb": 1010 }, { "pressure_mb": 1014 }]
 						}
 					]
 				}
@@ -33,22 +37,34 @@ func TestWeatherAPIRequest_Success(t *testing.T) {
 	ctx := context.Background()
 
 	api := &WeatherAPI{params: map[string]any{"APIKey": "testkey"}}
-	weatherAPIRrequest(ctx, wg, "52.52", "13.41", res, 0, api)
+	weatherAPIRrequest(ctx, wg, "52.52", "13.41", time.UTC, res, testDate, api)
 	wg.Wait()
 
-	today := time.Now().Format("2006-01-02")
-	val, ok := res.Load(today)
+	val, ok := res.Load(testDate)
 	if !ok {
-		t.Fatalf("expected result for %s not found", today)
+		t.Fatalf("expected result for %s not found", testDate)
 	}
 
-	temp, ok := val.(float64)
+	day, ok := val.(ForecastData)
 	if !ok {
-		t.Fatalf("expected float64, got %T", val)
+		t.Fatalf("expected ForecastData, got %T", val)
 	}
 
-	if temp != 29.1 {
-		t.Errorf("expected 29.1, got %.2f", temp)
+	if day.Temperature != 29.1 {
+		t.Errorf("expected 29.1, got %.2f", day.Temperature)
+	}
+	if day.TemperatureMin == nil || *day.TemperatureMin != 17.3 {
+		t.Errorf("expected min temperature 17.3, got %v", day.TemperatureMin)
+	}
+	// maxwind_kph is normalized to m/s
+	if day.WindSpeed == nil || *day.WindSpeed != 10 {
+		t.Errorf("expected wind speed 10 m/s, got %v", day.WindSpeed)
+	}
+	if day.Precipitation == nil || *day.Precipitation != 1.2 {
+		t.Errorf("expected precipitation 1.2, got %v", day.Precipitation)
+	}
+	if day.Pressure == nil || *day.Pressure != 1012 {
+		t.Errorf("expected mean pressure 1012, got %v", day.Pressure)
 	}
 }
 
@@ -68,13 +84,12 @@ func TestWeatherAPIRequest_InvalidJSON(t *testing.T) {
 	ctx := context.Background()
 
 	api := &WeatherAPI{params: map[string]any{"APIKey": "testkey"}}
-	weatherAPIRrequest(ctx, wg, "52.52", "13.41", res, 0, api)
+	weatherAPIRrequest(ctx, wg, "52.52", "13.41", time.UTC, res, testDate, api)
 	wg.Wait()
 
-	today := time.Now().Format("2006-01-02")
-	val, ok := res.Load(today)
+	val, ok := res.Load(testDate)
 	if !ok {
-		t.Fatalf("expected result for %s not found", today)
+		t.Fatalf("expected result for %s not found", testDate)
 	}
 
 	if _, ok := val.(error); !ok {
@@ -91,12 +106,294 @@ func TestWeatherAPIRequest_ContextCancelled(t *testing.T) {
 	cancel() // cancel before a call
 
 	api := &WeatherAPI{params: map[string]any{"APIKey": "testkey"}}
-	weatherAPIRrequest(ctx, wg, "52.52", "13.41", res, 0, api)
+	weatherAPIRrequest(ctx, wg, "52.52", "13.41", time.UTC, res, testDate, api)
 	wg.Wait()
 
-	today := time.Now().Format("2006-01-02")
-	_, ok := res.Load(today)
+	_, ok := res.Load(testDate)
 	if ok {
 		t.Errorf("expected no result due to cancelled context, but got value")
 	}
 }
+
+func TestWeatherAPIGetForecast_OtherTimezone(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	var mu sync.Mutex
+	var requests []string
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			date := req.URL.Query().Get("dt")
+			mu.Lock()
+			requests = append(requests, req.URL.Path+" "+date)
+			mu.Unlock()
+			// the Berlin day, with the Tokyo hour as temperature
+			midnight, _ := time.ParseInLocation(time.DateOnly, date, berlin)
+			var hours []string
+			for h := midnight; h.Before(midnight.AddDate(0, 0, 1)); h = h.Add(time.Hour) {
+				hours = append(hours, fmt.Sprintf(`{"time_epoch": %d, "temp_c": %d, "pressure_mb": 1010}`, h.Unix(), h.In(tokyo).Hour()))
+			}
+			return mockHTTPResponse(200, fmt.Sprintf(`{"location": {"tz_id": "Europe/Berlin"}, "forecast": {"forecastday": [{"date": %q, "day": {"maxtemp_c": 99}, "hour": [%s]}]}}`, date, strings.Join(hours, ","))), nil
+		},
+	}
+
+	// 08:00 on August 2 in Tokyo, 01:00 in Berlin: the first Tokyo day starts
+	// on August 1 in Berlin, before today there
+	clock := NewFakeClock(time.Date(2025, 8, 1, 23, 0, 0, 0, time.UTC))
+	api := NewWeatherAPI(clock)
+	api.SetParams("APIKey", "testkey")
+	forecast, err := api.GetForecast(context.Background(), "52.52", "13.41", tokyo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, date := range ForecastDates(clock, tokyo) {
+		day, ok := forecast[date]
+		if !ok || day.Temperature != 23 || *day.TemperatureMin != 0 {
+			t.Errorf("%s: expected the day aggregated from the Tokyo hours, got %+v", date, day)
+		}
+	}
+	if len(requests) != 2*FetchDaysCount {
+		t.Errorf("expected a request for each day and the Berlin day before it, got %v", requests)
+	}
+	history := 0
+	for _, request := range requests {
+		if strings.HasPrefix(request, "/v1/history.json") {
+			history++
+			if request != "/v1/history.json 2025-08-01" {
+				t.Errorf("unexpected history request %s", request)
+			}
+		}
+	}
+	if history != 1 {
+		t.Errorf("expected the day before today in Berlin from the history, got %v", requests)
+	}
+}
+
+func TestWeatherAPIGetCurrent(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != "/v1/current.json" {
+				t.Errorf("unexpected path %s", req.URL.Path)
+			}
+			return mockHTTPResponse(200, `{
+				"current": {
+					"last_updated_epoch": 1722510000,
+					"temp_c": 22.0,
+					"feelslike_c": 21.5,
+					"wind_kph": 18.0,
+					"humidity": 70,
+					"pressure_mb": 1012.0,
+					"condition": {"text": "Patchy light drizzle", "code": 1150}
+				}
+			}`), nil
+		},
+	}
+
+	api := NewWeatherAPI(nil)
+	api.SetParams("APIKey", "testkey")
+	current, err := api.GetCurrent(context.Background(), "52.52", "13.41", time.UTC)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if current.Temperature != 22 || current.Pressure == nil || *current.Pressure != 1012 {
+		t.Errorf("unexpected conditions: %+v", current)
+	}
+	// wind_kph is normalized to m/s
+	if current.WindSpeed == nil || *current.WindSpeed != 5 {
+		t.Errorf("expected wind speed 5 m/s, got %v", current.WindSpeed)
+	}
+	if current.Condition != ConditionDrizzle || current.Description != "Patchy light drizzle" {
+		t.Errorf("unexpected condition %q (%q)", current.Condition, current.Description)
+	}
+}
+
+func TestWeatherAPIGetCurrent_MissingAPIKey(t *testing.T) {
+	_, err := NewWeatherAPI(nil).GetCurrent(context.Background(), "52.52", "13.41", time.UTC)
+	if !errors.Is(err, ErrMissingParam) {
+		t.Errorf("expected ErrMissingParam, got %v", err)
+	}
+}
+
+func TestWeatherAPIGetHistorical(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			query := req.URL.Query()
+			if req.URL.Path != "/v1/history.json" || query.Get("dt") != "2024-06-30" || query.Get("end_dt") != "2024-07-03" {
+				t.Errorf("unexpected request %s", req.URL)
+			}
+			return mockHTTPResponse(200, `{
+				"forecast": {
+					"forecastday": [
+						{"date": "2024-06-30", "day": {"maxtemp_c": 19.0}},
+						{"date": "2024-07-01", "day": {"maxtemp_c": 21.0, "maxwind_kph": 36.0}, "hour": [{"pressure_mb": 1008}]},
+						{"date": "2024-07-02", "day": {"maxtemp_c": 23.0}}
+					]
+				}
+			}`), nil
+		},
+	}
+
+	api := NewWeatherAPI(nil)
+	api.SetParams("APIKey", "testkey")
+	days, err := api.GetHistorical(context.Background(), "52.52", "13.41", time.UTC, "2024-07-01", "2024-07-02")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(days) != 2 {
+		t.Fatalf("expected the requested days only, got %v", days)
+	}
+	day := days["2024-07-01"]
+	if day.Temperature != 21 || day.WindSpeed == nil || *day.WindSpeed != 10 || day.Pressure == nil || *day.Pressure != 1008 {
+		t.Errorf("unexpected day: %+v", day)
+	}
+}
+
+func TestWeatherAPIGetHistorical_OtherTimezone(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	// the Berlin days of the range, with the UTC hour as temperature
+	days := func(start, end string) string {
+		dates, _ := DateRange(start, end)
+		var forecastDays []string
+		for _, date := range dates {
+			midnight, _ := time.ParseInLocation(time.DateOnly, date, berlin)
+			var hours []string
+			for h := midnight; h.Before(midnight.AddDate(0, 0, 1)); h = h.Add(time.Hour) {
+				hours = append(hours, fmt.Sprintf(`{"time_epoch": %d, "temp_c": %d, "wind_kph": 18, "precip_mm": 0.5, "pressure_mb": 1010}`, h.Unix(), h.UTC().Hour()))
+			}
+			forecastDays = append(forecastDays, fmt.Sprintf(`{"date": %q, "day": {"maxtemp_c": 99}, "hour": [%s]}`, date, strings.Join(hours, ",")))
+		}
+		return `{"location": {"tz_id": "Europe/Berlin"}, "forecast": {"forecastday": [` + strings.Join(forecastDays, ",") + `]}}`
+	}
+
+	var ranges []string
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			query := req.URL.Query()
+			ranges = append(ranges, query.Get("dt")+"/"+query.Get("end_dt"))
+			return mockHTTPResponse(200, days(query.Get("dt"), query.Get("end_dt"))), nil
+		},
+	}
+
+	api := NewWeatherAPI(nil)
+	api.SetParams("APIKey", "testkey")
+	result, err := api.GetHistorical(context.Background(), "52.52", "13.41", time.UTC, "2024-07-01", "2024-07-01")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(ranges, ",") != "2024-06-30/2024-07-02" {
+		t.Errorf("expected a single range widened by a day, got %v", ranges)
+	}
+	day, ok := result["2024-07-01"]
+	if !ok || len(result) != 1 {
+		t.Fatalf("expected the UTC day only, got %v", result)
+	}
+	if day.Temperature != 23 || *day.TemperatureMin != 0 || *day.Precipitation != 12 || *day.WindSpeed != 5 || *day.Pressure != 1010 {
+		t.Errorf("expected the day aggregated from the UTC hours, got %+v", day)
+	}
+}
+
+func TestWeatherAPIAlerts(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Query().Get("alerts") != "yes" {
+				t.Errorf("expected alerts=yes, got %s", req.URL)
+			}
+			return mockHTTPResponse(200, `{
+				"forecast": {"forecastday": []},
+				"alerts": {"alert": [{
+					"headline": "Met Office yellow warning",
+					"severity": "Moderate",
+					"urgency": "Expected",
+					"areas": "London & South East England",
+					"event": "Yellow Thunderstorm Warning",
+					"effective": "2024-08-01T10:00:00+00:00",
+					"expires": "2024-08-01T21:00:00+00:00",
+					"desc": "Thunderstorms may bring disruption.",
+					"instruction": ""
+				}]}
+			}`), nil
+		},
+	}
+
+	api := NewWeatherAPI(nil)
+	api.SetParams("APIKey", "testkey")
+	alerts, err := api.Alerts(context.Background(), "51.5", "-0.12")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(alerts))
+	}
+	alert := alerts[0]
+	if alert.Severity != SeverityModerate || alert.Urgency != UrgencyExpected || alert.Area != "London & South East England" {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+	if alert.Effective.Hour() != 10 || alert.Expires == nil || alert.Expires.Hour() != 21 || alert.Sources[0] != "WeatherAPI" {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+}
+
+func TestWeatherAPIGetAirQuality(t *testing.T) {
+	originalTransport := http.DefaultTransport
+	defer func() { http.DefaultTransport = originalTransport }()
+
+	http.DefaultTransport = &mockRoundTripper{
+		roundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Query().Get("aqi") != "yes" {
+				t.Errorf("expected aqi=yes, got %s", req.URL)
+			}
+			return mockHTTPResponse(200, `{
+				"current": {
+					"last_updated_epoch": 1722510000,
+					"temp_c": 22.0,
+					"air_quality": {"co": 230.3, "no2": 13.2, "o3": 60.1, "so2": 2.1, "pm2_5": 9.0, "pm10": 15.5, "us-epa-index": 1, "gb-defra-index": 1}
+				}
+			}`), nil
+		},
+	}
+
+	api := NewWeatherAPI(nil)
+	api.SetParams("APIKey", "testkey")
+	air, err := api.GetAirQuality(context.Background(), "52.52", "13.41", time.UTC)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if air.PM25 == nil || *air.PM25 != 9 || air.Ozone == nil || *air.Ozone != 60.1 {
+		t.Errorf("unexpected pollutants: %+v", air)
+	}
+	// computed from PM2.5 at the top of the good band
+	if air.USAQI == nil || *air.USAQI != 50 || air.USCategory != USCategoryGood {
+		t.Errorf("expected US AQI 50, got %v %s", air.USAQI, air.USCategory)
+	}
+	if air.EuropeanAQI == nil || air.EuropeanCategory == "" {
+		t.Errorf("expected a European AQI, got %+v", air)
+	}
+	if air.Pollen != nil {
+		t.Errorf("expected no pollen, got %v", air.Pollen)
+	}
+}
@@ -0,0 +1,208 @@
+// Command geodata builds the datasets embedded by the geocoder package:
+// populated places with their country and timezone, and a raster of IANA
+// timezone boundaries. It lives in its own module so its dependencies stay
+// out of the server build.
+//
+//	cd tools/geodata && go run . -out ../../geocoder/data
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ringsaturn/tzf"
+	"github.com/tidwall/cities"
+)
+
+// resolution of the timezone raster in degrees, must match the geocoder package
+const resolution = 0.1
+
+// countryAliases maps country names used by the cities dataset to ISO 3166 codes
+// when they differ from the names in iso3166.tab.
+var countryAliases = map[string]string{
+	"Bosnia and Herzegovina":            "BA",
+	"Brunei":                            "BN",
+	"Burma":                             "MM",
+	"Cape Verde":                        "CV",
+	"Congo (Brazzaville)":               "CG",
+	"Congo (Kinshasa)":                  "CD",
+	"Cote d'Ivoire":                     "CI",
+	"Czech Republic":                    "CZ",
+	"Falkland Islands (Islas Malvinas)": "FK",
+	"Gambia, The":                       "GM",
+	"Iran":                              "IR",
+	"Korea, North":                      "KP",
+	"Korea, South":                      "KR",
+	"Laos":                              "LA",
+	"Macedonia":                         "MK",
+	"Micronesia, Federated States of":   "FM",
+	"Moldova":                           "MD",
+	"Russia":                            "RU",
+	"Syria":                             "SY",
+	"Taiwan":                            "TW",
+	"Tanzania":                          "TZ",
+	"United Kingdom":                    "GB",
+	"United States":                     "US",
+	"Vatican City":                      "VA",
+	"Vietnam":                           "VN",
+}
+
+func main() {
+	out := flag.String("out", "../../geocoder/data", "output directory")
+	zoneinfo := flag.String("zoneinfo", "/usr/share/zoneinfo", "directory with iso3166.tab and zone.tab")
+	flag.Parse()
+
+	finder, err := tzf.NewDefaultFinder()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	codesByName, err := readTab(filepath.Join(*zoneinfo, "iso3166.tab"), 0, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	codesByZone, err := readTab(filepath.Join(*zoneinfo, "zone.tab"), 2, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := writePlaces(filepath.Join(*out, "places.csv.gz"), finder, codesByName, codesByZone); err != nil {
+		log.Fatal(err)
+	}
+	if err := writeTimezones(filepath.Join(*out, "timezones.txt.gz"), finder); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readTab reads a tab separated zoneinfo table into a map of column key to column value.
+func readTab(path string, key, value int) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) <= max(key, value) {
+			continue
+		}
+		if key == 0 {
+			// iso3166.tab: code, name
+			result[fields[1]] = fields[0]
+			continue
+		}
+		result[fields[key]] = fields[value]
+	}
+	return result, scanner.Err()
+}
+
+func createGzip(path string) (*os.File, *gzip.Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	writer, err := gzip.NewWriterLevel(file, gzip.BestCompression)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, writer, nil
+}
+
+func writePlaces(path string, finder tzf.F, codesByName, codesByZone map[string]string) error {
+	file, gz, err := createGzip(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(gz)
+	writer.Write([]string{"name", "country", "country_code", "lat", "lon", "timezone"})
+	for _, city := range cities.Cities {
+		timezone := finder.GetTimezoneName(city.Longitude, city.Latitude)
+		code, ok := codesByName[city.Country]
+		if !ok {
+			code, ok = countryAliases[city.Country]
+		}
+		if !ok {
+			code = codesByZone[timezone]
+		}
+		writer.Write([]string{
+			city.City,
+			city.Country,
+			code,
+			strconv.FormatFloat(city.Latitude, 'f', 4, 64),
+			strconv.FormatFloat(city.Longitude, 'f', 4, 64),
+			timezone,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeTimezones samples the timezone at the center of every cell of the raster,
+// north to south, and writes one run-length encoded row per line after a first
+// line listing the zone names:
+//
+//	Africa/Abidjan,Africa/Accra,...
+//	index*count index*count ...
+func writeTimezones(path string, finder tzf.F) error {
+	file, gz, err := createGzip(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, cols := int(180/resolution), int(360/resolution)
+	indexes := make(map[string]int)
+	var names []string
+	var lines []string
+
+	for row := 0; row < rows; row++ {
+		lat := 90 - (float64(row)+0.5)*resolution
+		var runs []string
+		current, count := -1, 0
+		for col := 0; col < cols; col++ {
+			lon := -180 + (float64(col)+0.5)*resolution
+			name := finder.GetTimezoneName(lon, lat)
+			index, ok := indexes[name]
+			if !ok {
+				index = len(names)
+				indexes[name] = index
+				names = append(names, name)
+			}
+			if index != current && count > 0 {
+				runs = append(runs, fmt.Sprintf("%d*%d", current, count))
+				count = 0
+			}
+			current = index
+			count++
+		}
+		runs = append(runs, fmt.Sprintf("%d*%d", current, count))
+		lines = append(lines, strings.Join(runs, " "))
+	}
+
+	fmt.Fprintln(gz, strings.Join(names, ","))
+	for _, line := range lines {
+		fmt.Fprintln(gz, line)
+	}
+	return gz.Close()
+}